@@ -7,16 +7,52 @@ import './Form.css';
 const Login = () => {
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
+    const [challengeId, setChallengeId] = useState(null);
+    const [code, setCode] = useState('');
     const navigate = useNavigate();
 
     const handleLogin = async (e) => {
         e.preventDefault();
         axios.post('/auth/login', { email, password })
+            .then((res) => {
+                if (res.data.challenge) {
+                    setChallengeId(res.data.challenge.challengeId);
+                    return;
+                }
+                navigate('/home');
+            });
+    };
+
+    const handleVerify = async (e) => {
+        e.preventDefault();
+        axios.post('/auth/login/verify', { challengeId, code })
             .then((_res) => {
                 navigate('/home');
             });
     };
 
+    if (challengeId) {
+        return (
+            <div className="form-container">
+                <div className="form-box">
+                    <h2>Two-factor code</h2>
+                    <form onSubmit={handleVerify}>
+                        <input 
+                            type="text" 
+                            placeholder="Code from your app or a recovery code" 
+                            value={code} 
+                            onChange={(e) => setCode(e.target.value)} 
+                            required 
+                            autoComplete="one-time-code"
+                            className="form-input" 
+                        />
+                        <button type="submit" className="form-button">Verify</button>
+                    </form>
+                </div>
+            </div>
+        );
+    }
+
     return (
         <div className="form-container">
             <div className="form-box">
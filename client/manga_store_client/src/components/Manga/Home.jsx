@@ -18,15 +18,15 @@ const Home = () => {
             try {
                 const [popularResponse, recommendedResponse, similarResponse, newestResponse] = await Promise.all([
                     axios.get('/manga/popular'),
-                    axios.get('/user/recs/preferences'),
-                    axios.get('/user/recs/similar_users'),
-                    axios.get('/manga'),
+                    axios.get('/user/recs/preferences', { params: { limit: 10 } }),
+                    axios.get('/user/recs/similar_users', { params: { limit: 10 } }),
+                    axios.get('/manga', { params: { limit: 10 } }),
                 ]);
 
                 setPopularManga(popularResponse.data);
-                setRecommendedManga(recommendedResponse.data);
-                setSimilarTasteManga(similarResponse.data);
-                setNewestManga(newestResponse.data);
+                setRecommendedManga(recommendedResponse.data.items);
+                setSimilarTasteManga(similarResponse.data.items);
+                setNewestManga(newestResponse.data.items);
             } catch (err) {
                 setError(err.message);
             } finally {
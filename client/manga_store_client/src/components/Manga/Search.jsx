@@ -1,28 +1,92 @@
 // Search.js
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import axios from '../../axios';
 
+const parseNumber = (value) => (value === '' ? undefined : parseFloat(value));
+
 const Search = () => {
     const [query, setQuery] = useState('');
     const [genres, setGenres] = useState([]);
     const [author, setAuthor] = useState('');
+    const [minPrice, setMinPrice] = useState('');
+    const [maxPrice, setMaxPrice] = useState('');
+    const [minRating, setMinRating] = useState('');
+    const [inStock, setInStock] = useState(false);
+    const [sort, setSort] = useState('');
     const [limit, setLimit] = useState(10);
     const [results, setResults] = useState([]);
+    const [nextCursor, setNextCursor] = useState('');
+    const [total, setTotal] = useState(0);
+    const [facets, setFacets] = useState(null);
+    const [suggestions, setSuggestions] = useState([]);
+    const [didYouMean, setDidYouMean] = useState('');
     const [loading, setLoading] = useState(false);
     const [error, setError] = useState(null);
 
-    const handleSearch = async () => {
+    useEffect(() => {
+        if (!query.trim()) {
+            setSuggestions([]);
+            setDidYouMean('');
+            return;
+        }
+
+        const timer = setTimeout(async () => {
+            try {
+                const response = await axios.get('/manga/suggest', { params: { q: query } });
+                setSuggestions(response.data.completions);
+                setDidYouMean(response.data.didYouMean || '');
+            } catch {
+                setSuggestions([]);
+            }
+        }, 200);
+
+        return () => clearTimeout(timer);
+    }, [query]);
+
+    const pickSuggestion = (suggestion) => {
+        setSuggestions([]);
+        if (suggestion.type === 'author') {
+            setQuery('');
+            setAuthor(suggestion.text);
+            runSearch({ query: '', author: suggestion.text });
+            return;
+        }
+        setQuery(suggestion.text);
+        runSearch({ query: suggestion.text });
+    };
+
+    const useCorrection = () => {
+        setQuery(didYouMean);
+        setSuggestions([]);
+        runSearch({ query: didYouMean });
+    };
+
+    // runSearch starts a new search; passing a cursor appends the next page
+    // of the current one instead.
+    const runSearch = async (overrides = {}, cursor = '') => {
         setLoading(true);
         setError(null);
 
+        const request = {
+            query,
+            genres,
+            author,
+            minPrice: parseNumber(minPrice),
+            maxPrice: parseNumber(maxPrice),
+            minRating: parseNumber(minRating),
+            inStock,
+            sort,
+            limit,
+            cursor,
+            ...overrides,
+        };
+
         try {
-            const response = await axios.post('/manga/search', {
-                query,
-                genres,
-                author,
-                limit,
-            });
-            setResults(response.data);
+            const response = await axios.post('/manga/search', request);
+            setResults(cursor ? [...results, ...response.data.items] : response.data.items);
+            setNextCursor(response.data.nextCursor);
+            setTotal(response.data.total);
+            setFacets(response.data.facets);
         } catch (err) {
             setError(err.response ? err.response.data.error : 'Error performing search');
         } finally {
@@ -35,6 +99,33 @@ const Search = () => {
         setGenres(value ? value.split(',') : []);
     };
 
+    const toggleGenre = (genre) => {
+        const next = genres.includes(genre) ? genres.filter((g) => g !== genre) : [...genres, genre];
+        setGenres(next);
+        runSearch({ genres: next });
+    };
+
+    const pickAuthor = (value) => {
+        setAuthor(value);
+        runSearch({ author: value });
+    };
+
+    const pickPrice = (bucket) => {
+        const min = String(bucket.min);
+        const max = bucket.max === undefined ? '' : String(bucket.max);
+        setMinPrice(min);
+        setMaxPrice(max);
+        runSearch({ minPrice: bucket.min, maxPrice: bucket.max });
+    };
+
+    const pickRating = (bucket) => {
+        setMinRating(String(bucket.minRating));
+        runSearch({ minRating: bucket.minRating });
+    };
+
+    const priceLabel = (bucket) =>
+        bucket.max === undefined ? `$${bucket.min}+` : `$${bucket.min} – $${bucket.max}`;
+
     return (
         <div className="search-container">
             <h2>Search Manga</h2>
@@ -45,6 +136,24 @@ const Search = () => {
                     value={query}
                     onChange={(e) => setQuery(e.target.value)}
                 />
+                {suggestions.length > 0 && (
+                    <ul className="search-suggestions">
+                        {suggestions.map((suggestion) => (
+                            <li
+                                key={`${suggestion.type}:${suggestion.mangaId || suggestion.text}`}
+                                onClick={() => pickSuggestion(suggestion)}
+                            >
+                                {suggestion.text}
+                                {suggestion.type === 'author' && <em> (author)</em>}
+                            </li>
+                        ))}
+                    </ul>
+                )}
+                {didYouMean && (
+                    <p className="search-correction">
+                        Did you mean <button onClick={useCorrection}>{didYouMean}</button>?
+                    </p>
+                )}
                 <label>Genres (comma-separated):</label>
                 <input
                     type="text"
@@ -57,6 +166,48 @@ const Search = () => {
                     value={author}
                     onChange={(e) => setAuthor(e.target.value)}
                 />
+                <label>Price:</label>
+                <input
+                    type="number"
+                    value={minPrice}
+                    onChange={(e) => setMinPrice(e.target.value)}
+                    placeholder="Min"
+                    min="0"
+                />
+                <input
+                    type="number"
+                    value={maxPrice}
+                    onChange={(e) => setMaxPrice(e.target.value)}
+                    placeholder="Max"
+                    min="0"
+                />
+                <label>Minimum rating:</label>
+                <input
+                    type="number"
+                    value={minRating}
+                    onChange={(e) => setMinRating(e.target.value)}
+                    min="0"
+                    max="5"
+                    step="0.5"
+                />
+                <label>
+                    <input
+                        type="checkbox"
+                        checked={inStock}
+                        onChange={(e) => setInStock(e.target.checked)}
+                    />
+                    In stock only
+                </label>
+                <label>Sort by:</label>
+                <select value={sort} onChange={(e) => setSort(e.target.value)}>
+                    <option value="">Relevance</option>
+                    <option value="newest">Newest</option>
+                    <option value="price_asc">Price: low to high</option>
+                    <option value="price_desc">Price: high to low</option>
+                    <option value="rating">Rating</option>
+                    <option value="popular">Popularity</option>
+                    <option value="title">Title</option>
+                </select>
                 <label>Limit:</label>
                 <input
                     type="number"
@@ -64,12 +215,54 @@ const Search = () => {
                     onChange={(e) => setLimit(parseInt(e.target.value) || 10)}
                     min="1"
                 />
-                <button onClick={handleSearch} className="search-button">Search</button>
+                <button onClick={() => runSearch()} className="search-button">Search</button>
             </div>
 
             {loading && <p className="results-message">Loading...</p>}
             {error && <p className="results-message">{error}</p>}
 
+            {facets && (
+                <div className="search-facets">
+                    <p>{total} results</p>
+
+                    <h4>Genres</h4>
+                    {facets.genres.map((facet) => (
+                        <label key={facet.value}>
+                            <input
+                                type="checkbox"
+                                checked={genres.includes(facet.value)}
+                                onChange={() => toggleGenre(facet.value)}
+                            />
+                            {facet.value} ({facet.count})
+                        </label>
+                    ))}
+
+                    <h4>Authors</h4>
+                    {facets.authors.map((facet) => (
+                        <button key={facet.value} onClick={() => pickAuthor(facet.value)}>
+                            {facet.value} ({facet.count})
+                        </button>
+                    ))}
+
+                    <h4>Price</h4>
+                    {facets.price.filter((bucket) => bucket.count > 0).map((bucket) => (
+                        <button key={bucket.min} onClick={() => pickPrice(bucket)}>
+                            {priceLabel(bucket)} ({bucket.count})
+                        </button>
+                    ))}
+
+                    <h4>Rating</h4>
+                    {facets.rating.filter((bucket) => bucket.count > 0).map((bucket) => (
+                        <button key={bucket.minRating} onClick={() => pickRating(bucket)}>
+                            {bucket.minRating}★ & up ({bucket.count})
+                        </button>
+                    ))}
+
+                    <h4>Availability</h4>
+                    <p>In stock ({facets.inStock}) · Out of stock ({facets.outOfStock})</p>
+                </div>
+            )}
+
             <div className="results-container">
                 {results.map((manga) => (
                     <div
@@ -82,6 +275,10 @@ const Search = () => {
                     </div>
                 ))}
             </div>
+
+            {nextCursor && !loading && (
+                <button onClick={() => runSearch({}, nextCursor)} className="search-button">Load more</button>
+            )}
         </div>
     );
 };
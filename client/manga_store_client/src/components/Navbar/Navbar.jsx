@@ -13,6 +13,12 @@ const Navbar = () => {
         })  
     };
 
+    const handleLogoutEverywhere = () => {
+        axios.post("/auth/logout/all").then((_res) => {
+            navigate("/login");
+        })
+    };
+
     return (
         <nav className="navbar">
             <div className="navbar-logo">
@@ -37,6 +43,9 @@ const Navbar = () => {
                 <li>
                     <button onClick={handleLogout} className="logout-button">Logout</button>
                 </li>
+                <li>
+                    <button onClick={handleLogoutEverywhere} className="logout-button">Logout everywhere</button>
+                </li>
             </ul>
         </nav>
     );
@@ -1 +1,123 @@
-package main
\ No newline at end of file
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"manga_store/internal/app"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"manga_store/internal/mailer"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The dev server runs the whole API over the memory stores, so it needs
+// neither MongoDB, Neo4j nor Redis. Everything is lost when it stops; the
+// fixture files are loaded again at every start.
+func main() {
+	mangaFile := flag.String("manga-file", "manga.json", "manga fixture file, skipped if missing")
+	usersFile := flag.String("users-file", "users.json", "users fixture file, skipped if missing")
+	ephemeralKeys := flag.Bool("ephemeral-keys", true, "sign tokens and cursors with random keys when JWT_KEYS or CURSOR_SECRET is not set")
+	flag.Parse()
+
+	os.Setenv("ALLOW_EPHEMERAL_KEYS", strconv.FormatBool(*ephemeralKeys))
+	for _, load := range []func() error{services.LoadTokenKeys, pagination.LoadSecret} {
+		if err := load(); err != nil {
+			fmt.Fprintln(os.Stderr, "dev:", err)
+			os.Exit(1)
+		}
+	}
+
+	stores := repositories.NewMemoryStores()
+
+	if err := loadFixtures(stores, *mangaFile, *usersFile); err != nil {
+		fmt.Fprintln(os.Stderr, "dev:", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	services.NewCatalogSearch(stores).Start(ctx)
+	services.NewMangaService(stores).StartMaintenance(ctx)
+
+	api := app.New(stores, mailer.Default(), app.DefaultConfig())
+
+	port := helpers.GetEnv("PORT", "3000")
+	logger.Info("Serving the API over in-memory stores on :" + port)
+	if err := app.Serve(ctx, api, fmt.Sprintf(":%s", port), 5*time.Second); err != nil {
+		fmt.Fprintln(os.Stderr, "dev:", err)
+		os.Exit(1)
+	}
+}
+
+// loadFixtures adds the fixture manga and users, with their graph nodes.
+// Fixture users can log in straight away, as they can after cmd/seed.
+func loadFixtures(stores repositories.Stores, mangaFile, usersFile string) error {
+	ctx := context.Background()
+
+	var manga []models.Manga
+	if err := readJSON(mangaFile, &manga); err != nil {
+		return err
+	}
+	for _, m := range manga {
+		m.ID = ""
+		created, err := stores.Manga.Create(ctx, m)
+		if err != nil {
+			return err
+		}
+		err = stores.Outbox.Record(ctx, models.GraphEventMangaUpserted, models.GraphEventPayload{
+			Manga: []models.GraphManga{{ID: created.ID, Title: created.Title, Genres: created.Genres}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var users []models.User
+	if err := readJSON(usersFile, &users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		u.ID = ""
+		u.EmailVerified = true
+		created, err := stores.Users.Create(ctx, u)
+		if err != nil {
+			return err
+		}
+		err = stores.Outbox.Record(ctx, models.GraphEventUserUpserted, models.GraphEventPayload{
+			UserID: created.ID,
+			Email:  created.Email,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Loaded %d manga and %d users", len(manga), len(users)))
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
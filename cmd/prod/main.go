@@ -1,50 +1,81 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"manga_store/internal/app"
 	"manga_store/internal/databases"
 	"manga_store/internal/helpers"
-	"manga_store/internal/routers"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"manga_store/internal/logger"
+	"manga_store/internal/mailer"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	app := fiber.New(fiber.Config{
-		DisableStartupMessage: true,
-	})
-
-	clientPort := helpers.GetEnv("CLIENT_PORT", "5173")
-
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://localhost:" + clientPort,
-		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept",
-	}))
+	// Tokens and cursors signed with random keys stop working at the next
+	// restart, so the server does not start without configured ones.
+	for _, load := range []func() error{services.LoadTokenKeys, pagination.LoadSecret} {
+		if err := load(); err != nil {
+			logger.Error("Refusing to start: " + err.Error())
+			os.Exit(1)
+		}
+	}
 
 	databases.InitMongo()
 	databases.InitNeo4j()
 	databases.InitRedis()
 
-	routers.NewAuthRouter().SetupRoutes(app)
+	stores := repositories.Default()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	// A second signal kills the server without waiting for the drain.
+	context.AfterFunc(signals, stopSignals)
 
-	app.Use(AuthMiddleware())
+	// Workers and requests are stopped separately from the signal, so the
+	// workers keep relaying graph events and refreshing caches while the
+	// last requests drain.
+	workers, stopWorkers := context.WithCancel(context.Background())
+	requests, cancelRequests := context.WithCancel(context.Background())
+
+	stopped := []<-chan struct{}{
+		services.NewGraphSyncRelay(stores).Start(workers),
+		services.NewCatalogSearch(stores).Start(workers),
+		services.NewMangaService(stores).StartMaintenance(workers),
+	}
 
-	routers.NewMangaRouter().SetupRoutes(app)
-	routers.NewUserRouter().SetupRoutes(app)
+	config := app.DefaultConfig()
+	config.Context = requests
+	api := app.New(stores, mailer.Default(), config)
 
+	drain := helpers.GetEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second)
 	port := helpers.GetEnv("PORT", "3000")
-	app.Listen(fmt.Sprintf(":%s", port))
-}
 
-func AuthMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		loggedIn := c.Cookies("loggedIn")
-		data := c.Cookies("data")
-		if loggedIn != "true" || data == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
-		}
-		return c.Next()
+	logger.Info("Listening on :" + port)
+	err := app.Serve(signals, api, fmt.Sprintf(":%s", port), drain)
+
+	logger.Info("Shutting down")
+	s := shutdown{started: time.Now()}
+	s.step("requests", err)
+
+	cancelRequests()
+	stopWorkers()
+	s.step("background workers", waitStopped(stopped, drain))
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	s.step("MongoDB", databases.CloseMongo(ctx))
+	s.step("Neo4j", databases.CloseNeo4j(ctx))
+	s.step("Redis", databases.CloseRedis())
+
+	if !s.report() {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"manga_store/internal/logger"
+	"strings"
+	"time"
+)
+
+// shutdown collects what each shutdown step stopped, and whether it stopped
+// cleanly, for the summary logged at the end.
+type shutdown struct {
+	started time.Time
+	stopped []string
+	failed  []string
+}
+
+func (s *shutdown) step(name string, err error) {
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error stopping %s: %s", name, err))
+		s.failed = append(s.failed, name)
+		return
+	}
+	s.stopped = append(s.stopped, name)
+}
+
+// report logs the summary and returns whether every step succeeded.
+func (s *shutdown) report() bool {
+	took := time.Since(s.started).Round(time.Millisecond)
+	if len(s.failed) > 0 {
+		logger.Error(fmt.Sprintf("Shut down in %s; could not cleanly stop %s", took, strings.Join(s.failed, ", ")))
+		return false
+	}
+	logger.Info(fmt.Sprintf("Shut down cleanly in %s: stopped %s", took, strings.Join(s.stopped, ", ")))
+	return true
+}
+
+// waitStopped waits up to timeout for every worker to close its channel.
+func waitStopped(stopped []<-chan struct{}, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for i, done := range stopped {
+		select {
+		case <-done:
+		case <-deadline:
+			return fmt.Errorf("%d of %d workers still running after %s", len(stopped)-i, len(stopped), timeout)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"manga_store/internal/databases"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "rewrite Neo4j to match MongoDB, instead of only reporting the differences")
+	flag.Parse()
+
+	databases.InitMongo()
+	databases.InitNeo4j()
+	defer databases.CloseNeo4j(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reconcileService := services.NewReconcileService(repositories.Default())
+
+	report, err := reconcileService.Diff(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reconcile failed:", err)
+		os.Exit(2)
+	}
+
+	printReport(report)
+
+	if report.Differences() == 0 {
+		fmt.Println("Neo4j is in sync with MongoDB")
+		return
+	}
+
+	if !*repair {
+		fmt.Printf("%d differences found, run with -repair to fix them\n", report.Differences())
+		os.Exit(1)
+	}
+
+	if err := reconcileService.Repair(ctx, report); err != nil {
+		fmt.Fprintln(os.Stderr, "repair failed:", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("repaired %d differences\n", report.Differences())
+}
+
+func printReport(r *models.ReconcileReport) {
+	section("Manga missing from Neo4j", len(r.MissingManga), func() {
+		for _, m := range r.MissingManga {
+			fmt.Printf("  + %s %q %v\n", m.ID, m.Title, m.Genres)
+		}
+	})
+	section("Manga in Neo4j that are deleted or unknown in MongoDB", len(r.StaleManga), func() {
+		for _, id := range r.StaleManga {
+			fmt.Printf("  - %s\n", id)
+		}
+	})
+	section("Manga with a different title or genres", len(r.MismatchedManga), func() {
+		for _, m := range r.MismatchedManga {
+			fmt.Printf("  ~ %s should be %q [%s]\n", m.ID, m.Title, strings.Join(m.Genres, ", "))
+		}
+	})
+	section("Users missing from Neo4j", len(r.MissingUsers), func() {
+		for _, u := range r.MissingUsers {
+			fmt.Printf("  + %s %s\n", u.ID, u.Email)
+		}
+	})
+	section("Users in Neo4j that are deleted or unknown in MongoDB", len(r.StaleUsers), func() {
+		for _, id := range r.StaleUsers {
+			fmt.Printf("  - %s\n", id)
+		}
+	})
+	section("Users with a different email", len(r.MismatchedUsers), func() {
+		for _, u := range r.MismatchedUsers {
+			fmt.Printf("  ~ %s should be %s\n", u.ID, u.Email)
+		}
+	})
+	section("RATED edges missing from Neo4j", len(r.MissingRatings), func() {
+		for _, rating := range r.MissingRatings {
+			fmt.Printf("  + %s -> %s (%.2f)\n", rating.UserID, rating.MangaID, rating.Score)
+		}
+	})
+	section("RATED edges with no rating in MongoDB", len(r.StaleRatings), func() {
+		for _, rating := range r.StaleRatings {
+			fmt.Printf("  - %s -> %s\n", rating.UserID, rating.MangaID)
+		}
+	})
+	section("RATED edges with a different score", len(r.MismatchedScores), func() {
+		for _, rating := range r.MismatchedScores {
+			fmt.Printf("  ~ %s -> %s should be %.2f\n", rating.UserID, rating.MangaID, rating.Score)
+		}
+	})
+	section("PURCHASED edges missing from Neo4j", len(r.MissingPurchases), func() {
+		for _, purchase := range r.MissingPurchases {
+			fmt.Printf("  + %s -> %s\n", purchase.UserID, purchase.MangaID)
+		}
+	})
+	section("PURCHASED edges with no purchase in MongoDB", len(r.StalePurchases), func() {
+		for _, purchase := range r.StalePurchases {
+			fmt.Printf("  - %s -> %s\n", purchase.UserID, purchase.MangaID)
+		}
+	})
+}
+
+func section(title string, count int, print func()) {
+	if count == 0 {
+		return
+	}
+	fmt.Printf("%s (%d):\n", title, count)
+	print()
+}
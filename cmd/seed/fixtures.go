@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"manga_store/internal/models"
+	"net/mail"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func loadManga(path string) ([]models.Manga, error) {
+	var manga []models.Manga
+	if err := readJSON(path, &manga); err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	seen := map[string]int{}
+	for i, m := range manga {
+		invalid := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Errorf("%s[%d]: %s", path, i, fmt.Sprintf(format, args...)))
+		}
+
+		if strings.TrimSpace(m.Title) == "" {
+			invalid("title is required")
+		} else if first, ok := seen[m.Title]; ok {
+			invalid("title %q duplicates entry %d", m.Title, first)
+		} else {
+			seen[m.Title] = i
+		}
+		if strings.TrimSpace(m.Author) == "" {
+			invalid("author is required")
+		}
+		if len(m.Genres) == 0 {
+			invalid("at least one genre is required")
+		}
+		if m.Price < 0 {
+			invalid("price must not be negative")
+		}
+		if m.Quantity < 0 || m.Sold < 0 || m.Views < 0 || m.RatedTimes < 0 {
+			invalid("counters must not be negative")
+		}
+		if m.Rating < 0 || m.Rating > 5 {
+			invalid("rating must be between 0 and 5")
+		}
+	}
+
+	return manga, errors.Join(problems...)
+}
+
+func loadUsers(path string) ([]models.User, error) {
+	var users []models.User
+	if err := readJSON(path, &users); err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	seen := map[string]int{}
+	for i, u := range users {
+		invalid := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Errorf("%s[%d]: %s", path, i, fmt.Sprintf(format, args...)))
+		}
+
+		if _, err := mail.ParseAddress(u.Email); err != nil {
+			invalid("email %q is not valid", u.Email)
+		} else if first, ok := seen[u.Email]; ok {
+			invalid("email %q duplicates entry %d", u.Email, first)
+		} else {
+			seen[u.Email] = i
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			invalid("passwordHash is not a bcrypt hash")
+		}
+		if len(u.PurchaseHistory) > 0 || len(u.Ratings) > 0 {
+			invalid("purchase history and ratings reference manga ids and cannot be seeded")
+		}
+	}
+
+	return users, errors.Join(problems...)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"manga_store/internal/models"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// generatedPassword is the password of every synthetic user, matching the one
+// the simulate command logs in with.
+const generatedPassword = "12345678"
+
+// genreWeights follows the genre mix of the catalog in manga.json, with a
+// long tail of genres it does not have yet.
+var genreWeights = []struct {
+	genre  string
+	weight int
+}{
+	{"Romance", 14}, {"Fantasy", 11}, {"Adventure", 10}, {"Slice of Life", 10},
+	{"Action", 8}, {"Drama", 6}, {"Comedy", 5}, {"Mystery", 2}, {"Thriller", 2},
+	{"Horror", 2}, {"Sci-Fi", 2}, {"Sports", 1}, {"Historical", 1}, {"Psychological", 1},
+}
+
+var (
+	givenNames  = []string{"Akira", "Haruki", "Yuki", "Ren", "Sora", "Hina", "Kaito", "Mei", "Riku", "Aoi", "Takeshi", "Naoko", "Kenji", "Sakura", "Daichi", "Emi"}
+	familyNames = []string{"Tanaka", "Suzuki", "Takahashi", "Watanabe", "Ito", "Yamamoto", "Nakamura", "Kobayashi", "Kato", "Yoshida", "Yamada", "Sasaki", "Matsumoto", "Inoue", "Kimura", "Hayashi"}
+	titleHeads  = []string{"Blade", "Spirit", "Crimson", "Silent", "Eternal", "Midnight", "Broken", "Golden", "Hidden", "Last", "Wandering", "Frozen", "Scarlet", "Shadow", "Distant", "Paper"}
+	titleTails  = []string{"Academy", "Chronicle", "Garden", "Kingdom", "Requiem", "Summer", "Contract", "Frontier", "Festival", "Labyrinth", "Promise", "Voyage", "Café", "Hunter", "Melody", "Empire"}
+)
+
+// generator produces synthetic catalog and user data for load testing.
+// Authors follow a Zipf distribution, so a few prolific authors write most
+// titles, and genres are drawn by catalog weight.
+type generator struct {
+	rand       *rand.Rand
+	genreTotal int
+	serial     int64
+	authors    []string
+}
+
+func newGenerator(r *rand.Rand) *generator {
+	g := &generator{rand: r, serial: time.Now().Unix()}
+	for _, w := range genreWeights {
+		g.genreTotal += w.weight
+	}
+	return g
+}
+
+func (g *generator) manga(count int) []models.Manga {
+	poolSize := int(math.Max(1, float64(count)/4))
+	g.authors = make([]string, poolSize)
+	for i := range g.authors {
+		g.authors[i] = g.personName()
+	}
+	authorRank := rand.NewZipf(g.rand, 1.3, 1, uint64(poolSize-1))
+
+	now := time.Now()
+	manga := make([]models.Manga, 0, count)
+	for i := 0; i < count; i++ {
+		author := g.authors[authorRank.Uint64()]
+		title := fmt.Sprintf("%s %s %d", g.pick(titleHeads), g.pick(titleTails), g.serial+int64(i))
+		price := float64(5+g.rand.Intn(11)) + 0.99
+
+		manga = append(manga, models.Manga{
+			Title:       title,
+			ImageURL:    "https://i.pinimg.com/736x/36/3d/d6/363dd6296ac84dc8876b13d734756771.jpg",
+			Author:      author,
+			Genres:      g.genres(),
+			Price:       price,
+			Description: fmt.Sprintf("%s by %s, generated for load testing.", title, author),
+			CreatedAt:   int(now.Add(-time.Duration(g.rand.Int63n(int64(2 * 365 * 24 * time.Hour)))).Unix()),
+			Quantity:    20 + g.rand.Intn(181),
+		})
+	}
+
+	return manga
+}
+
+func (g *generator) users(count int) ([]models.User, error) {
+	// bcrypt at cost 12 is slow by design; hash once and share it.
+	hash, err := bcrypt.GenerateFromPassword([]byte(generatedPassword), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, count)
+	for i := 0; i < count; i++ {
+		name := g.personName()
+		users = append(users, models.User{
+			Name:            name,
+			Email:           fmt.Sprintf("%s.%d@loadtest.example.com", strings.ToLower(strings.ReplaceAll(name, " ", ".")), g.serial+int64(i)),
+			PasswordHash:    string(hash),
+			PurchaseHistory: []models.Purchase{},
+			Ratings:         []models.Rating{},
+		})
+	}
+
+	return users, nil
+}
+
+// genres draws one to three distinct genres, two being the most common.
+func (g *generator) genres() []string {
+	count := 1
+	switch n := g.rand.Intn(10); {
+	case n >= 8:
+		count = 3
+	case n >= 3:
+		count = 2
+	}
+
+	var genres []string
+	for len(genres) < count {
+		genre := g.weightedGenre()
+		if !contains(genres, genre) {
+			genres = append(genres, genre)
+		}
+	}
+
+	return genres
+}
+
+func (g *generator) weightedGenre() string {
+	n := g.rand.Intn(g.genreTotal)
+	for _, w := range genreWeights {
+		if n < w.weight {
+			return w.genre
+		}
+		n -= w.weight
+	}
+	return genreWeights[0].genre
+}
+
+func (g *generator) personName() string {
+	return g.pick(givenNames) + " " + g.pick(familyNames)
+}
+
+func (g *generator) pick(values []string) string {
+	return values[g.rand.Intn(len(values))]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"manga_store/internal/databases"
+	"manga_store/internal/models"
+	"math/rand"
+	"os"
+	"time"
+)
+
+func main() {
+	reset := flag.Bool("reset", false, "delete existing data of the seeded kinds first")
+	only := flag.String("only", "", "seed just one kind: manga or users")
+	mangaFile := flag.String("manga-file", "manga.json", "manga fixture file")
+	usersFile := flag.String("users-file", "users.json", "users fixture file")
+	fixtures := flag.Bool("fixtures", true, "load the fixture files")
+	generateManga := flag.Int("generate-manga", 0, "number of synthetic titles to add")
+	generateUsers := flag.Int("generate-users", 0, "number of synthetic users to add")
+	randSeed := flag.Int64("rand-seed", time.Now().UnixNano(), "seed for the synthetic generator")
+	flag.Parse()
+
+	seedManga, seedUsers := true, true
+	switch *only {
+	case "":
+	case "manga":
+		seedUsers = false
+	case "users":
+		seedManga = false
+	default:
+		fail(fmt.Errorf("-only must be manga or users, got %q", *only))
+	}
+
+	var manga []models.Manga
+	var users []models.User
+	if *fixtures {
+		var err error
+		if seedManga {
+			if manga, err = loadManga(*mangaFile); err != nil {
+				fail(err)
+			}
+		}
+		if seedUsers {
+			if users, err = loadUsers(*usersFile); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	generator := newGenerator(rand.New(rand.NewSource(*randSeed)))
+	if seedManga && *generateManga > 0 {
+		manga = append(manga, generator.manga(*generateManga)...)
+	}
+	if seedUsers && *generateUsers > 0 {
+		generated, err := generator.users(*generateUsers)
+		if err != nil {
+			fail(err)
+		}
+		users = append(users, generated...)
+	}
+
+	databases.InitMongo()
+	databases.InitNeo4j()
+	defer databases.CloseNeo4j(context.Background())
+
+	ctx := context.Background()
+	s := newSeeder(ctx)
+
+	if *reset {
+		if err := s.reset(ctx, seedManga, seedUsers); err != nil {
+			fail(err)
+		}
+		fmt.Println("reset existing data")
+	}
+
+	if seedManga {
+		count, err := s.seedManga(ctx, manga)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("seeded %d manga\n", count)
+	}
+	if seedUsers {
+		count, err := s.seedUsers(ctx, users)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("seeded %d users\n", count)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "seed failed:", err)
+	os.Exit(1)
+}
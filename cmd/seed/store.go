@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"manga_store/internal/databases"
+	"manga_store/internal/models"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const batchSize = 500
+
+type seeder struct {
+	manga  *mongo.Collection
+	users  *mongo.Collection
+	orders *mongo.Collection
+	outbox *mongo.Collection
+	graph  databases.Graph
+}
+
+func newSeeder(ctx context.Context) seeder {
+	return seeder{
+		manga:  databases.Manga(),
+		users:  databases.Users(),
+		orders: databases.Orders(),
+		outbox: databases.Outbox(),
+		graph:  databases.Neo4j(),
+	}
+}
+
+// reset removes the seeded kinds from both stores. Pending graph events
+// touching a removed kind are dropped too, or the relay would recreate the
+// deleted nodes. Orders go with the users they belong to and with the manga
+// they contain. When only manga are reset, the users stay but lose the
+// ratings and purchases that pointed at them.
+func (s seeder) reset(ctx context.Context, manga, users bool) error {
+	var kinds []string
+	if manga {
+		kinds = append(kinds, "manga")
+	}
+	if users {
+		kinds = append(kinds, "user")
+	}
+	if _, err := s.outbox.DeleteMany(ctx, bson.M{"keys": bson.M{"$regex": "^(" + strings.Join(kinds, "|") + "):"}}); err != nil {
+		return err
+	}
+
+	if _, err := s.orders.DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+
+	if manga {
+		if _, err := s.manga.DeleteMany(ctx, bson.M{}); err != nil {
+			return err
+		}
+		if err := s.writeGraph(ctx, `MATCH (m:Manga) DETACH DELETE m`, nil); err != nil {
+			return err
+		}
+		if !users {
+			_, err := s.users.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{
+				"ratings":         []models.Rating{},
+				"purchaseHistory": []models.Purchase{},
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if users {
+		if _, err := s.users.DeleteMany(ctx, bson.M{}); err != nil {
+			return err
+		}
+		if err := s.writeGraph(ctx, `MATCH (u:User) DETACH DELETE u`, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedManga upserts manga by title. Catalog fields are overwritten; stock,
+// sales, views and ratings are only set on insert so reseeding a live
+// database does not wipe them.
+func (s seeder) seedManga(ctx context.Context, manga []models.Manga) (int, error) {
+	for start := 0; start < len(manga); start += batchSize {
+		batch := manga[start:min(start+batchSize, len(manga))]
+
+		writes := make([]mongo.WriteModel, 0, len(batch))
+		titles := make([]string, 0, len(batch))
+		for _, m := range batch {
+			titles = append(titles, m.Title)
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"title": m.Title}).
+				SetUpdate(bson.M{
+					"$set": bson.M{
+						"imageUrl":    m.ImageURL,
+						"author":      m.Author,
+						"genres":      m.Genres,
+						"price":       m.Price,
+						"description": m.Description,
+					},
+					"$setOnInsert": bson.M{
+						"ratedTimes": m.RatedTimes,
+						"rating":     m.Rating,
+						"views":      m.Views,
+						"isDeleted":  m.IsDeleted,
+						"createdAt":  m.CreatedAt,
+						"quantity":   m.Quantity,
+						"sold":       m.Sold,
+						"version":    0,
+					},
+				}).
+				SetUpsert(true))
+		}
+
+		if _, err := s.manga.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, err
+		}
+
+		var saved []models.Manga
+		if err := s.findAll(ctx, s.manga, bson.M{"title": bson.M{"$in": titles}, "isDeleted": false}, &saved); err != nil {
+			return 0, err
+		}
+
+		rows := make([]map[string]interface{}, 0, len(saved))
+		for _, m := range saved {
+			rows = append(rows, map[string]interface{}{"id": m.ID, "title": m.Title, "genres": m.Genres})
+		}
+		err := s.writeGraph(ctx, `
+			UNWIND $rows AS row
+			MERGE (m:Manga {id: row.id})
+			SET m.title = row.title, m.genres = row.genres
+		`, rows)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(manga), nil
+}
+
+// seedUsers upserts users by email. Password hashes are only set on insert so
+// a password changed since the last seed keeps working.
+func (s seeder) seedUsers(ctx context.Context, users []models.User) (int, error) {
+	for start := 0; start < len(users); start += batchSize {
+		batch := users[start:min(start+batchSize, len(users))]
+
+		writes := make([]mongo.WriteModel, 0, len(batch))
+		emails := make([]string, 0, len(batch))
+		for _, u := range batch {
+			emails = append(emails, u.Email)
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"email": u.Email}).
+				SetUpdate(bson.M{
+					"$set": bson.M{
+						"name":    u.Name,
+						"isAdmin": u.IsAdmin,
+					},
+					"$setOnInsert": bson.M{
+						"passwordHash":    u.PasswordHash,
+						"purchaseHistory": []models.Purchase{},
+						"ratings":         []models.Rating{},
+						"isDeleted":       u.IsDeleted,
+						"emailVerified":   true,
+					},
+				}).
+				SetUpsert(true))
+		}
+
+		if _, err := s.users.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, err
+		}
+
+		var saved []models.User
+		if err := s.findAll(ctx, s.users, bson.M{"email": bson.M{"$in": emails}, "isDeleted": false}, &saved); err != nil {
+			return 0, err
+		}
+
+		rows := make([]map[string]interface{}, 0, len(saved))
+		for _, u := range saved {
+			rows = append(rows, map[string]interface{}{"id": u.ID, "email": u.Email})
+		}
+		err := s.writeGraph(ctx, `
+			UNWIND $rows AS row
+			MERGE (u:User {id: row.id})
+			SET u.email = row.email
+		`, rows)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(users), nil
+}
+
+func (s seeder) findAll(ctx context.Context, coll *mongo.Collection, filter bson.M, results interface{}) error {
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+func (s seeder) writeGraph(ctx context.Context, query string, rows []map[string]interface{}) error {
+	_, err := s.graph.Write(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		_, err := tx.Run(ctx, query, map[string]interface{}{"rows": rows})
+		return nil, err
+	})
+	return err
+}
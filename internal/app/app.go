@@ -0,0 +1,107 @@
+// Package app builds the HTTP API. Its storage, mailer and settings are
+// passed in, so the same app serves production over MongoDB, Neo4j and
+// Redis and runs inside tests over the memory stores.
+package app
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/mailer"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/repositories"
+	"manga_store/internal/routers"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+type Config struct {
+	// AllowOrigins lists the web clients allowed to call the API with
+	// credentials, as fiber's CORS middleware takes them.
+	AllowOrigins string
+	// RequestTimeout cancels the database calls of a request that runs
+	// longer than this. Zero leaves requests without a deadline of their
+	// own; each service call still has its TIMEOUT_<OPERATION>.
+	RequestTimeout time.Duration
+	// Context ends the database calls of every request still running when
+	// it is cancelled. Nil means context.Background().
+	Context context.Context
+}
+
+// DefaultConfig reads the config from the environment.
+func DefaultConfig() Config {
+	return Config{
+		AllowOrigins:   "http://localhost:" + helpers.GetEnv("CLIENT_PORT", "5173"),
+		RequestTimeout: helpers.GetEnvDuration("TIMEOUT_REQUEST", 30*time.Second),
+	}
+}
+
+// New returns the API over stores, sending account emails through mail.
+// Background work on the stores, such as relaying graph events or loading
+// catalog search, is left to the caller.
+func New(stores repositories.Stores, mail mailer.Mailer, config Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+
+	base := config.Context
+	if base == nil {
+		base = context.Background()
+	}
+	app.Use(middlewares.RequestContext(base, config.RequestTimeout))
+
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:     config.AllowOrigins,
+		AllowCredentials: true,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+	}))
+
+	app.Use(middlewares.RateLimit(stores.Cache, "global"))
+
+	routers.NewAuthRouter(stores, mail).SetupRoutes(app)
+
+	app.Use(middlewares.Authenticate(stores))
+
+	routers.NewMangaRouter(stores).SetupRoutes(app)
+	routers.NewUserRouter(stores).SetupRoutes(app)
+	routers.NewTwoFactorRouter(stores).SetupRoutes(app)
+	routers.NewCartRouter(stores).SetupRoutes(app)
+	routers.NewOrderRouter(stores).SetupRoutes(app)
+
+	return app
+}
+
+// Serve runs api on addr until ctx ends, then stops taking connections and
+// waits up to drain for the requests in flight to finish. It returns early
+// if api cannot listen on addr.
+func Serve(ctx context.Context, api *fiber.App, addr string, drain time.Duration) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- api.Listener(ln)
+	}()
+
+	select {
+	case err := <-listening:
+		return err
+	case <-ctx.Done():
+	}
+
+	err = api.ShutdownWithTimeout(drain)
+	// fasthttp only closes the listeners it has started serving, so one
+	// shut down while it was still starting is closed here.
+	ln.Close()
+	<-listening
+
+	if err != nil {
+		return fmt.Errorf("draining requests: %w", err)
+	}
+	return nil
+}
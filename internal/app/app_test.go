@@ -0,0 +1,734 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"manga_store/internal/mailer"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"manga_store/internal/totp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiSuite is the API over memory stores, with the state the steps of a
+// scenario share: the session cookie and values picked up along the way.
+type apiSuite struct {
+	app interface {
+		Test(req *http.Request, msTimeout ...int) (*http.Response, error)
+	}
+	stores repositories.Stores
+	mail   *mailer.MemoryMailer
+	cookie *http.Cookie
+	vars   map[string]string
+}
+
+// apiStep is one request of a scenario. Path and body may refer to vars
+// as {name}. Anonymous steps are sent without the session and leave it be.
+type apiStep struct {
+	name      string
+	method    string
+	path      string
+	body      string
+	anonymous bool
+	status    int
+	check     func(t *testing.T, s *apiSuite, body []byte)
+}
+
+var catalog = []models.Manga{
+	{Title: "Berserk", Author: "Kentaro Miura", Genres: []string{"dark fantasy", "action"}, Price: 14.99, Quantity: 5, Sold: 20},
+	{Title: "Claymore", Author: "Norihiro Yagi", Genres: []string{"dark fantasy", "action"}, Price: 9.99, Quantity: 5, Sold: 10},
+	{Title: "Vinland Saga", Author: "Makoto Yukimura", Genres: []string{"action", "history"}, Price: 12.99, Quantity: 5, Sold: 30},
+	{Title: "Yotsuba&!", Author: "Kiyohiko Azuma", Genres: []string{"comedy"}, Price: 7.99, Quantity: 5, Sold: 50},
+	{Title: "Pluto", Author: "Naoki Urasawa", Genres: []string{"mystery"}, Price: 11.99, Quantity: 0, Sold: 5},
+}
+
+func newAPISuite(t *testing.T) *apiSuite {
+	t.Helper()
+	ctx := context.Background()
+
+	stores := repositories.NewMemoryStores()
+	mail := mailer.NewMemoryMailer()
+	s := &apiSuite{
+		app:    New(stores, mail, Config{AllowOrigins: "http://localhost:5173"}),
+		stores: stores,
+		mail:   mail,
+		vars:   map[string]string{},
+	}
+
+	for _, manga := range catalog {
+		created, err := stores.Manga.Create(ctx, manga)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stores.Outbox.Record(ctx, models.GraphEventMangaUpserted, models.GraphEventPayload{
+			Manga: []models.GraphManga{{ID: created.ID, Title: created.Title, Genres: created.Genres}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.vars[strings.ToLower(strings.Fields(created.Title)[0])] = created.ID
+	}
+	if err := services.NewCatalogSearch(stores).Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob rated Berserk highly like the scenario's user will, and Vinland
+	// Saga above Claymore.
+	bob, err := stores.Users.Create(ctx, models.User{Email: "bob@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for title, score := range map[string]float64{"berserk": 4.5, "vinland": 5, "claymore": 4} {
+		err := stores.Outbox.Record(ctx, models.GraphEventMangaRated, models.GraphEventPayload{
+			UserID: bob.ID,
+			Manga:  []models.GraphManga{{ID: s.vars[title]}},
+			Score:  score,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+func (s *apiSuite) expand(text string) string {
+	for name, value := range s.vars {
+		text = strings.ReplaceAll(text, "{"+name+"}", value)
+	}
+	return text
+}
+
+func (s *apiSuite) run(t *testing.T, step apiStep) {
+	t.Helper()
+
+	var body io.Reader
+	if step.body != "" {
+		body = bytes.NewBufferString(s.expand(step.body))
+	}
+	req := httptest.NewRequest(step.method, s.expand(step.path), body)
+	req.Header.Set("Content-Type", "application/json")
+	if s.cookie != nil && !step.anonymous {
+		req.AddCookie(s.cookie)
+	}
+
+	res, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "session" && !step.anonymous {
+			s.cookie = cookie
+		}
+	}
+
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != step.status {
+		t.Fatalf("%s %s = %d %s, want %d", step.method, step.path, res.StatusCode, got, step.status)
+	}
+	if step.check != nil {
+		step.check(t, s, got)
+	}
+}
+
+func decode[T any](t *testing.T, body []byte) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return v
+}
+
+func titles(manga []models.Manga) []string {
+	titles := make([]string, 0, len(manga))
+	for _, m := range manga {
+		titles = append(titles, m.Title)
+	}
+	return titles
+}
+
+func expectTitles(t *testing.T, s *apiSuite, body []byte, want ...string) {
+	t.Helper()
+
+	page := decode[pagination.Page[models.Manga]](t, body)
+	if got := titles(page.Items); !slices.Equal(got, want) {
+		t.Errorf("titles = %v, want %v", got, want)
+	}
+}
+
+func (s *apiSuite) user(t *testing.T) *models.User {
+	t.Helper()
+
+	user, err := s.stores.Users.GetActiveByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (s *apiSuite) manga(t *testing.T, name string) *models.Manga {
+	t.Helper()
+
+	manga, err := s.stores.Manga.Get(context.Background(), s.vars[name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manga
+}
+
+func (s *apiSuite) graph() *repositories.MemoryGraphStore {
+	return s.stores.Graph.(*repositories.MemoryGraphStore)
+}
+
+// TestAPI walks a customer through the store: signing up, finding a manga,
+// buying and rating it, and the recommendations that follow. Steps run in
+// order and share the session.
+func TestAPI(t *testing.T) {
+	s := newAPISuite(t)
+
+	steps := []apiStep{
+		{
+			name:   "register",
+			method: http.MethodPost,
+			path:   "/auth/register",
+			body:   `{"email": "alice@example.com", "password": "correct horse"}`,
+			status: http.StatusCreated,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				sent := s.mail.Sent()
+				if len(sent) != 1 || sent[0].To != "alice@example.com" {
+					t.Fatalf("sent %+v, want one email to alice@example.com", sent)
+				}
+				_, link, ok := strings.Cut(sent[0].Body, "token=")
+				if !ok {
+					t.Fatalf("no verification link in %q", sent[0].Body)
+				}
+				token, err := url.QueryUnescape(strings.Fields(link)[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.vars["token"] = url.QueryEscape(token)
+
+				if user := s.user(t); user.EmailVerified {
+					t.Error("email verified before the link was followed")
+				}
+			},
+		},
+		{
+			name:   "register twice",
+			method: http.MethodPost,
+			path:   "/auth/register",
+			body:   `{"email": "alice@example.com", "password": "another one"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "login before verifying",
+			method: http.MethodPost,
+			path:   "/auth/login",
+			body:   `{"email": "alice@example.com", "password": "correct horse"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "verify email",
+			method: http.MethodGet,
+			path:   "/auth/verify?token={token}",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				if user := s.user(t); !user.EmailVerified {
+					t.Error("email not verified")
+				}
+			},
+		},
+		{
+			name:   "login",
+			method: http.MethodPost,
+			path:   "/auth/login",
+			body:   `{"email": "alice@example.com", "password": "correct horse"}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				response := decode[struct {
+					User models.User `json:"user"`
+				}](t, body)
+				if response.User.Email != "alice@example.com" {
+					t.Errorf("logged in as %q, want alice@example.com", response.User.Email)
+				}
+				if s.cookie == nil {
+					t.Fatal("no session cookie set")
+				}
+				s.vars["alice"] = s.user(t).ID
+			},
+		},
+		{
+			name:      "search without a session",
+			method:    http.MethodPost,
+			path:      "/manga/search",
+			body:      `{"query": "berserk"}`,
+			anonymous: true,
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:   "search",
+			method: http.MethodPost,
+			path:   "/manga/search",
+			body:   `{"query": "berserk"}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				response := decode[models.SearchMangaResponse](t, body)
+				if got := titles(response.Items); response.Total != 1 || !slices.Equal(got, []string{"Berserk"}) {
+					t.Errorf("found %v of %d, want just Berserk", got, response.Total)
+				}
+			},
+		},
+		{
+			name:   "search by genre in stock",
+			method: http.MethodPost,
+			path:   "/manga/search",
+			body:   `{"genres": ["action"], "inStock": true, "sort": "price_asc"}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				response := decode[models.SearchMangaResponse](t, body)
+				if got, want := titles(response.Items), []string{"Claymore", "Vinland Saga", "Berserk"}; !slices.Equal(got, want) {
+					t.Errorf("found %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "get manga by id",
+			method: http.MethodGet,
+			path:   "/manga/{berserk}",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				if manga := decode[models.Manga](t, body); manga.Title != "Berserk" {
+					t.Errorf("title = %q, want Berserk", manga.Title)
+				}
+				if views := s.manga(t, "berserk").Views; views != 1 {
+					t.Errorf("views = %d, want 1", views)
+				}
+			},
+		},
+		{
+			name:   "get unknown manga",
+			method: http.MethodGet,
+			path:   "/manga/000000000000000000000000",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "recommendations before rating anything",
+			method: http.MethodGet,
+			path:   "/user/recs/preferences",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				expectTitles(t, s, body, "Yotsuba&!", "Vinland Saga", "Berserk", "Claymore", "Pluto")
+			},
+		},
+		{
+			name:   "purchase",
+			method: http.MethodPost,
+			path:   "/manga/purchase",
+			body:   `{"mangaId": "{berserk}"}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				response := decode[struct {
+					Order models.Order `json:"order"`
+				}](t, body)
+				if response.Order.Total != 14.99 || response.Order.Status != models.OrderStatusPaid {
+					t.Errorf("order = %+v, want a paid order for 14.99", response.Order)
+				}
+
+				manga := s.manga(t, "berserk")
+				if manga.Quantity != 4 || manga.Sold != 21 {
+					t.Errorf("quantity = %d, sold = %d, want 4 and 21", manga.Quantity, manga.Sold)
+				}
+				if !s.graph().Purchased(s.vars["alice"], s.vars["berserk"]) {
+					t.Error("purchase missing from the graph")
+				}
+			},
+		},
+		{
+			name:   "purchase sold out manga",
+			method: http.MethodPost,
+			path:   "/manga/purchase",
+			body:   `{"mangaId": "{pluto}"}`,
+			status: http.StatusConflict,
+		},
+		{
+			name:   "rate out of range",
+			method: http.MethodPost,
+			path:   "/manga/{berserk}/rate",
+			body:   `{"score": 6}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "rate",
+			method: http.MethodPost,
+			path:   "/manga/{berserk}/rate",
+			body:   `{"score": 5}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				ratings := s.user(t).Ratings
+				if len(ratings) != 1 || ratings[0].MangaID != s.vars["berserk"] || ratings[0].Score != 5 {
+					t.Errorf("ratings = %+v, want Berserk at 5", ratings)
+				}
+				if manga := s.manga(t, "berserk"); manga.Rating != 5 || manga.RatedTimes != 1 {
+					t.Errorf("rating = %v over %d, want 5 over 1", manga.Rating, manga.RatedTimes)
+				}
+				if score, ok := s.graph().Rating(s.vars["alice"], s.vars["berserk"]); !ok || score != 5 {
+					t.Errorf("graph rating = %v, %v, want 5", score, ok)
+				}
+			},
+		},
+		{
+			name:   "recommendations by preferences",
+			method: http.MethodGet,
+			path:   "/user/recs/preferences",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				expectTitles(t, s, body, "Claymore", "Vinland Saga")
+			},
+		},
+		{
+			name:   "recommendations by similar users",
+			method: http.MethodGet,
+			path:   "/user/recs/similar_users",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				expectTitles(t, s, body, "Vinland Saga", "Claymore")
+			},
+		},
+		{
+			name:   "remove rating",
+			method: http.MethodDelete,
+			path:   "/manga/{berserk}/rate",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				if ratings := s.user(t).Ratings; len(ratings) != 0 {
+					t.Errorf("ratings = %+v, want none", ratings)
+				}
+				if manga := s.manga(t, "berserk"); manga.Rating != 0 || manga.RatedTimes != 0 {
+					t.Errorf("rating = %v over %d, want 0 over 0", manga.Rating, manga.RatedTimes)
+				}
+				if _, ok := s.graph().Rating(s.vars["alice"], s.vars["berserk"]); ok {
+					t.Error("rating still in the graph")
+				}
+			},
+		},
+		{
+			name:   "remove rating again",
+			method: http.MethodDelete,
+			path:   "/manga/{berserk}/rate",
+			status: http.StatusOK,
+		},
+		{
+			name:   "recommendations by similar users after removing the rating",
+			method: http.MethodGet,
+			path:   "/user/recs/similar_users",
+			status: http.StatusOK,
+			check: func(t *testing.T, s *apiSuite, body []byte) {
+				expectTitles(t, s, body, "Yotsuba&!", "Vinland Saga", "Berserk", "Claymore", "Pluto")
+			},
+		},
+		{
+			name:   "login with the wrong password",
+			method: http.MethodPost,
+			path:   "/auth/login",
+			body:   `{"email": "alice@example.com", "password": "wrong horse"}`,
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, func(t *testing.T) { s.run(t, step) }) {
+			t.FailNow()
+		}
+	}
+}
+
+// TestTwoFactorFailuresCountTowardsLockout checks that guessing the second
+// factor is throttled like guessing the password, and that a correct
+// password alone does not clear the count.
+// addTwoFactorUser adds carol@example.com, whose password is "correct
+// horse", with two-factor authentication enabled. It sets the vars code to
+// her current TOTP code and wrong to a code that is not.
+func (s *apiSuite) addTwoFactorUser(t *testing.T) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.stores.Users.Create(context.Background(), models.User{
+		Email:         "carol@example.com",
+		PasswordHash:  string(hash),
+		EmailVerified: true,
+		TwoFactor:     &models.TwoFactor{Secret: secret, Enabled: true, RecoveryCodes: []string{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.vars["wrong"] = fmt.Sprintf("%06d", (mustAtoi(t, code)+500000)%1000000)
+	s.vars["code"] = code
+}
+
+// twoFactorPassword is the first login step for the user addTwoFactorUser
+// adds. It keeps the challenge as the var challenge.
+var twoFactorPassword = apiStep{
+	name:   "password",
+	method: http.MethodPost,
+	path:   "/auth/login",
+	body:   `{"email": "carol@example.com", "password": "correct horse"}`,
+	status: http.StatusAccepted,
+	check: func(t *testing.T, s *apiSuite, body []byte) {
+		s.vars["challenge"] = decode[struct {
+			Challenge models.LoginChallenge `json:"challenge"`
+		}](t, body).Challenge.ChallengeID
+	},
+}
+
+func throttled(t *testing.T, s *apiSuite, body []byte) {
+	if !strings.Contains(string(body), services.ErrLoginThrottled.Error()) {
+		t.Errorf("body = %s, want %q", body, services.ErrLoginThrottled)
+	}
+}
+
+func TestTwoFactorFailuresCountTowardsLockout(t *testing.T) {
+	s := newAPISuite(t)
+	s.addTwoFactorUser(t)
+
+	steps := []apiStep{
+		twoFactorPassword,
+		{
+			name:   "wrong code",
+			method: http.MethodPost,
+			path:   "/auth/login/verify",
+			body:   `{"challengeId": "{challenge}", "code": "{wrong}"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "right code while blocked",
+			method: http.MethodPost,
+			path:   "/auth/login/verify",
+			body:   `{"challengeId": "{challenge}", "code": "{code}"}`,
+			status: http.StatusTooManyRequests,
+			check:  throttled,
+		},
+		{
+			name:   "password while blocked",
+			method: http.MethodPost,
+			path:   "/auth/login",
+			body:   `{"email": "carol@example.com", "password": "correct horse"}`,
+			status: http.StatusTooManyRequests,
+			check:  throttled,
+		},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, func(t *testing.T) { s.run(t, step) }) {
+			t.FailNow()
+		}
+	}
+}
+
+// TestTwoFactorChangesCountTowardsLockout checks that the codes confirming
+// changes to two-factor settings cannot be guessed past the login lockout.
+func TestTwoFactorChangesCountTowardsLockout(t *testing.T) {
+	s := newAPISuite(t)
+	s.addTwoFactorUser(t)
+
+	steps := []apiStep{
+		twoFactorPassword,
+		{
+			name:   "code",
+			method: http.MethodPost,
+			path:   "/auth/login/verify",
+			body:   `{"challengeId": "{challenge}", "code": "{code}"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "wrong code for new recovery codes",
+			method: http.MethodPost,
+			path:   "/user/2fa/recovery-codes",
+			body:   `{"code": "{wrong}"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "disable while blocked",
+			method: http.MethodPost,
+			path:   "/user/2fa/disable",
+			body:   `{"code": "{wrong}"}`,
+			status: http.StatusTooManyRequests,
+			check:  throttled,
+		},
+		{
+			name:   "password while blocked",
+			method: http.MethodPost,
+			path:   "/auth/login",
+			body:   `{"email": "carol@example.com", "password": "correct horse"}`,
+			status: http.StatusTooManyRequests,
+			check:  throttled,
+		},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, func(t *testing.T) { s.run(t, step) }) {
+			t.FailNow()
+		}
+	}
+}
+
+func mustAtoi(t *testing.T, text string) int {
+	t.Helper()
+
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+	api := fiber.New(fiber.Config{DisableStartupMessage: true})
+	started := make(chan struct{})
+	api.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.SendString("done")
+	})
+
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, api, addr, 5*time.Second) }()
+
+	responses := make(chan string, 1)
+	go func() {
+		for {
+			res, err := http.Get("http://" + addr + "/slow")
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			responses <- string(body)
+			return
+		}
+	}()
+
+	<-started
+	cancel()
+
+	if body := <-responses; body != "done" {
+		t.Errorf("request in flight got %q, want it to finish", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
+
+func TestServeStopsWhenCancelledWhileStarting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	addr := freeAddr(t)
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, fiber.New(fiber.Config{DisableStartupMessage: true}), addr, time.Second)
+	}()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve kept running after its context ended")
+	}
+}
+
+func TestRequestIsCancelledWhenTheClientDisconnects(t *testing.T) {
+	api := fiber.New(fiber.Config{DisableStartupMessage: true})
+	api.Use(middlewares.RequestContext(context.Background(), time.Minute))
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	api.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		select {
+		case <-c.UserContext().Done():
+			cancelled <- c.UserContext().Err()
+		case <-time.After(10 * time.Second):
+			cancelled <- nil
+		}
+		return nil
+	})
+
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Serve(ctx, api, addr, time.Second)
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var err error
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+	conn.Close()
+
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("handler context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
@@ -49,4 +49,29 @@ func Manga() *mongo.Collection {
 
 func Activities() *mongo.Collection {
 	return client.Database("manga_store").Collection("activities")
-}
\ No newline at end of file
+}
+
+func Orders() *mongo.Collection {
+	return client.Database("manga_store").Collection("orders")
+}
+
+func Outbox() *mongo.Collection {
+	return client.Database("manga_store").Collection("outbox")
+}
+
+func Database() *mongo.Database {
+	return client.Database("manga_store")
+}
+
+func AuditLog() *mongo.Collection {
+	return client.Database("manga_store").Collection("audit_log")
+}
+
+// CloseMongo disconnects the client, waiting for operations still running
+// until ctx ends.
+func CloseMongo(ctx context.Context) error {
+	if client == nil {
+		return nil
+	}
+	return client.Disconnect(ctx)
+}
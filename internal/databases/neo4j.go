@@ -2,6 +2,7 @@ package databases
 
 import (
 	"context"
+	"errors"
 	"manga_store/internal/helpers"
 	"manga_store/internal/logger"
 	"time"
@@ -34,12 +35,54 @@ func InitNeo4j() {
 	}
 }
 
-func Neo4j(ctx context.Context) neo4j.SessionWithContext {
-	return neo4jDriver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+// Neo4j returns the graph over the driver InitNeo4j connected.
+func Neo4j() Graph {
+	return NewGraph(neo4jDriver)
 }
 
-func CloseNeo4j(ctx context.Context) {
-	if neo4jDriver != nil {
-		neo4jDriver.Close(ctx)
+var ErrNeo4jUnavailable = errors.New("neo4j is not connected")
+
+// Graph runs units of work against Neo4j. Sessions are not safe for
+// concurrent use, so rather than sharing one, every unit of work opens a
+// session of its own with the caller's context and closes it when the work
+// returns. Read sessions may be routed to a cluster's followers; writes
+// always go to the leader.
+type Graph struct {
+	driver neo4j.DriverWithContext
+}
+
+func NewGraph(driver neo4j.DriverWithContext) Graph {
+	return Graph{driver: driver}
+}
+
+// Read runs work in a read transaction, retried on transient errors.
+func (g Graph) Read(ctx context.Context, work neo4j.ManagedTransactionWork) (interface{}, error) {
+	return g.execute(ctx, neo4j.AccessModeRead, work)
+}
+
+// Write runs work in a write transaction, retried on transient errors.
+func (g Graph) Write(ctx context.Context, work neo4j.ManagedTransactionWork) (interface{}, error) {
+	return g.execute(ctx, neo4j.AccessModeWrite, work)
+}
+
+func (g Graph) execute(ctx context.Context, mode neo4j.AccessMode, work neo4j.ManagedTransactionWork) (interface{}, error) {
+	if g.driver == nil {
+		return nil, ErrNeo4jUnavailable
+	}
+
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: mode})
+	// Close even when ctx is done, so the connection goes back to the pool.
+	defer session.Close(context.WithoutCancel(ctx))
+
+	if mode == neo4j.AccessModeRead {
+		return session.ExecuteRead(ctx, work)
+	}
+	return session.ExecuteWrite(ctx, work)
+}
+
+func CloseNeo4j(ctx context.Context) error {
+	if neo4jDriver == nil {
+		return nil
 	}
+	return neo4jDriver.Close(ctx)
 }
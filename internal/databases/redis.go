@@ -37,5 +37,8 @@ func Redis() *redis.Client {
 }
 
 func CloseRedis() error {
+	if redisClient == nil {
+		return nil
+	}
 	return redisClient.Close()
 }
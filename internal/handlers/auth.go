@@ -1,20 +1,31 @@
 package handlers
 
 import (
-	"manga_store/internal/helpers"
+	"errors"
+	"manga_store/internal/mailer"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
 	"manga_store/internal/services"
-	"time"
+	"math"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type AuthHandler struct {
-	authService services.AuthService
+	authService    services.AuthService
+	sessionService services.SessionService
+	tokenService   services.TokenService
+	lockoutService services.LockoutService
 }
 
-func NewAuthHandler() AuthHandler {
+func NewAuthHandler(stores repositories.Stores, mail mailer.Mailer) AuthHandler {
 	return AuthHandler{
-		authService: services.NewAuthService(),
+		authService:    services.NewAuthService(stores, mail),
+		sessionService: services.NewSessionService(stores),
+		tokenService:   services.NewTokenService(stores),
+		lockoutService: services.NewLockoutService(stores),
 	}
 }
 
@@ -28,12 +39,12 @@ func (h AuthHandler) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	err := h.authService.Register(registerData.Email, registerData.Password)
+	err := h.authService.Register(c.UserContext(), registerData.Email, registerData.Password)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "User registered successfully"})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "User registered successfully, check your email to verify your address"})
 }
 
 func (h AuthHandler) Login(c *fiber.Ctx) error {
@@ -46,52 +57,278 @@ func (h AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	user, err := h.authService.Login(loginData.Email, loginData.Password)
+	user, challenge, err := h.checkPassword(c, loginData.Email, loginData.Password)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password"})
+		return loginError(c, err)
+	}
+	if challenge != nil {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Two-factor code required", "challenge": challenge})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "loggedIn",
-		Value:    "true",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "Strict",
-	})
+	return h.startSession(c, user)
+}
+
+// CompleteLogin finishes a two-factor login started at /auth/login.
+func (h AuthHandler) CompleteLogin(c *fiber.Ctx) error {
+	user, err := h.completeLogin(c)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return h.startSession(c, user)
+}
+
+// checkPassword runs the first login step behind the brute-force guard. Only
+// wrong credentials count as failures, and a correct password only clears
+// them once no second step is left to guess.
+func (h AuthHandler) checkPassword(c *fiber.Ctx, email, password string) (models.User, *models.LoginChallenge, error) {
+	if err := h.lockoutService.Check(c.UserContext(), c.IP(), email); err != nil {
+		return models.User{}, nil, err
+	}
+
+	user, challenge, err := h.authService.Login(c.UserContext(), email, password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		if err := h.lockoutService.RecordFailure(c.UserContext(), c.IP(), email); err != nil {
+			return models.User{}, nil, err
+		}
+	} else if err == nil && challenge == nil {
+		if err := h.lockoutService.RecordSuccess(c.UserContext(), email); err != nil {
+			return models.User{}, nil, err
+		}
+	}
+
+	return user, challenge, err
+}
 
-	encUserId, err := helpers.Encrypt(user.ID)
+func (h AuthHandler) startSession(c *fiber.Ctx, user models.User) error {
+	session, err := h.sessionService.Create(c.UserContext(), user, c.IP(), c.Get(fiber.HeaderUserAgent))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Login failed"})
 	}
+	middlewares.SetSessionCookie(c, session)
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "data",
-		Value:    encUserId,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "Strict",
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":                    "Logged in successfully",
+		"user":                       user,
+		"twoFactorEnrolmentRequired": user.IsStaff() && !user.TwoFactorEnabled(),
 	})
+}
+
+// completeLogin runs the second login step behind the same brute-force guard
+// as the first, counting wrong codes against the user's email.
+func (h AuthHandler) completeLogin(c *fiber.Ctx) (models.User, error) {
+	var request models.CompleteLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return models.User{}, services.ErrInvalidLoginChallenge
+	}
+
+	email, err := h.authService.ChallengeEmail(c.UserContext(), request.ChallengeID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := h.lockoutService.Check(c.UserContext(), c.IP(), email); err != nil {
+		return models.User{}, err
+	}
 
-	if user.IsAdmin {
-		c.Cookie(&fiber.Cookie{
-			Name:     "isAdmin",
-			Value:    "true",
-			Expires:  time.Now().Add(24 * time.Hour),
-			HTTPOnly: true,
-			SameSite: "Strict",
-		})
+	user, err := h.authService.CompleteLogin(c.UserContext(), request.ChallengeID, request.Code)
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		if err := h.lockoutService.RecordFailure(c.UserContext(), c.IP(), email); err != nil {
+			return models.User{}, err
+		}
+	} else if err == nil {
+		if err := h.lockoutService.RecordSuccess(c.UserContext(), email); err != nil {
+			return models.User{}, err
+		}
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged in successfully", "user": user})
+	return user, err
 }
 
 func (h AuthHandler) Logout(c *fiber.Ctx) error {
-	err := h.authService.Logout()
+	err := h.sessionService.Revoke(c.UserContext(), c.Cookies(middlewares.SessionCookie))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
 	}
 
-	c.ClearCookie()
+	middlewares.ClearSessionCookie(c)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged out successfully"})
 }
+
+// LogoutEverywhere ends every session and token login of the caller, on all
+// devices.
+func (h AuthHandler) LogoutEverywhere(c *fiber.Ctx) error {
+	user := middlewares.CurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if err := h.sessionService.RevokeAll(c.UserContext(), user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
+	}
+	if err := h.tokenService.RevokeAll(c.UserContext(), user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
+	}
+
+	middlewares.ClearSessionCookie(c)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged out of all sessions"})
+}
+
+// Token logs in an API client and returns a bearer access token together
+// with a refresh token.
+func (h AuthHandler) Token(c *fiber.Ctx) error {
+	var loginData struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BodyParser(&loginData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	user, challenge, err := h.checkPassword(c, loginData.Email, loginData.Password)
+	if err != nil {
+		return loginError(c, err)
+	}
+	if challenge != nil {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Two-factor code required", "challenge": challenge})
+	}
+
+	return h.issueTokens(c, user)
+}
+
+// CompleteToken finishes a two-factor login started at /auth/token.
+func (h AuthHandler) CompleteToken(c *fiber.Ctx) error {
+	user, err := h.completeLogin(c)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return h.issueTokens(c, user)
+}
+
+func (h AuthHandler) issueTokens(c *fiber.Ctx, user models.User) error {
+	tokens, err := h.tokenService.Issue(c.UserContext(), user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Login failed"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+func (h AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	var request models.RefreshTokenRequest
+	if err := c.BodyParser(&request); err != nil || request.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	tokens, err := h.tokenService.Refresh(c.UserContext(), request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh token"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+func (h AuthHandler) RevokeToken(c *fiber.Ctx) error {
+	var request models.RefreshTokenRequest
+	if err := c.BodyParser(&request); err != nil || request.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	err := h.tokenService.Revoke(c.UserContext(), request.RefreshToken)
+	if err != nil && !errors.Is(err, services.ErrInvalidToken) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke token"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Token revoked"})
+}
+
+func (h AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	err := h.authService.VerifyEmail(c.UserContext(), c.Query("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuthToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Email verified, you can now log in"})
+}
+
+func (h AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&request); err != nil || request.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if err := h.authService.ResendVerification(c.UserContext(), request.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send verification email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If the account exists and is unverified, a new link has been sent"})
+}
+
+func (h AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&request); err != nil || request.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if err := h.authService.ForgotPassword(c.UserContext(), request.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send reset email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If the account exists, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password and ends every existing login of the
+// user, since whoever held the old password may still be signed in.
+func (h AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	userId, err := h.authService.ResetPassword(c.UserContext(), request.Token, request.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuthToken) || errors.Is(err, services.ErrWeakPassword) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+
+	if err := h.sessionService.RevokeAll(c.UserContext(), userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Password reset, but failed to end existing sessions"})
+	}
+	if err := h.tokenService.RevokeAll(c.UserContext(), userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Password reset, but failed to end existing sessions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password has been reset, log in with your new password"})
+}
+
+func loginError(c *fiber.Ctx, err error) error {
+	var lockout *services.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password"})
+	case errors.Is(err, services.ErrEmailNotVerified):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Login failed"})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CartHandler struct {
+	cartService services.CartService
+}
+
+func NewCartHandler(stores repositories.Stores) CartHandler {
+	return CartHandler{
+		cartService: services.NewCartService(stores),
+	}
+}
+
+func (h CartHandler) GetCart(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	cart, err := h.cartService.GetCart(c.UserContext(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve cart"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(cart)
+}
+
+func (h CartHandler) AddItem(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	var request models.CartItemRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+
+	mangaId, err := primitive.ObjectIDFromHex(request.MangaID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga id"})
+	}
+
+	err = h.cartService.AddItem(c.UserContext(), userId, mangaId, request.Quantity)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Item added to cart"})
+}
+
+func (h CartHandler) UpdateItem(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	mangaId, err := primitive.ObjectIDFromHex(c.Params("mangaId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga id"})
+	}
+
+	var request models.CartItemRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	err = h.cartService.UpdateItem(c.UserContext(), userId, mangaId, request.Quantity)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Cart updated"})
+}
+
+func (h CartHandler) RemoveItem(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	mangaId, err := primitive.ObjectIDFromHex(c.Params("mangaId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga id"})
+	}
+
+	err = h.cartService.RemoveItem(c.UserContext(), userId, mangaId)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Item removed from cart"})
+}
+
+func (h CartHandler) ClearCart(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	err = h.cartService.ClearCart(c.UserContext(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear cart"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Cart cleared"})
+}
+
+func (h CartHandler) Checkout(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	order, err := h.cartService.Checkout(c.UserContext(), userId)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Purchase successful", "order": order})
+}
+
+func cartError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrMangaNotFound), errors.Is(err, services.ErrCartItemNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidQuantity), errors.Is(err, services.ErrCartEmpty):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientStock):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"manga_store/internal/helpers"
+	"errors"
 	"manga_store/internal/models"
+	"manga_store/internal/repositories"
 	"manga_store/internal/services"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,9 +14,9 @@ type MangaHandler struct {
 	mangaService services.MangaService
 }
 
-func NewMangaHandler() MangaHandler {
+func NewMangaHandler(stores repositories.Stores) MangaHandler {
 	return MangaHandler{
-		mangaService: services.NewMangaService(),
+		mangaService: services.NewMangaService(stores),
 	}
 }
 
@@ -33,7 +34,7 @@ func (h MangaHandler) CreateManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	err := h.mangaService.CreateManga(mangaData.Title, mangaData.Author, mangaData.Description, mangaData.Price, mangaData.Quantity, mangaData.Genres)
+	err := h.mangaService.CreateManga(c.UserContext(), mangaData.Title, mangaData.Author, mangaData.Description, mangaData.Price, mangaData.Quantity, mangaData.Genres)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -41,13 +42,48 @@ func (h MangaHandler) CreateManga(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Manga created successfully"})
 }
 
-func (h MangaHandler) GetNewestManga(c *fiber.Ctx) error {
-	mangas, err := h.mangaService.GetNewestManga(10)
+func (h MangaHandler) UpdateManga(c *fiber.Ctx) error {
+	mangaId, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Manga ID is invalid"})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(mangas)
+	var request models.UpdateMangaRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	manga, err := h.mangaService.UpdateManga(c.UserContext(), mangaId, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMangaUpdate):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrMangaNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrMangaVersionConflict):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update manga"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(manga)
+}
+
+func (h MangaHandler) ListManga(c *fiber.Ctx) error {
+	params, err := pageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := h.mangaService.ListManga(c.UserContext(), params)
+	if err != nil {
+		if isPageError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve manga"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(page)
 }
 
 func (h MangaHandler) SearchManga(c *fiber.Ctx) error {
@@ -58,19 +94,36 @@ func (h MangaHandler) SearchManga(c *fiber.Ctx) error {
 		})
 	}
 
-	limit := request.Limit
-	if limit <= 0 {
-		limit = 10
+	if (request.MinPrice != nil && *request.MinPrice < 0) || (request.MaxPrice != nil && *request.MaxPrice < 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Prices cannot be negative"})
+	}
+	if request.MinPrice != nil && request.MaxPrice != nil && *request.MinPrice > *request.MaxPrice {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "minPrice cannot be above maxPrice"})
+	}
+	if request.MinRating != nil && (*request.MinRating < 0 || *request.MinRating > 5) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "minRating must be between 0 and 5"})
 	}
 
-	mangas, err := h.mangaService.SearchManga(request.Query, request.Genres, request.Author, limit)
+	response, err := h.mangaService.SearchManga(c.UserContext(), request)
 	if err != nil {
+		if isPageError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve manga",
 		})
 	}
 
-	return c.JSON(mangas)
+	return c.JSON(response)
+}
+
+func (h MangaHandler) SuggestManga(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 8)
+	if limit <= 0 || limit > 20 {
+		limit = 8
+	}
+
+	return c.JSON(h.mangaService.Suggest(c.Query("q"), limit))
 }
 
 func (h MangaHandler) GetMangaByID(c *fiber.Ctx) error {
@@ -81,13 +134,12 @@ func (h MangaHandler) GetMangaByID(c *fiber.Ctx) error {
 		})
 	}
 
-	encUserId := c.Cookies("data")
-	decUserId, err := helpers.Decrypt(encUserId)
+	userId, err := currentUserID(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
 
-	manga, err := h.mangaService.GetMangaByID(id, decUserId)
+	manga, err := h.mangaService.GetMangaByID(c.UserContext(), id, userId.Hex())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve manga",
@@ -118,8 +170,11 @@ func (h MangaHandler) DeleteManga(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.mangaService.DeleteManga(mongoId)
+	err = h.mangaService.DeleteManga(c.UserContext(), mongoId)
 	if err != nil {
+		if errors.Is(err, services.ErrMangaNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete manga",
 		})
@@ -130,37 +185,63 @@ func (h MangaHandler) DeleteManga(c *fiber.Ctx) error {
 	})
 }
 
+func (h MangaHandler) RestoreManga(c *fiber.Ctx) error {
+	mangaId, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Manga ID is invalid"})
+	}
+
+	manga, err := h.mangaService.RestoreManga(c.UserContext(), mangaId)
+	if err != nil {
+		if errors.Is(err, services.ErrMangaNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga is not in the trash"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore manga"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(manga)
+}
+
+func (h MangaHandler) GetTrash(c *fiber.Ctx) error {
+	mangas, err := h.mangaService.ListTrash(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list deleted manga"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(mangas)
+}
+
 func (h MangaHandler) PurchaseManga(c *fiber.Ctx) error {
 	var request models.PurchaseRequest
 	if err := c.BodyParser(&request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	encUserId := c.Cookies("data")
-	decUserId, err := helpers.Decrypt(encUserId)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
-	}
-
-	userId, err := primitive.ObjectIDFromHex(decUserId)
+	userId, err := currentUserID(c)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user id"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
 	mangaId, err := primitive.ObjectIDFromHex(request.MangaID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga id"})
 	}
 
-	err = h.mangaService.PurchaseManga(userId, mangaId)
+	order, err := h.mangaService.PurchaseManga(c.UserContext(), userId, mangaId)
 	if err != nil {
+		if errors.Is(err, services.ErrMangaNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrInsufficientStock) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Purchase successful"})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Purchase successful", "order": order})
 }
 
 func (h MangaHandler) GetPopularManga(c *fiber.Ctx) error {
-	mangas, err := h.mangaService.GetPopularManga()
+	mangas, err := h.mangaService.GetPopularManga(c.UserContext())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get popular manga"})
 	}
@@ -168,15 +249,10 @@ func (h MangaHandler) GetPopularManga(c *fiber.Ctx) error {
 }
 
 func (h MangaHandler) RateManga(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	decUserId, err := helpers.Decrypt(encUserId)
+	userObjectId, err := currentUserID(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
-	userObjectId, err := primitive.ObjectIDFromHex(decUserId)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Auth credentials are invalid. Try logging in again"})
-	}
 
 	mangaId := c.Params("id")
 	if mangaId == "" {
@@ -198,8 +274,11 @@ func (h MangaHandler) RateManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Score must be between 0 and 5"})
 	}
 
-	err = h.mangaService.RateManga(userObjectId, mangaObjectId, request.Score)
+	err = h.mangaService.RateManga(c.UserContext(), userObjectId, mangaObjectId, request.Score)
 	if err != nil {
+		if errors.Is(err, services.ErrMangaNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rate manga"})
 	}
 
@@ -207,15 +286,10 @@ func (h MangaHandler) RateManga(c *fiber.Ctx) error {
 }
 
 func (h MangaHandler) RemoveMangaRating(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	decUserId, err := helpers.Decrypt(encUserId)
+	userObjectId, err := currentUserID(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
-	userObjectId, err := primitive.ObjectIDFromHex(decUserId)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Auth credentials are invalid. Try logging in again"})
-	}
 
 	mangaId := c.Params("id")
 	if mangaId == "" {
@@ -226,7 +300,7 @@ func (h MangaHandler) RemoveMangaRating(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Manga ID is invalid"})
 	}
 
-	err = h.mangaService.RemoveMangaRating(userObjectId, mangaObjectId)
+	err = h.mangaService.RemoveMangaRating(c.UserContext(), userObjectId, mangaObjectId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove manga rating"})
 	}
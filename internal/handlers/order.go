@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderHandler struct {
+	orderService services.OrderService
+	userService  services.UserService
+}
+
+func NewOrderHandler(stores repositories.Stores) OrderHandler {
+	return OrderHandler{
+		orderService: services.NewOrderService(stores),
+		userService:  services.NewUserService(stores),
+	}
+}
+
+func (h OrderHandler) GetOrders(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	params, err := pageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := h.orderService.GetUserOrders(c.UserContext(), userId, params)
+	if err != nil {
+		if isPageError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve orders"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(page)
+}
+
+func (h OrderHandler) GetOrder(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	orderId, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order ID is invalid"})
+	}
+
+	order, err := h.orderService.GetOrder(c.UserContext(), orderId)
+	if err != nil {
+		return orderError(c, err)
+	}
+
+	if order.UserID != userId.Hex() && !h.isOrderManager(c.UserContext(), userId) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": services.ErrOrderNotFound.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+func (h OrderHandler) CancelOrder(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	orderId, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order ID is invalid"})
+	}
+
+	order, err := h.orderService.CancelOrder(c.UserContext(), userId, orderId)
+	if err != nil {
+		return orderError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+func (h OrderHandler) ListOrders(c *fiber.Ctx) error {
+	params, err := pageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := h.orderService.ListOrders(c.UserContext(), models.OrderStatus(c.Query("status")), c.Query("userId"), params)
+	if err != nil {
+		return orderError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(page)
+}
+
+func (h OrderHandler) UpdateOrderStatus(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	orderId, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order ID is invalid"})
+	}
+
+	var request models.UpdateOrderStatusRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	order, err := h.orderService.UpdateStatus(c.UserContext(), orderId, request.Status, userId, request.Note)
+	if err != nil {
+		return orderError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+func (h OrderHandler) isOrderManager(ctx context.Context, userId primitive.ObjectID) bool {
+	user, err := h.userService.GetActiveUser(ctx, userId)
+	return err == nil && user.HasRole(models.RoleOrderManager)
+}
+
+func orderError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidOrderStatus), isPageError(err):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidOrderTransition):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process order"})
+}
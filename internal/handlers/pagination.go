@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"errors"
+	"manga_store/internal/pagination"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pageParams reads the limit, cursor and sort query parameters of a list
+// endpoint.
+func pageParams(c *fiber.Ctx) (pagination.Params, error) {
+	var params pagination.Params
+	if err := c.QueryParser(&params); err != nil {
+		return params, errors.New("limit must be a number")
+	}
+	return params, nil
+}
+
+// isPageError reports whether err is a bad cursor or sort sent by the client.
+func isPageError(err error) bool {
+	return errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, pagination.ErrInvalidSort)
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"errors"
+	"manga_store/internal/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errNotAuthenticated = errors.New("request has no authenticated user")
+
+// currentUserID returns the ID of the user middlewares.Authenticate placed in
+// the request context.
+func currentUserID(c *fiber.Ctx) (primitive.ObjectID, error) {
+	user := middlewares.CurrentUser(c)
+	if user == nil {
+		return primitive.NilObjectID, errNotAuthenticated
+	}
+	return primitive.ObjectIDFromHex(user.ID)
+}
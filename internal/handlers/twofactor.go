@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService services.TwoFactorService
+	lockoutService   services.LockoutService
+}
+
+func NewTwoFactorHandler(stores repositories.Stores) TwoFactorHandler {
+	return TwoFactorHandler{
+		twoFactorService: services.NewTwoFactorService(stores),
+		lockoutService:   services.NewLockoutService(stores),
+	}
+}
+
+func (h TwoFactorHandler) Setup(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	setup, err := h.twoFactorService.Setup(c.UserContext(), userId)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(setup)
+}
+
+func (h TwoFactorHandler) Enable(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	var request models.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	codes, err := h.twoFactorService.Enable(c.UserContext(), userId, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Two-factor authentication enabled, store these recovery codes somewhere safe",
+		"recoveryCodes": codes,
+	})
+}
+
+func (h TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	var request models.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	err = h.checkCode(c, func() error {
+		return h.twoFactorService.Disable(c.UserContext(), userId, request.Code)
+	})
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+func (h TwoFactorHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+
+	var request models.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var codes []string
+	err = h.checkCode(c, func() error {
+		codes, err = h.twoFactorService.RegenerateRecoveryCodes(c.UserContext(), userId, request.Code)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+// checkCode runs check, which verifies a code of the current user's, behind
+// the login lockout. Wrong codes count against the user's email, so a stolen
+// session cannot guess codes here faster than at login. Callers have made
+// sure there is a current user.
+func (h TwoFactorHandler) checkCode(c *fiber.Ctx, check func() error) error {
+	email := middlewares.CurrentUser(c).Email
+
+	if err := h.lockoutService.Check(c.UserContext(), c.IP(), email); err != nil {
+		return err
+	}
+
+	err := check()
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		if err := h.lockoutService.RecordFailure(c.UserContext(), c.IP(), email); err != nil {
+			return err
+		}
+	} else if err == nil {
+		if err := h.lockoutService.RecordSuccess(c.UserContext(), email); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	var lockout *services.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrInvalidLoginChallenge):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorNotSetUp), errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process two-factor request"})
+}
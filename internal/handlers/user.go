@@ -1,7 +1,9 @@
 package handlers
 
 import (
-	"manga_store/internal/helpers"
+	"errors"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/repositories"
 	"manga_store/internal/services"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,28 +11,26 @@ import (
 )
 
 type UserHandler struct {
-	userService services.UserService
+	userService    services.UserService
+	sessionService services.SessionService
+	lockoutService services.LockoutService
 }
 
-func NewUserHandler() UserHandler {
+func NewUserHandler(stores repositories.Stores) UserHandler {
 	return UserHandler{
-		userService: services.NewUserService(),
+		userService:    services.NewUserService(stores),
+		sessionService: services.NewSessionService(stores),
+		lockoutService: services.NewLockoutService(stores),
 	}
 }
 
 func (h UserHandler) GetUser(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	userID, err := helpers.Decrypt(encUserId)
+	userObjectId, err := currentUserID(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
 
-	userObjectId, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
-	}
-
-	user, err := h.userService.GetUser(userObjectId)
+	user, err := h.userService.GetUser(c.UserContext(), userObjectId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get recommendations",
@@ -40,13 +40,19 @@ func (h UserHandler) GetUser(c *fiber.Ctx) error {
 }
 
 func (h UserHandler) GetRecsByPreferences(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	userID, err := helpers.Decrypt(encUserId)
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+	params, err := pageParams(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	recommendations, err := h.userService.GetRecsByPreferences(userID)
+	recommendations, err := h.userService.GetRecsByPreferences(c.UserContext(), userId.Hex(), params)
 	if err != nil {
+		if isPageError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get recommendations",
 		})
@@ -55,13 +61,19 @@ func (h UserHandler) GetRecsByPreferences(c *fiber.Ctx) error {
 }
 
 func (h UserHandler) GetRecsBySimilarUsers(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	userID, err := helpers.Decrypt(encUserId)
+	userId, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
+	}
+	params, err := pageParams(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	recommendations, err := h.userService.GetRecsBySimilarUsers(userID)
+	recommendations, err := h.userService.GetRecsBySimilarUsers(c.UserContext(), userId.Hex(), params)
 	if err != nil {
+		if isPageError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get recommendations",
 		})
@@ -70,25 +82,24 @@ func (h UserHandler) GetRecsBySimilarUsers(c *fiber.Ctx) error {
 }
 
 func (h UserHandler) DeleteUser(c *fiber.Ctx) error {
-	encUserId := c.Cookies("data")
-	decUserId, err := helpers.Decrypt(encUserId)
+	userId, err := currentUserID(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try loggin in again"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user credentials, try logging in again"})
 	}
 
-	userId, err := primitive.ObjectIDFromHex(decUserId)
+	err = h.userService.DeleteUser(c.UserContext(), userId)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "User ID is invalid",
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete user",
 		})
 	}
 
-	err = h.userService.DeleteUser(userId)
-	if err != nil {
+	if err := h.sessionService.RevokeAll(c.UserContext(), userId.Hex()); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user",
+			"error": "User deleted, but failed to end their sessions",
 		})
 	}
+	middlewares.ClearSessionCookie(c)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User deleted successfully",
@@ -96,15 +107,8 @@ func (h UserHandler) DeleteUser(c *fiber.Ctx) error {
 }
 
 func (h UserHandler) RestoreUser(c *fiber.Ctx) error {
-	isAdmin := c.Cookies("isAdmin")
-	if isAdmin != "true" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Forbidden",
-		})
-	}
-
 	id := c.Params("id")
-	if isAdmin == "" {
+	if id == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "User ID is required",
 		})
@@ -117,10 +121,15 @@ func (h UserHandler) RestoreUser(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.userService.RestoreUser(userId)
+	err = h.userService.RestoreUser(c.UserContext(), userId)
+	if errors.Is(err, services.ErrEmailTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Another account uses this user's email, so the user cannot be restored",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user",
+			"error": "Failed to restore user",
 		})
 	}
 
@@ -128,3 +137,25 @@ func (h UserHandler) RestoreUser(c *fiber.Ctx) error {
 		"message": "User restored successfully",
 	})
 }
+
+// UnlockLogin lifts a brute-force lockout on an email before it expires.
+func (h UserHandler) UnlockLogin(c *fiber.Ctx) error {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&request); err != nil || request.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+
+	if err := h.lockoutService.Unlock(c.UserContext(), request.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock login",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Login unlocked",
+	})
+}
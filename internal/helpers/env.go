@@ -5,6 +5,7 @@ import (
 	"manga_store/internal/logger"
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetEnv(key, fallback string) string {
@@ -38,3 +39,18 @@ func GetEnvBool(key string, fallback bool) bool {
 	logger.Warn(fmt.Sprintf("%s not found in environment variables", key))
 	return fallback
 }
+
+// GetEnvDuration reads a duration written the way time.ParseDuration takes
+// it, such as "5s" or "1m30s".
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Invalid %s %q, using %s: %s", key, value, fallback, err))
+			return fallback
+		}
+		return v
+	}
+	logger.Warn(fmt.Sprintf("%s not found in environment variables", key))
+	return fallback
+}
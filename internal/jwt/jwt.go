@@ -0,0 +1,193 @@
+// Package jwt signs and verifies the compact JWTs the API hands to bearer
+// token clients. Only HS256 and RS256 are supported, and every token names
+// the key that signed it in its kid header so keys can be rotated.
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is malformed or its signature is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownKey   = errors.New("token was signed with an unknown key")
+)
+
+type Claims struct {
+	Subject   string `json:"sub"`
+	Type      string `json:"typ"`
+	ID        string `json:"jti"`
+	Family    string `json:"fam,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Key is one signing key. HS256 keys hold a shared secret, RS256 keys a
+// private key whose public half verifies.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   *rsa.PrivateKey
+}
+
+func NewHS256Key(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: HS256, secret: secret}
+}
+
+func NewRS256Key(id string, private *rsa.PrivateKey) Key {
+	return Key{ID: id, Algorithm: RS256, private: private}
+}
+
+// KeySet signs with one key and verifies with any of them. To rotate, add
+// the new key, make it the signing key, and drop the old one once the
+// tokens it signed have expired.
+type KeySet struct {
+	signing Key
+	keys    map[string]Key
+}
+
+func NewKeySet(signingID string, keys ...Key) (*KeySet, error) {
+	set := &KeySet{keys: map[string]Key{}}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("jwt: key id is required")
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[signingID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: signing key %q is not in the key set", signingID)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+func (s *KeySet) Sign(claims Claims) (string, error) {
+	head, err := encodeSegment(header{Algorithm: s.signing.Algorithm, Type: "JWT", KeyID: s.signing.ID})
+	if err != nil {
+		return "", err
+	}
+	body, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := head + "." + body
+	signature, err := s.signing.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Parse verifies token's signature against the key named in its header and
+// rejects it once expired.
+func (s *KeySet) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var head header
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := s.keys[head.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// The algorithm is fixed by the key, never taken from the token, so a
+	// token cannot downgrade an RS256 key to HS256 or "none".
+	if head.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func (k Key) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest[:])
+	}
+	return nil, fmt.Errorf("jwt: unsupported algorithm %q", k.Algorithm)
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(&k.private.PublicKey, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,171 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Subject:   "user-1",
+		Type:      "access",
+		ID:        "token-1",
+		Family:    "family-1",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+// forge builds a token with the given header and claims, signed by key. A
+// nil key leaves the signature empty, as an alg "none" token does.
+func forge(t *testing.T, head header, claims Claims, key *Key) string {
+	t.Helper()
+
+	h, err := encodeSegment(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := h + "." + b
+	if key == nil {
+		return input + "."
+	}
+
+	signature, err := key.sign([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestParse(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := NewHS256Key("current", []byte("current-secret"))
+	retired := NewHS256Key("retired", []byte("retired-secret"))
+	rsaKey := NewRS256Key("rsa", private)
+
+	keys, err := NewKeySet("current", current, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := keys.Sign(validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigned := forge(t, header{Algorithm: RS256, Type: "JWT", KeyID: "rsa"}, validClaims(), &rsaKey)
+
+	// An HS256 token "signed" with the RSA public key, the classic way to
+	// downgrade a verifier that trusts the token's alg header.
+	publicDER := x509.MarshalPKCS1PublicKey(&private.PublicKey)
+	downgrade := NewHS256Key("rsa", publicDER)
+
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+
+	parts := strings.Split(signed, ".")
+	tamperedBody, err := encodeSegment(Claims{Subject: "admin", Type: "access", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("wrong-secret"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	wrongSignature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid HS256", signed, nil},
+		{"valid RS256", rsaSigned, nil},
+		{"tampered claims", parts[0] + "." + tamperedBody + "." + parts[2], ErrInvalidToken},
+		{"signature from another secret", parts[0] + "." + parts[1] + "." + wrongSignature, ErrInvalidToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", ErrInvalidToken},
+		{"empty signature", parts[0] + "." + parts[1] + ".", ErrInvalidToken},
+		{"alg none", forge(t, header{Algorithm: "none", Type: "JWT", KeyID: "current"}, validClaims(), nil), ErrInvalidToken},
+		{"alg none on an RS256 key", forge(t, header{Algorithm: "none", Type: "JWT", KeyID: "rsa"}, validClaims(), nil), ErrInvalidToken},
+		{"HS256 on an RS256 key", forge(t, header{Algorithm: HS256, Type: "JWT", KeyID: "rsa"}, validClaims(), &downgrade), ErrInvalidToken},
+		{"RS256 on an HS256 key", forge(t, header{Algorithm: RS256, Type: "JWT", KeyID: "current"}, validClaims(), &rsaKey), ErrInvalidToken},
+		{"unknown kid", forge(t, header{Algorithm: HS256, Type: "JWT", KeyID: "missing"}, validClaims(), &current), ErrUnknownKey},
+		{"missing kid", forge(t, header{Algorithm: HS256, Type: "JWT"}, validClaims(), &current), ErrUnknownKey},
+		{"rotated-out kid", forge(t, header{Algorithm: HS256, Type: "JWT", KeyID: "retired"}, validClaims(), &retired), ErrUnknownKey},
+		{"expired", forge(t, header{Algorithm: HS256, Type: "JWT", KeyID: "current"}, expired, &current), ErrExpiredToken},
+		{"empty", "", ErrInvalidToken},
+		{"one segment", parts[0], ErrInvalidToken},
+		{"two segments", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"four segments", signed + "." + parts[2], ErrInvalidToken},
+		{"header not JSON", base64.RawURLEncoding.EncodeToString([]byte("{")) + "." + parts[1] + "." + parts[2], ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := keys.Parse(test.token)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Parse error = %v, want %v", err, test.want)
+			}
+			if test.want == nil && claims.Subject != "user-1" {
+				t.Errorf("subject = %q, want user-1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := NewHS256Key("old", []byte("old-secret"))
+	next := NewHS256Key("new", []byte("new-secret"))
+
+	before, err := NewKeySet("old", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := before.Sign(validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	during, err := NewKeySet("new", old, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := during.Parse(token); err != nil {
+		t.Errorf("token signed by the old key was rejected during rotation: %v", err)
+	}
+
+	after, err := NewKeySet("new", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Parse(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token signed by a dropped key: error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	key := NewHS256Key("a", []byte("secret"))
+
+	if _, err := NewKeySet("b", key); err == nil {
+		t.Error("accepted a signing key that is not in the set")
+	}
+	if _, err := NewKeySet("a", key, key); err == nil {
+		t.Error("accepted duplicate key ids")
+	}
+	if _, err := NewKeySet("", NewHS256Key("", []byte("secret"))); err == nil {
+		t.Error("accepted a key without an id")
+	}
+}
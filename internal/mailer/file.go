@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes each message to its own .eml file in dir, where it can
+// be opened with any mail client.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) FileMailer {
+	return FileMailer{dir: dir, from: from}
+}
+
+func (m FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o644)
+}
@@ -0,0 +1,48 @@
+// Package mailer sends the account emails the API produces. SMTP is used in
+// production; the file and memory mailers let local development and tests
+// run without a mail server.
+package mailer
+
+import (
+	"manga_store/internal/helpers"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer Mailer
+)
+
+// Default returns the mailer selected by MAILER: "smtp", "file" (the
+// default, writing to MAIL_DIR) or "memory".
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		from := helpers.GetEnv("MAIL_FROM", "Manga Store <no-reply@mangastore.local>")
+
+		switch helpers.GetEnv("MAILER", "file") {
+		case "smtp":
+			defaultMailer = NewSMTPMailer(
+				helpers.GetEnv("SMTP_ADDR", "localhost:587"),
+				helpers.GetEnv("SMTP_USERNAME", ""),
+				helpers.GetEnv("SMTP_PASSWORD", ""),
+				from,
+			)
+		case "memory":
+			defaultMailer = NewMemoryMailer()
+		default:
+			defaultMailer = NewFileMailer(helpers.GetEnv("MAIL_DIR", "mail"), from)
+		}
+	})
+
+	return defaultMailer
+}
@@ -0,0 +1,28 @@
+package mailer
+
+import "sync"
+
+// MemoryMailer keeps sent messages in memory for tests to inspect.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message{}, m.sent...)
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(addr, username, password, from string) SMTPMailer {
+	return SMTPMailer{addr: addr, username: username, password: password, from: from}
+}
+
+func (m SMTPMailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, err := net.SplitHostPort(m.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+
+	return smtp.SendMail(m.addr, auth, from.Address, []string{msg.To}, format(m.from, msg))
+}
+
+// format renders msg as a plain-text RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SessionCookie = "session"
+
+	userLocal    = "user"
+	sessionLocal = "session"
+)
+
+// Authenticate admits requests carrying either a live session cookie or an
+// "Authorization: Bearer" access token, and places the caller's user, loaded
+// fresh from the database, in the request context either way.
+func Authenticate(stores repositories.Stores) fiber.Handler {
+	sessionService := services.NewSessionService(stores)
+	tokenService := services.NewTokenService(stores)
+	userService := services.NewUserService(stores)
+
+	return func(c *fiber.Ctx) error {
+		var userID string
+		var session *models.Session
+
+		if token, ok := bearerToken(c); ok {
+			var err error
+			userID, err = tokenService.Authenticate(c.UserContext(), token)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+			}
+		} else {
+			var err error
+			session, err = sessionService.Validate(c.UserContext(), c.Cookies(SessionCookie))
+			if err != nil {
+				ClearSessionCookie(c)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+			}
+			userID = session.UserID
+		}
+
+		userId, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		user, err := userService.GetActiveUser(c.UserContext(), userId)
+		if err != nil {
+			if session != nil {
+				sessionService.Revoke(c.UserContext(), session.ID)
+				ClearSessionCookie(c)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		c.Locals(userLocal, user)
+		if session != nil {
+			c.Locals(sessionLocal, session)
+		}
+		return c.Next()
+	}
+}
+
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// CurrentUser returns the user Authenticate resolved for this request, or nil
+// on routes it does not guard.
+func CurrentUser(c *fiber.Ctx) *models.User {
+	user, _ := c.Locals(userLocal).(*models.User)
+	return user
+}
+
+// CurrentSession returns the session Authenticate validated for this request,
+// or nil when the caller authenticated with a bearer token.
+func CurrentSession(c *fiber.Ctx) *models.Session {
+	session, _ := c.Locals(sessionLocal).(*models.Session)
+	return session
+}
+
+func SetSessionCookie(c *fiber.Ctx, session *models.Session) {
+	c.Cookie(&fiber.Cookie{
+		Name:     SessionCookie,
+		Value:    session.ID,
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+}
+
+func ClearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     SessionCookie,
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// disconnectPollInterval is how often a running request checks whether its
+// client has gone away.
+const disconnectPollInterval = 100 * time.Millisecond
+
+// RequestContext sets the context handlers pass to the services, and through
+// them to MongoDB, Neo4j and Redis. It is cancelled when base ends, when the
+// client disconnects, or, if timeout is positive, once the request has run
+// that long.
+//
+// fasthttp does not tell a running handler that its client went away, so
+// the connection is polled for it instead. Polling needs the raw socket, so
+// for TLS connections, and on platforms other than Linux and macOS, a
+// disconnected request is only cut short by the timeout.
+func RequestContext(base context.Context, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(base)
+		defer cancel()
+
+		if timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+			defer cancelTimeout()
+		}
+
+		if conn, ok := c.Context().Conn().(syscall.Conn); ok && detectsDisconnect {
+			stop := watchDisconnect(conn, cancel)
+			defer stop()
+		}
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// watchDisconnect calls cancel if the client at the other end of conn hangs
+// up before the returned stop function is called. stop waits for the
+// watcher to exit, so conn is not touched once the request is over.
+func watchDisconnect(conn syscall.Conn, cancel context.CancelFunc) (stop func()) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		ticker := time.NewTicker(disconnectPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if clientGone(raw) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
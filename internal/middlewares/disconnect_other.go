@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package middlewares
+
+import "syscall"
+
+// Sockets cannot be peeked at on this platform, so disconnects are not
+// detected and requests only end at their timeout.
+const detectsDisconnect = false
+
+func clientGone(raw syscall.RawConn) bool {
+	return false
+}
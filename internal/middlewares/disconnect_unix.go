@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package middlewares
+
+import (
+	"errors"
+	"syscall"
+)
+
+const detectsDisconnect = true
+
+// clientGone peeks at the socket without consuming anything fasthttp will
+// read later. A zero-byte read means the client closed the connection; a
+// pending byte, such as a pipelined request, or nothing to read yet means
+// it is still there.
+func clientGone(raw syscall.RawConn) bool {
+	gone := false
+	var buf [1]byte
+
+	raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			gone = n == 0
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK), errors.Is(err, syscall.EINTR):
+		default:
+			gone = true
+		}
+		return true
+	})
+
+	return gone
+}
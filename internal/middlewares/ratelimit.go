@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"manga_store/internal/repositories"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rateLimitDefaults are the limits used when RATE_LIMIT_<NAME> is not set.
+var rateLimitDefaults = map[string]string{
+	"global": "600/1m",
+	"auth":   "30/1m",
+	"manga":  "120/1m",
+	"search": "30/1m",
+	"user":   "60/1m",
+	"cart":   "120/1m",
+	"orders": "60/1m",
+}
+
+// RateLimit limits requests with a sliding window in cache, named after the
+// route group it guards. Requests are counted per user once Authenticate has
+// run and per IP before that. The limit comes from RATE_LIMIT_<NAME>, written
+// as requests/window such as "100/1m", or "off" to disable it. If the cache
+// is unavailable requests are let through rather than failing the API.
+func RateLimit(cache repositories.Cache, name string) fiber.Handler {
+	spec := helpers.GetEnv("RATE_LIMIT_"+strings.ToUpper(name), rateLimitDefaults[name])
+	if spec == "off" || spec == "" {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	limit, window, err := parseRateLimit(spec)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Invalid RATE_LIMIT_%s %q, rate limiting disabled: %s", strings.ToUpper(name), spec, err))
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	policy := fmt.Sprintf("%d;w=%d", limit, int(window.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		key := "rate_limit:" + name + ":ip:" + c.IP()
+		if user := CurrentUser(c); user != nil {
+			key = "rate_limit:" + name + ":user:" + user.ID
+		}
+
+		now := time.Now()
+		result, err := cache.SlidingWindow(c.UserContext(), key, limit, window)
+		if err != nil {
+			logger.Error("Rate limiter unavailable: " + err.Error())
+			return c.Next()
+		}
+
+		reset := result.Oldest.Add(window).Sub(now)
+		resetSeconds := int64(reset.Seconds() + 0.999)
+		if resetSeconds < 1 {
+			resetSeconds = 1
+		}
+
+		c.Set("RateLimit-Policy", policy)
+		c.Set("RateLimit-Limit", strconv.FormatInt(limit, 10))
+		c.Set("RateLimit-Remaining", strconv.FormatInt(max(limit-result.Count, 0), 10))
+		c.Set("RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
+
+		if !result.Admitted {
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(resetSeconds, 10))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many requests, slow down"})
+		}
+
+		return c.Next()
+	}
+}
+
+func parseRateLimit(spec string) (int64, time.Duration, error) {
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected requests/window")
+	}
+
+	limit, err := strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("request count must be a positive integer")
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || window < time.Second {
+		return 0, 0, fmt.Errorf("window must be a duration of at least 1s")
+	}
+
+	return limit, window, nil
+}
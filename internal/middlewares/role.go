@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/services"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole lets a request through only if the caller, as resolved by
+// Authenticate, holds one of roles and has two-factor authentication enabled.
+// Every decision is written to the audit log.
+func RequireRole(stores repositories.Stores, roles ...models.Role) fiber.Handler {
+	auditService := services.NewAuditService(stores)
+
+	return func(c *fiber.Ctx) error {
+		entry := models.AuditEntry{
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Route:     c.Route().Path,
+			Required:  roles,
+			IP:        c.IP(),
+			CreatedAt: time.Now().Unix(),
+		}
+
+		user := CurrentUser(c)
+		if user == nil {
+			entry.Reason = "unknown user"
+			auditService.Record(c.UserContext(), entry)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		entry.UserID = user.ID
+		entry.Email = user.Email
+
+		for _, role := range roles {
+			if user.HasRole(role) {
+				if !user.TwoFactorEnabled() {
+					entry.Reason = "two-factor authentication not enabled"
+					auditService.Record(c.UserContext(), entry)
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Enable two-factor authentication at /user/2fa/setup to use staff endpoints"})
+				}
+				entry.Allowed = true
+				auditService.Record(c.UserContext(), entry)
+				return c.Next()
+			}
+		}
+
+		entry.Reason = "missing role " + joinRoles(roles)
+		auditService.Record(c.UserContext(), entry)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+}
+
+func joinRoles(roles []models.Role) string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, string(role))
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import "context"
+
+// neo4jUniqueIDs folds duplicate Manga and User nodes created by the old
+// MERGE-on-every-property script into one node per id, then makes id unique.
+var neo4jUniqueIDs = Migration{
+	Version: 1,
+	Name:    "neo4j_unique_ids",
+	Up: func(ctx context.Context, s Stores) error {
+		return runCypher(ctx, s.Neo4j,
+			`MATCH (m:Manga)
+			 WITH m.id AS id, collect(m) AS nodes
+			 WHERE id IS NOT NULL AND size(nodes) > 1
+			 CALL apoc.refactor.mergeNodes(nodes, {properties: 'overwrite', mergeRels: true}) YIELD node
+			 RETURN count(node)`,
+			`MATCH (u:User)
+			 WITH u.id AS id, collect(u) AS nodes
+			 WHERE id IS NOT NULL AND size(nodes) > 1
+			 CALL apoc.refactor.mergeNodes(nodes, {properties: 'overwrite', mergeRels: true}) YIELD node
+			 RETURN count(node)`,
+			`CREATE CONSTRAINT manga_id_unique IF NOT EXISTS FOR (m:Manga) REQUIRE m.id IS UNIQUE`,
+			`CREATE CONSTRAINT user_id_unique IF NOT EXISTS FOR (u:User) REQUIRE u.id IS UNIQUE`,
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		return runCypher(ctx, s.Neo4j,
+			`DROP CONSTRAINT manga_id_unique IF EXISTS`,
+			`DROP CONSTRAINT user_id_unique IF EXISTS`,
+		)
+	},
+}
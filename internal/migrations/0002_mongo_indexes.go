@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var mongoIndexes = Migration{
+	Version: 2,
+	Name:    "mongo_indexes",
+	Up: func(ctx context.Context, s Stores) error {
+		err := createIndexes(ctx, s.Mongo.Collection("users"),
+			mongo.IndexModel{
+				Keys: bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_active_unique").SetUnique(true).
+					SetPartialFilterExpression(bson.M{"isDeleted": false}),
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		err = createIndexes(ctx, s.Mongo.Collection("manga"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "isDeleted", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("active_newest"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "sold", Value: -1}, {Key: "views", Value: -1}},
+				Options: options.Index().SetName("popular"),
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		err = createIndexes(ctx, s.Mongo.Collection("orders"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("user_newest"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("status_newest"),
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		return createIndexes(ctx, s.Mongo.Collection("outbox"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("pending_events"),
+			},
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		if err := dropIndexes(ctx, s.Mongo.Collection("users"), "email_active_unique"); err != nil {
+			return err
+		}
+		if err := dropIndexes(ctx, s.Mongo.Collection("manga"), "active_newest", "popular"); err != nil {
+			return err
+		}
+		if err := dropIndexes(ctx, s.Mongo.Collection("orders"), "user_newest", "status_newest"); err != nil {
+			return err
+		}
+		return dropIndexes(ctx, s.Mongo.Collection("outbox"), "pending_events")
+	},
+}
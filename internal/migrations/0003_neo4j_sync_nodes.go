@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// neo4jSyncNodes copies every active manga and user into the graph, keyed on
+// id alone so renamed titles update the existing node instead of adding one.
+var neo4jSyncNodes = Migration{
+	Version: 3,
+	Name:    "neo4j_sync_nodes",
+	Up: func(ctx context.Context, s Stores) error {
+		var manga []map[string]interface{}
+		cursor, err := s.Mongo.Collection("manga").Find(ctx, bson.M{"isDeleted": bson.M{"$ne": true}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID     string   `bson:"_id"`
+				Title  string   `bson:"title"`
+				Genres []string `bson:"genres"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+			manga = append(manga, map[string]interface{}{"id": doc.ID, "title": doc.Title, "genres": doc.Genres})
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		err = writeBatches(ctx, s.Neo4j, `
+			UNWIND $rows AS row
+			MERGE (m:Manga {id: row.id})
+			SET m.title = row.title, m.genres = row.genres
+		`, manga)
+		if err != nil {
+			return err
+		}
+
+		var users []map[string]interface{}
+		cursor, err = s.Mongo.Collection("users").Find(ctx, bson.M{"isDeleted": bson.M{"$ne": true}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID    string `bson:"_id"`
+				Email string `bson:"email"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+			users = append(users, map[string]interface{}{"id": doc.ID, "email": doc.Email})
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		return writeBatches(ctx, s.Neo4j, `
+			UNWIND $rows AS row
+			MERGE (u:User {id: row.id})
+			SET u.email = row.email
+		`, users)
+	},
+	// Copied nodes may already carry edges written by the app, so there is
+	// nothing safe to undo.
+	Down: nil,
+}
@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// neo4jSyncRelationships rebuilds RATED edges from user ratings and PURCHASED
+// edges from legacy purchase history and active orders.
+var neo4jSyncRelationships = Migration{
+	Version: 4,
+	Name:    "neo4j_sync_relationships",
+	Up: func(ctx context.Context, s Stores) error {
+		var ratings, purchases []map[string]interface{}
+
+		cursor, err := s.Mongo.Collection("users").Find(ctx, bson.M{"isDeleted": bson.M{"$ne": true}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID      string `bson:"_id"`
+				Ratings []struct {
+					MangaID string  `bson:"mangaId"`
+					Score   float64 `bson:"score"`
+				} `bson:"ratings"`
+				PurchaseHistory []struct {
+					MangaID string `bson:"mangaId"`
+				} `bson:"purchaseHistory"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+			for _, rating := range doc.Ratings {
+				ratings = append(ratings, map[string]interface{}{"userID": doc.ID, "mangaID": rating.MangaID, "score": rating.Score})
+			}
+			for _, purchase := range doc.PurchaseHistory {
+				purchases = append(purchases, map[string]interface{}{"userID": doc.ID, "mangaID": purchase.MangaID})
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		cursor, err = s.Mongo.Collection("orders").Find(ctx, bson.M{"status": bson.M{"$nin": bson.A{"cancelled", "refunded"}}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var doc struct {
+				UserID string `bson:"userId"`
+				Items  []struct {
+					MangaID string `bson:"mangaId"`
+				} `bson:"items"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+			for _, item := range doc.Items {
+				purchases = append(purchases, map[string]interface{}{"userID": doc.UserID, "mangaID": item.MangaID})
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		err = writeBatches(ctx, s.Neo4j, `
+			UNWIND $rows AS row
+			MATCH (u:User {id: row.userID}), (m:Manga {id: row.mangaID})
+			MERGE (u)-[r:RATED]->(m)
+			SET r.score = row.score
+		`, ratings)
+		if err != nil {
+			return err
+		}
+
+		return writeBatches(ctx, s.Neo4j, `
+			UNWIND $rows AS row
+			MATCH (u:User {id: row.userID}), (m:Manga {id: row.mangaID})
+			MERGE (u)-[:PURCHASED]->(m)
+		`, purchases)
+	},
+	Down: nil,
+}
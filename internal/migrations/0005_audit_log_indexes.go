@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditLogIndexes = Migration{
+	Version: 5,
+	Name:    "audit_log_indexes",
+	Up: func(ctx context.Context, s Stores) error {
+		return createIndexes(ctx, s.Mongo.Collection("audit_log"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("user_newest"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "allowed", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("decision_newest"),
+			},
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		return dropIndexes(ctx, s.Mongo.Collection("audit_log"), "user_newest", "decision_newest")
+	},
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// verifyExistingEmails marks accounts created before email verification
+// existed as verified, so their owners are not locked out of logging in.
+var verifyExistingEmails = Migration{
+	Version: 6,
+	Name:    "verify_existing_emails",
+	Up: func(ctx context.Context, s Stores) error {
+		_, err := s.Mongo.Collection("users").UpdateMany(ctx,
+			bson.M{"emailVerified": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"emailVerified": true}},
+		)
+		return err
+	},
+	// Which users were verified by this migration is not recorded, so there
+	// is nothing safe to undo.
+	Down: nil,
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mangaVersions starts every existing manga at version 0, which updates
+// must quote back to be applied.
+var mangaVersions = Migration{
+	Version: 7,
+	Name:    "manga_versions",
+	Up: func(ctx context.Context, s Stores) error {
+		_, err := s.Mongo.Collection("manga").UpdateMany(ctx,
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"version": 0}},
+		)
+		return err
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		_, err := s.Mongo.Collection("manga").UpdateMany(ctx,
+			bson.M{},
+			bson.M{"$unset": bson.M{"version": ""}},
+		)
+		return err
+	},
+}
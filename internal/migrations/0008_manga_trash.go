@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mangaTrash indexes deleted manga for the trash listing and purge, and
+// stamps manga deleted before deletedAt existed so they are purged one
+// retention period from now rather than never.
+var mangaTrash = Migration{
+	Version: 8,
+	Name:    "manga_trash",
+	Up: func(ctx context.Context, s Stores) error {
+		_, err := s.Mongo.Collection("manga").UpdateMany(ctx,
+			bson.M{"isDeleted": true, "deletedAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"deletedAt": int(time.Now().Unix())}},
+		)
+		if err != nil {
+			return err
+		}
+
+		return createIndexes(ctx, s.Mongo.Collection("manga"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "isDeleted", Value: 1}, {Key: "deletedAt", Value: -1}},
+				Options: options.Index().SetName("trash"),
+			},
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		return dropIndexes(ctx, s.Mongo.Collection("manga"), "trash")
+	},
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// catalogTextIndex backs MongoDB catalog search. The weights match the
+// in-memory index's default boosts, so both rank a title match highest.
+var catalogTextIndex = Migration{
+	Version: 9,
+	Name:    "catalog_text_index",
+	Up: func(ctx context.Context, s Stores) error {
+		return createIndexes(ctx, s.Mongo.Collection("manga"),
+			mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "title", Value: "text"},
+					{Key: "author", Value: "text"},
+					{Key: "description", Value: "text"},
+				},
+				Options: options.Index().SetName("catalog_text").
+					SetWeights(bson.M{"title": 3, "author": 2, "description": 1}).
+					SetDefaultLanguage("english"),
+			},
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		return dropIndexes(ctx, s.Mongo.Collection("manga"), "catalog_text")
+	},
+}
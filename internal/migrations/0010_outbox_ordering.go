@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long processed graph events are kept, in seconds.
+const outboxRetention = 7 * 24 * 60 * 60
+
+// outboxOrdering gives existing graph events the entity keys the relay
+// orders them by, and indexes those keys. Processed events become dates so
+// a TTL index can prune them.
+var outboxOrdering = Migration{
+	Version: 10,
+	Name:    "outbox_ordering",
+	Up: func(ctx context.Context, s Stores) error {
+		outbox := s.Mongo.Collection("outbox")
+
+		_, err := outbox.UpdateMany(ctx, bson.M{"keys": bson.M{"$exists": false}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"keys": bson.M{"$concatArrays": bson.A{
+				bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{"$payload.userId", nil}},
+					bson.A{bson.M{"$concat": bson.A{"user:", "$payload.userId"}}},
+					bson.A{},
+				}},
+				bson.M{"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$payload.manga", bson.A{}}},
+					"as":    "manga",
+					"in":    bson.M{"$concat": bson.A{"manga:", "$$manga.id"}},
+				}},
+			}}}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = outbox.UpdateMany(ctx, bson.M{"processedAt": bson.M{"$type": "number"}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"processedAt": bson.M{"$toDate": bson.M{"$multiply": bson.A{bson.M{"$toLong": "$processedAt"}, 1000}}}}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		return createIndexes(ctx, outbox,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "keys", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("entity_order"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "processedAt", Value: 1}},
+				Options: options.Index().SetName("processed_ttl").SetExpireAfterSeconds(outboxRetention),
+			},
+		)
+	},
+	Down: func(ctx context.Context, s Stores) error {
+		outbox := s.Mongo.Collection("outbox")
+
+		if err := dropIndexes(ctx, outbox, "entity_order", "processed_ttl"); err != nil {
+			return err
+		}
+
+		_, err := outbox.UpdateMany(ctx, bson.M{"processedAt": bson.M{"$type": "date"}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"processedAt": bson.M{"$toLong": bson.M{"$divide": bson.A{bson.M{"$toLong": "$processedAt"}, 1000}}}}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = outbox.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"keys": ""}})
+		return err
+	},
+}
@@ -0,0 +1,308 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"manga_store/internal/databases"
+	"manga_store/internal/logger"
+	"sort"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const batchSize = 500
+
+var (
+	ErrLocked       = errors.New("another migration run holds the lock")
+	ErrIrreversible = errors.New("migration cannot be reverted")
+)
+
+// Migration is one numbered change to MongoDB and/or Neo4j. Up and Down must
+// both be safe to run again after a partial failure. Down is nil for a change
+// that cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, s Stores) error
+	Down    func(ctx context.Context, s Stores) error
+}
+
+type Stores struct {
+	Mongo *mongo.Database
+	Neo4j databases.Graph
+}
+
+type AppliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Runner applies migrations in version order and records each applied version
+// in the schema_migrations collection.
+type Runner struct {
+	stores     Stores
+	migrations []Migration
+	ledger     ledger
+}
+
+// ledger records which migrations are applied and holds the lock that keeps
+// two runners from migrating at once.
+type ledger interface {
+	applied(ctx context.Context) (map[int]AppliedMigration, error)
+	record(ctx context.Context, migration AppliedMigration) error
+	remove(ctx context.Context, version int) error
+	// lock returns ErrLocked if another runner holds the lock.
+	lock(ctx context.Context) error
+	unlock(ctx context.Context) error
+}
+
+func NewRunner(stores Stores, migrations []Migration) Runner {
+	return newRunner(stores, mongoLedger{
+		versions: stores.Mongo.Collection("schema_migrations"),
+		locks:    stores.Mongo.Collection("schema_migrations_lock"),
+	}, migrations)
+}
+
+func newRunner(stores Stores, ledger ledger, migrations []Migration) Runner {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return Runner{
+		stores:     stores,
+		migrations: sorted,
+		ledger:     ledger,
+	}
+}
+
+func (r Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.ledger.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, m := range r.migrations {
+		status := Status{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration up to and including target. A target of
+// zero means the latest version.
+func (r Runner) Up(ctx context.Context, target int) ([]Migration, error) {
+	var ran []Migration
+
+	err := r.withLock(ctx, func() error {
+		applied, err := r.ledger.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if target > 0 && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			logger.Info(fmt.Sprintf("Applying migration %04d_%s", m.Version, m.Name))
+			if err := m.Up(ctx, r.stores); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+
+			err := r.ledger.record(ctx, AppliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()})
+			if err != nil {
+				return err
+			}
+			ran = append(ran, m)
+		}
+
+		return nil
+	})
+
+	return ran, err
+}
+
+// Down reverts the given number of most recently applied migrations. If any
+// of them cannot be reverted it returns ErrIrreversible before reverting
+// anything, and every migration stays recorded as applied.
+func (r Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var ran []Migration
+
+	err := r.withLock(ctx, func() error {
+		applied, err := r.ledger.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		var revert []Migration
+		for i := len(r.migrations) - 1; i >= 0 && len(revert) < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("%04d_%s: %w", m.Version, m.Name, ErrIrreversible)
+			}
+			revert = append(revert, m)
+		}
+
+		for _, m := range revert {
+			logger.Info(fmt.Sprintf("Reverting migration %04d_%s", m.Version, m.Name))
+			if err := m.Down(ctx, r.stores); err != nil {
+				return fmt.Errorf("reverting %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+
+			if err := r.ledger.remove(ctx, m.Version); err != nil {
+				return err
+			}
+			ran = append(ran, m)
+		}
+
+		return nil
+	})
+
+	return ran, err
+}
+
+// withLock keeps two runners from migrating at once.
+func (r Runner) withLock(ctx context.Context, fn func() error) error {
+	if err := r.ledger.lock(ctx); err != nil {
+		return err
+	}
+	defer r.ledger.unlock(context.Background())
+
+	return fn()
+}
+
+// Unlock removes a lock left behind by a runner that crashed.
+func (r Runner) Unlock(ctx context.Context) error {
+	return r.ledger.unlock(ctx)
+}
+
+// mongoLedger keeps applied versions in one collection and the lock in
+// another.
+type mongoLedger struct {
+	versions *mongo.Collection
+	locks    *mongo.Collection
+}
+
+func (l mongoLedger) applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	cursor, err := l.versions.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := map[int]AppliedMigration{}
+	for cursor.Next(ctx) {
+		var record AppliedMigration
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		applied[record.Version] = record
+	}
+
+	return applied, cursor.Err()
+}
+
+func (l mongoLedger) record(ctx context.Context, migration AppliedMigration) error {
+	_, err := l.versions.InsertOne(ctx, migration)
+	return err
+}
+
+func (l mongoLedger) remove(ctx context.Context, version int) error {
+	_, err := l.versions.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
+
+// lock inserts the lock document. It is unique by _id, so only one insert
+// can succeed.
+func (l mongoLedger) lock(ctx context.Context) error {
+	_, err := l.locks.InsertOne(ctx, bson.M{"_id": "lock", "lockedAt": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+func (l mongoLedger) unlock(ctx context.Context) error {
+	_, err := l.locks.DeleteOne(ctx, bson.M{"_id": "lock"})
+	return err
+}
+
+// runCypher runs each statement in its own write transaction. Schema changes
+// cannot share a transaction with data writes.
+func runCypher(ctx context.Context, graph databases.Graph, statements ...string) error {
+	for _, statement := range statements {
+		_, err := graph.Write(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := tx.Run(ctx, statement, nil)
+			return nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBatches runs query once per batch of rows, passing the batch as $rows.
+func writeBatches(ctx context.Context, graph databases.Graph, query string, rows []map[string]interface{}) error {
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		_, err := graph.Write(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := tx.Run(ctx, query, map[string]interface{}{"rows": rows[start:end]})
+			return nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropIndexes(ctx context.Context, coll *mongo.Collection, names ...string) error {
+	for _, name := range names {
+		_, err := coll.Indexes().DropOne(ctx, name)
+		if err != nil && !isIndexNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Name == "IndexNotFound" || cmdErr.Code == 26)
+}
+
+func createIndexes(ctx context.Context, coll *mongo.Collection, indexes ...mongo.IndexModel) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	_, err := coll.Indexes().CreateMany(ctx, indexes, options.CreateIndexes())
+	return err
+}
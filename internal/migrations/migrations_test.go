@@ -0,0 +1,295 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// memoryLedger keeps the applied versions and the lock in memory.
+type memoryLedger struct {
+	mu       sync.Mutex
+	versions map[int]AppliedMigration
+	locked   bool
+}
+
+func (l *memoryLedger) applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	applied := map[int]AppliedMigration{}
+	for version, record := range l.versions {
+		applied[version] = record
+	}
+	return applied, nil
+}
+
+func (l *memoryLedger) record(ctx context.Context, migration AppliedMigration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.versions == nil {
+		l.versions = map[int]AppliedMigration{}
+	}
+	l.versions[migration.Version] = migration
+	return nil
+}
+
+func (l *memoryLedger) remove(ctx context.Context, version int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.versions, version)
+	return nil
+}
+
+func (l *memoryLedger) lock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locked {
+		return ErrLocked
+	}
+	l.locked = true
+	return nil
+}
+
+func (l *memoryLedger) unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.locked = false
+	return nil
+}
+
+// ledgerBackends are the memory ledger, and the MongoDB instance named by
+// MONGO_TEST_URI when it is set.
+var ledgerBackends = []struct {
+	name   string
+	ledger func(t *testing.T) ledger
+}{
+	{"memory", func(t *testing.T) ledger { return &memoryLedger{} }},
+	{"mongo", mongoTestLedger},
+}
+
+func mongoTestLedger(t *testing.T) ledger {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("manga_store_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	return mongoLedger{
+		versions: db.Collection("schema_migrations"),
+		locks:    db.Collection("schema_migrations_lock"),
+	}
+}
+
+// testMigrations returns migrations that log each step they run to trace.
+// Versions listed in irreversible get no Down.
+func testMigrations(trace *[]string, versions []int, irreversible ...int) []Migration {
+	var migrations []Migration
+	for _, version := range versions {
+		m := Migration{
+			Version: version,
+			Name:    fmt.Sprintf("step_%d", version),
+			Up: func(ctx context.Context, s Stores) error {
+				*trace = append(*trace, fmt.Sprintf("up %d", version))
+				return nil
+			},
+			Down: func(ctx context.Context, s Stores) error {
+				*trace = append(*trace, fmt.Sprintf("down %d", version))
+				return nil
+			},
+		}
+		for _, v := range irreversible {
+			if v == version {
+				m.Down = nil
+			}
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations
+}
+
+func versions(migrations []Migration) []int {
+	var versions []int
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	return versions
+}
+
+func appliedVersions(t *testing.T, r Runner) []int {
+	t.Helper()
+
+	statuses, err := r.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []int
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			applied = append(applied, status.Version)
+		}
+	}
+	return applied
+}
+
+func TestRunner(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, l ledger)
+	}{
+		{
+			name: "applies in version order",
+			run: func(t *testing.T, l ledger) {
+				var trace []string
+				r := newRunner(Stores{}, l, testMigrations(&trace, []int{3, 1, 2}))
+
+				ran, err := r.Up(context.Background(), 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := versions(ran); !reflect.DeepEqual(got, []int{1, 2}) {
+					t.Errorf("up to 2 ran %v, want [1 2]", got)
+				}
+
+				ran, err = r.Up(context.Background(), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := versions(ran); !reflect.DeepEqual(got, []int{3}) {
+					t.Errorf("up ran %v, want [3]", got)
+				}
+				if want := []string{"up 1", "up 2", "up 3"}; !reflect.DeepEqual(trace, want) {
+					t.Errorf("trace = %v, want %v", trace, want)
+				}
+			},
+		},
+		{
+			name: "running twice changes nothing",
+			run: func(t *testing.T, l ledger) {
+				var trace []string
+				r := newRunner(Stores{}, l, testMigrations(&trace, []int{1, 2}))
+
+				if _, err := r.Up(context.Background(), 0); err != nil {
+					t.Fatal(err)
+				}
+				ran, err := r.Up(context.Background(), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ran) != 0 {
+					t.Errorf("second run applied %v", versions(ran))
+				}
+				if want := []string{"up 1", "up 2"}; !reflect.DeepEqual(trace, want) {
+					t.Errorf("trace = %v, want %v", trace, want)
+				}
+				if got := appliedVersions(t, r); !reflect.DeepEqual(got, []int{1, 2}) {
+					t.Errorf("applied = %v, want [1 2]", got)
+				}
+			},
+		},
+		{
+			name: "lock keeps a second runner out",
+			run: func(t *testing.T, l ledger) {
+				var trace []string
+				r := newRunner(Stores{}, l, testMigrations(&trace, []int{1}))
+
+				if err := l.lock(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := r.Up(context.Background(), 0); !errors.Is(err, ErrLocked) {
+					t.Fatalf("up while locked = %v, want ErrLocked", err)
+				}
+				if _, err := r.Down(context.Background(), 1); !errors.Is(err, ErrLocked) {
+					t.Fatalf("down while locked = %v, want ErrLocked", err)
+				}
+				if len(trace) != 0 {
+					t.Fatalf("locked runner ran %v", trace)
+				}
+
+				if err := r.Unlock(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := r.Up(context.Background(), 0); err != nil {
+					t.Fatalf("up after unlock: %v", err)
+				}
+				// A finished run releases the lock for the next one.
+				if _, err := r.Down(context.Background(), 1); err != nil {
+					t.Fatalf("down after up: %v", err)
+				}
+			},
+		},
+		{
+			name: "down refuses an irreversible step",
+			run: func(t *testing.T, l ledger) {
+				var trace []string
+				r := newRunner(Stores{}, l, testMigrations(&trace, []int{1, 2, 3}, 2))
+
+				if _, err := r.Up(context.Background(), 0); err != nil {
+					t.Fatal(err)
+				}
+
+				ran, err := r.Down(context.Background(), 2)
+				if !errors.Is(err, ErrIrreversible) {
+					t.Fatalf("down over 0002 = %v, want ErrIrreversible", err)
+				}
+				if len(ran) != 0 {
+					t.Errorf("down reverted %v before refusing", versions(ran))
+				}
+				if got := appliedVersions(t, r); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+					t.Errorf("applied = %v, want [1 2 3]", got)
+				}
+
+				ran, err = r.Down(context.Background(), 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := versions(ran); !reflect.DeepEqual(got, []int{3}) {
+					t.Errorf("down ran %v, want [3]", got)
+				}
+				if want := []string{"up 1", "up 2", "up 3", "down 3"}; !reflect.DeepEqual(trace, want) {
+					t.Errorf("trace = %v, want %v", trace, want)
+				}
+			},
+		},
+	}
+
+	for _, backend := range ledgerBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.run(t, backend.ledger(t))
+				})
+			}
+		})
+	}
+}
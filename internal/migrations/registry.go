@@ -0,0 +1,16 @@
+package migrations
+
+// All lists the built-in migrations. New migrations get the next version
+// number and are never renumbered once released.
+var All = []Migration{
+	neo4jUniqueIDs,
+	mongoIndexes,
+	neo4jSyncNodes,
+	neo4jSyncRelationships,
+	auditLogIndexes,
+	verifyExistingEmails,
+	mangaVersions,
+	mangaTrash,
+	catalogTextIndex,
+	outboxOrdering,
+}
@@ -0,0 +1,16 @@
+package models
+
+// AuditEntry records one authorization decision on a protected route.
+type AuditEntry struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	UserID    string `json:"userId" bson:"userId,omitempty"`
+	Email     string `json:"email" bson:"email,omitempty"`
+	Method    string `json:"method" bson:"method"`
+	Path      string `json:"path" bson:"path"`
+	Route     string `json:"route" bson:"route"`
+	Required  []Role `json:"required" bson:"required"`
+	Allowed   bool   `json:"allowed" bson:"allowed"`
+	Reason    string `json:"reason,omitempty" bson:"reason,omitempty"`
+	IP        string `json:"ip" bson:"ip"`
+	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
+}
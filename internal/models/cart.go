@@ -0,0 +1,24 @@
+package models
+
+type CartItem struct {
+	MangaID   string   `json:"mangaId"`
+	Title     string   `json:"title"`
+	ImageURL  string   `json:"imageUrl"`
+	Genres    []string `json:"genres"`
+	Price     float64  `json:"price"`
+	Quantity  int      `json:"quantity"`
+	Available int      `json:"available"`
+	InStock   bool     `json:"inStock"`
+	Subtotal  float64  `json:"subtotal"`
+}
+
+type Cart struct {
+	Items      []CartItem `json:"items"`
+	TotalItems int        `json:"totalItems"`
+	Total      float64    `json:"total"`
+}
+
+type CartItemRequest struct {
+	MangaID  string `json:"mangaId"`
+	Quantity int    `json:"quantity"`
+}
@@ -13,13 +13,73 @@ type Manga struct {
 	Views       int      `json:"views" bson:"views"`
 	IsDeleted   bool     `json:"isDeleted" bson:"isDeleted"`
 	CreatedAt   int      `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   int      `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	Version     int      `json:"version" bson:"version"`
+	DeletedAt   int      `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 	Quantity    int      `json:"quantity" bson:"quantity"`
 	Sold        int      `json:"sold" bson:"sold"`
 }
 
+// UpdateMangaRequest is a partial update: only the fields that are present
+// are changed. Version must match the stored document, so an edit made from
+// a stale copy is rejected instead of overwriting someone else's change.
+type UpdateMangaRequest struct {
+	Title       *string   `json:"title"`
+	Author      *string   `json:"author"`
+	Description *string   `json:"description"`
+	ImageURL    *string   `json:"imageUrl"`
+	Genres      *[]string `json:"genres"`
+	Price       *float64  `json:"price"`
+	Quantity    *int      `json:"quantity"`
+	Version     *int      `json:"version"`
+}
+
 type SearchMangaRequest struct {
-	Query  string   `json:"query"`
-	Genres []string `json:"genres"`
-	Author string   `json:"author"`
-	Limit  int      `json:"limit"`
+	Query     string   `json:"query"`
+	Genres    []string `json:"genres"`
+	Author    string   `json:"author"`
+	MinPrice  *float64 `json:"minPrice"`
+	MaxPrice  *float64 `json:"maxPrice"`
+	MinRating *float64 `json:"minRating"`
+	InStock   bool     `json:"inStock"`
+	Sort      string   `json:"sort"`
+	Limit     int      `json:"limit"`
+	Cursor    string   `json:"cursor"`
+}
+
+type SearchMangaResponse struct {
+	Items      []Manga      `json:"items"`
+	NextCursor string       `json:"nextCursor"`
+	Total      int          `json:"total"`
+	Facets     SearchFacets `json:"facets"`
+}
+
+// SearchFacets counts every manga matching a search, not just the page of
+// results returned, broken down the ways the storefront can filter them.
+type SearchFacets struct {
+	Genres     []FacetCount   `json:"genres"`
+	Authors    []FacetCount   `json:"authors"`
+	Price      []PriceBucket  `json:"price"`
+	Rating     []RatingBucket `json:"rating"`
+	InStock    int            `json:"inStock"`
+	OutOfStock int            `json:"outOfStock"`
+}
+
+type FacetCount struct {
+	Value string `json:"value" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// PriceBucket counts manga priced from Min up to, but not including, Max.
+// The last bucket has no Max.
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// RatingBucket counts manga rated MinRating or higher, so buckets overlap.
+type RatingBucket struct {
+	MinRating float64 `json:"minRating"`
+	Count     int     `json:"count"`
 }
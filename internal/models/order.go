@@ -0,0 +1,76 @@
+package models
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Cancelled and refunded orders are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the order still counts as a purchase of its items.
+func (s OrderStatus) Active() bool {
+	return s != OrderStatusCancelled && s != OrderStatusRefunded
+}
+
+type Order struct {
+	ID            string              `json:"id" bson:"_id,omitempty"`
+	UserID        string              `json:"userId" bson:"userId"`
+	Items         []OrderItem         `json:"items" bson:"items"`
+	Total         float64             `json:"total" bson:"total"`
+	Status        OrderStatus         `json:"status" bson:"status"`
+	StatusHistory []OrderStatusChange `json:"statusHistory" bson:"statusHistory"`
+	CreatedAt     int                 `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     int                 `json:"updatedAt" bson:"updatedAt"`
+}
+
+type OrderItem struct {
+	MangaID  string   `json:"mangaId" bson:"mangaId"`
+	Title    string   `json:"title" bson:"title"`
+	Genres   []string `json:"genres" bson:"genres"`
+	Price    float64  `json:"price" bson:"price"`
+	Quantity int      `json:"quantity" bson:"quantity"`
+	Subtotal float64  `json:"subtotal" bson:"subtotal"`
+}
+
+type OrderStatusChange struct {
+	Status    OrderStatus `json:"status" bson:"status"`
+	ChangedAt int         `json:"changedAt" bson:"changedAt"`
+	ChangedBy string      `json:"changedBy" bson:"changedBy"`
+	Note      string      `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+type UpdateOrderStatusRequest struct {
+	Status OrderStatus `json:"status"`
+	Note   string      `json:"note"`
+}
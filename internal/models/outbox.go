@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+type GraphEventType string
+
+const (
+	GraphEventMangaUpserted   GraphEventType = "manga.upserted"
+	GraphEventMangaDeleted    GraphEventType = "manga.deleted"
+	GraphEventUserUpserted    GraphEventType = "user.upserted"
+	GraphEventUserDeleted     GraphEventType = "user.deleted"
+	GraphEventMangaViewed     GraphEventType = "manga.viewed"
+	GraphEventMangaPurchased  GraphEventType = "manga.purchased"
+	GraphEventPurchaseRemoved GraphEventType = "purchase.removed"
+	GraphEventMangaRated      GraphEventType = "manga.rated"
+	GraphEventRatingRemoved   GraphEventType = "rating.removed"
+)
+
+type GraphEventStatus string
+
+const (
+	GraphEventPending   GraphEventStatus = "pending"
+	GraphEventProcessed GraphEventStatus = "processed"
+	GraphEventFailed    GraphEventStatus = "failed"
+)
+
+// GraphEvent is a pending change to the Neo4j graph, written to the outbox in
+// the same transaction as the MongoDB write it mirrors. Keys name the users
+// and manga it touches; an event is only applied once every earlier pending
+// event sharing a key has been. Events parked as failed hold nothing back,
+// and the drift they leave is repaired by cmd/reconcile.
+type GraphEvent struct {
+	ID            string            `json:"id" bson:"_id,omitempty"`
+	Type          GraphEventType    `json:"type" bson:"type"`
+	Payload       GraphEventPayload `json:"payload" bson:"payload"`
+	Keys          []string          `json:"keys" bson:"keys"`
+	Status        GraphEventStatus  `json:"status" bson:"status"`
+	Attempts      int               `json:"attempts" bson:"attempts"`
+	LastError     string            `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	NextAttemptAt int64             `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	LockedUntil   int64             `json:"lockedUntil" bson:"lockedUntil"`
+	CreatedAt     int64             `json:"createdAt" bson:"createdAt"`
+	ProcessedAt   time.Time         `json:"processedAt,omitempty" bson:"processedAt,omitempty"`
+}
+
+type GraphEventPayload struct {
+	UserID string       `json:"userId,omitempty" bson:"userId,omitempty"`
+	Email  string       `json:"email,omitempty" bson:"email,omitempty"`
+	Manga  []GraphManga `json:"manga,omitempty" bson:"manga,omitempty"`
+	Score  float64      `json:"score,omitempty" bson:"score,omitempty"`
+}
+
+// Keys returns the entity keys of the users and manga an event with this
+// payload touches.
+func (p GraphEventPayload) Keys() []string {
+	keys := make([]string, 0, len(p.Manga)+1)
+	if p.UserID != "" {
+		keys = append(keys, "user:"+p.UserID)
+	}
+	for _, manga := range p.Manga {
+		keys = append(keys, "manga:"+manga.ID)
+	}
+	return keys
+}
+
+type GraphManga struct {
+	ID     string   `json:"id" bson:"id"`
+	Title  string   `json:"title" bson:"title"`
+	Genres []string `json:"genres" bson:"genres"`
+}
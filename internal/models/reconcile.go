@@ -0,0 +1,49 @@
+package models
+
+// ReconcileReport lists every difference found between MongoDB, which is the
+// source of truth, and the Neo4j graph.
+type ReconcileReport struct {
+	MissingManga     []GraphManga    `json:"missingManga"`
+	StaleManga       []string        `json:"staleManga"`
+	MismatchedManga  []GraphManga    `json:"mismatchedManga"`
+	MissingUsers     []GraphUser     `json:"missingUsers"`
+	StaleUsers       []string        `json:"staleUsers"`
+	MismatchedUsers  []GraphUser     `json:"mismatchedUsers"`
+	MissingRatings   []GraphRating   `json:"missingRatings"`
+	StaleRatings     []GraphRating   `json:"staleRatings"`
+	MismatchedScores []GraphRating   `json:"mismatchedScores"`
+	MissingPurchases []GraphPurchase `json:"missingPurchases"`
+	StalePurchases   []GraphPurchase `json:"stalePurchases"`
+}
+
+// GraphSnapshot is everything in the graph that reconciling compares with
+// MongoDB: the nodes and the RATED and PURCHASED edges.
+type GraphSnapshot struct {
+	Manga     []GraphManga
+	Users     []GraphUser
+	Ratings   []GraphRating
+	Purchases []GraphPurchase
+}
+
+type GraphUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+type GraphRating struct {
+	UserID  string  `json:"userId"`
+	MangaID string  `json:"mangaId"`
+	Score   float64 `json:"score"`
+}
+
+type GraphPurchase struct {
+	UserID  string `json:"userId"`
+	MangaID string `json:"mangaId"`
+}
+
+func (r ReconcileReport) Differences() int {
+	return len(r.MissingManga) + len(r.StaleManga) + len(r.MismatchedManga) +
+		len(r.MissingUsers) + len(r.StaleUsers) + len(r.MismatchedUsers) +
+		len(r.MissingRatings) + len(r.StaleRatings) + len(r.MismatchedScores) +
+		len(r.MissingPurchases) + len(r.StalePurchases)
+}
@@ -0,0 +1,13 @@
+package models
+
+// Session is a server-side login. Only a hash of the session ID is stored;
+// the ID itself lives in the client's cookie.
+type Session struct {
+	ID         string `json:"-"`
+	UserID     string `json:"userId"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"userAgent"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
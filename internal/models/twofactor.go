@@ -0,0 +1,22 @@
+package models
+
+// LoginChallenge is returned instead of a login when the account has
+// two-factor authentication enabled.
+type LoginChallenge struct {
+	ChallengeID string `json:"challengeId"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+type CompleteLoginRequest struct {
+	ChallengeID string `json:"challengeId"`
+	Code        string `json:"code"`
+}
+
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
@@ -4,11 +4,56 @@ type User struct {
 	ID              string     `json:"id" bson:"_id,omitempty"`
 	Name            string     `json:"name" bson:"name"`
 	Email           string     `json:"email" bson:"email"`
+	EmailVerified   bool       `json:"emailVerified" bson:"emailVerified"`
 	PasswordHash    string     `json:"passwordHash" bson:"passwordHash"`
 	PurchaseHistory []Purchase `json:"purchaseHistory" bson:"purchaseHistory"`
 	Ratings         []Rating   `json:"ratings" bson:"ratings"`
 	IsDeleted       bool       `json:"isDeleted" bson:"isDeleted"`
 	IsAdmin         bool       `json:"isAdmin" bson:"isAdmin"`
+	Roles           []Role     `json:"roles" bson:"roles,omitempty"`
+	TwoFactor       *TwoFactor `json:"-" bson:"twoFactor,omitempty"`
+}
+
+// TwoFactor holds a user's TOTP enrolment. The secret is stored before the
+// user confirms it with a first code; only then is Enabled set.
+type TwoFactor struct {
+	Secret        string   `bson:"secret"`
+	Enabled       bool     `bson:"enabled"`
+	EnabledAt     int64    `bson:"enabledAt,omitempty"`
+	LastUsedStep  int64    `bson:"lastUsedStep"`
+	RecoveryCodes []string `bson:"recoveryCodes"`
+}
+
+func (u User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// IsStaff reports whether the user holds any role. Staff must enrol in
+// two-factor authentication before their roles take effect.
+func (u User) IsStaff() bool {
+	return u.IsAdmin || len(u.Roles) > 0
+}
+
+// Role grants access to a set of staff endpoints. Admins hold every role.
+type Role string
+
+const (
+	RoleAdmin         Role = "admin"
+	RoleCatalogEditor Role = "catalog_editor"
+	RoleOrderManager  Role = "order_manager"
+	RoleSupport       Role = "support"
+)
+
+func (u User) HasRole(role Role) bool {
+	if u.IsAdmin {
+		return true
+	}
+	for _, r := range u.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
 }
 
 type Rating struct {
@@ -20,6 +65,7 @@ type Purchase struct {
 	MangaID      string  `json:"mangaId" bson:"mangaId"`
 	Title        string  `json:"title" bson:"title"`
 	Price        float64 `json:"price" bson:"price"`
+	Quantity     int     `json:"quantity" bson:"quantity,omitempty"`
 	PurchaseDate string  `json:"purchaseDate" bson:"purchaseDate"`
 }
 
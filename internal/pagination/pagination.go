@@ -0,0 +1,398 @@
+// Package pagination implements the cursor contract shared by the list
+// endpoints. A client asks for up to limit items in a named sort order and
+// gets back an opaque nextCursor, which it passes back unchanged to fetch the
+// following page; an empty nextCursor means there are no more items.
+//
+// Cursors are signed with CURSOR_SECRET, so a client cannot forge the
+// position a page resumes from.
+package pagination
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("cursor is invalid or was issued for a different sort")
+	ErrInvalidSort   = errors.New("unsupported sort")
+)
+
+var (
+	secretOnce sync.Once
+	secret     []byte
+	secretErr  error
+)
+
+// LoadSecret reads the key cursors are signed with from CURSOR_SECRET.
+// Servers call it at startup so a missing secret stops them there. Only with
+// ALLOW_EPHEMERAL_KEYS=true, meant for development, is a random key used
+// instead, and cursors then stop working when the server restarts or a
+// request lands on another instance.
+func LoadSecret() error {
+	secretOnce.Do(func() {
+		secret, secretErr = loadSecret()
+	})
+	return secretErr
+}
+
+func loadSecret() ([]byte, error) {
+	if configured := helpers.GetEnv("CURSOR_SECRET", ""); configured != "" {
+		return []byte(configured), nil
+	}
+
+	if !helpers.GetEnvBool("ALLOW_EPHEMERAL_KEYS", false) {
+		return nil, errors.New("CURSOR_SECRET is not set; set ALLOW_EPHEMERAL_KEYS=true to sign cursors with a random key")
+	}
+
+	logger.Warn("CURSOR_SECRET is not set, signing cursors with a random key that will not survive a restart")
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return random, nil
+}
+
+// cursorSecret returns the key loaded by LoadSecret. Signing with a key that
+// failed to load would make cursors forgeable, so it panics instead.
+func cursorSecret() []byte {
+	if err := LoadSecret(); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, cursorSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Params are the paging options a client sends, as query parameters on GET
+// endpoints or in the body of POST ones.
+type Params struct {
+	Limit  int    `json:"limit" query:"limit"`
+	Cursor string `json:"cursor" query:"cursor"`
+	Sort   string `json:"sort" query:"sort"`
+}
+
+// PageSize returns the requested limit, defaulting to DefaultLimit and
+// capped at MaxLimit.
+func (p Params) PageSize() int {
+	if p.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(p.Limit, MaxLimit)
+}
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// Cursor is the position a page ends at. Keyset sorts record the sort
+// field's value and the _id of the last item; sorts that cannot be resumed
+// by value, such as relevance, record an offset instead. Encoded cursors
+// carry a signature over these fields.
+type Cursor struct {
+	Sort   string      `json:"s"`
+	Value  interface{} `json:"v"`
+	ID     string      `json:"i,omitempty"`
+	Offset int         `json:"o,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(payload)
+}
+
+// Decode parses a cursor token issued for sort. An empty token is the start
+// of the list. Tokens that were not signed by this server are rejected.
+func Decode(token, sort string) (Cursor, error) {
+	if token == "" {
+		return Cursor{Sort: sort}, nil
+	}
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(payload))) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.Offset < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// OffsetCursor returns the token for the page starting offset items in.
+func OffsetCursor(sort string, offset int) string {
+	return Cursor{Sort: sort, Offset: offset}.Encode()
+}
+
+// Keyset orders documents by Field and then by _id in the same direction,
+// which gives every document a unique position a cursor can resume from
+// without skipping or repeating items when others are inserted. Field holds
+// numbers unless Text is set.
+type Keyset struct {
+	Field      string
+	Descending bool
+	Text       bool
+}
+
+// accepts reports whether value can be the Field value of a cursor: null,
+// for documents without the field, or a scalar of the field's type.
+// Anything else, such as an object smuggling in a query operator, is
+// rejected before it reaches a filter.
+func (k Keyset) accepts(value interface{}) bool {
+	switch rank, _, _ := sortKey(value); rank {
+	case 0:
+		return true
+	case 1:
+		return !k.Text
+	case 2:
+		return k.Text
+	}
+	return false
+}
+
+func (k Keyset) direction() int {
+	if k.Descending {
+		return -1
+	}
+	return 1
+}
+
+func (k Keyset) Sort() bson.D {
+	return bson.D{{Key: k.Field, Value: k.direction()}, {Key: "_id", Value: k.direction()}}
+}
+
+// After returns the filter selecting documents that come after cursor, or
+// nil at the start of the list.
+func (k Keyset) After(cursor Cursor) (bson.M, error) {
+	if cursor.ID == "" {
+		return nil, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil || !k.accepts(cursor.Value) {
+		return nil, ErrInvalidCursor
+	}
+
+	op := "$gt"
+	if k.Descending {
+		op = "$lt"
+	}
+
+	return bson.M{"$or": []bson.M{
+		{k.Field: bson.M{op: cursor.Value}},
+		{k.Field: cursor.Value, "_id": bson.M{op: id}},
+	}}, nil
+}
+
+// Next returns the token resuming after last, the final document of a page.
+func (k Keyset) Next(sort string, last bson.Raw) (string, error) {
+	id, ok := last.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", errors.New("document has no ObjectID _id")
+	}
+
+	var value interface{}
+	if raw, err := last.LookupErr(k.Field); err == nil {
+		if err := raw.Unmarshal(&value); err != nil {
+			return "", err
+		}
+	}
+
+	return Cursor{Sort: sort, Value: value, ID: id.Hex()}.Encode(), nil
+}
+
+// Where combines filter with the keyset condition for cursor.
+func (k Keyset) Where(filter bson.M, cursor Cursor) (bson.M, error) {
+	after, err := k.After(cursor)
+	if err != nil || after == nil {
+		return filter, err
+	}
+	return bson.M{"$and": []bson.M{filter, after}}, nil
+}
+
+// Trim decodes up to limit documents into T and, when one more than limit
+// was fetched, returns the cursor for the page that follows.
+func Trim[T any](docs []bson.Raw, limit int, sort string, keyset Keyset) (Page[T], error) {
+	page := Page[T]{Items: make([]T, 0, min(len(docs), limit))}
+
+	if len(docs) > limit {
+		docs = docs[:limit]
+		next, err := keyset.Next(sort, docs[len(docs)-1])
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = next
+	}
+
+	for _, doc := range docs {
+		var item T
+		if err := bson.Unmarshal(doc, &item); err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	return page, nil
+}
+
+// Find returns one page of the documents in coll matching filter, in the
+// keyset order registered as sort.
+func Find[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, sort string, keyset Keyset, params Params) (Page[T], error) {
+	cursor, err := Decode(params.Cursor, sort)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	filter, err = keyset.Where(filter, cursor)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	limit := params.PageSize()
+	results, err := coll.Find(ctx, filter, options.Find().SetSort(keyset.Sort()).SetLimit(int64(limit+1)))
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	var docs []bson.Raw
+	if err := results.All(ctx, &docs); err != nil {
+		return Page[T]{}, err
+	}
+
+	return Trim[T](docs, limit, sort, keyset)
+}
+
+// Slice returns one page of docs, which need not be sorted, in the keyset
+// order registered as sort. It gives stores that keep their documents in
+// memory the same paging Find gives collections.
+func Slice[T any](docs []bson.Raw, sort string, keyset Keyset, cursor Cursor, limit int) (Page[T], error) {
+	type position struct {
+		doc   bson.Raw
+		value interface{}
+		id    string
+	}
+
+	positions := make([]position, 0, len(docs))
+	for _, doc := range docs {
+		value, id := keyset.position(doc)
+		positions = append(positions, position{doc, value, id})
+	}
+	slices.SortFunc(positions, func(a, b position) int {
+		return keyset.compare(a.value, a.id, b.value, b.id)
+	})
+
+	if cursor.ID != "" {
+		if _, err := primitive.ObjectIDFromHex(cursor.ID); err != nil || !keyset.accepts(cursor.Value) {
+			return Page[T]{}, ErrInvalidCursor
+		}
+		start := len(positions)
+		for i, p := range positions {
+			if keyset.compare(p.value, p.id, cursor.Value, cursor.ID) > 0 {
+				start = i
+				break
+			}
+		}
+		positions = positions[start:]
+	}
+
+	page := make([]bson.Raw, 0, min(len(positions), limit+1))
+	for _, p := range positions[:min(len(positions), limit+1)] {
+		page = append(page, p.doc)
+	}
+
+	return Trim[T](page, limit, sort, keyset)
+}
+
+// position returns doc's sort field value and _id.
+func (k Keyset) position(doc bson.Raw) (interface{}, string) {
+	var value interface{}
+	if raw, err := doc.LookupErr(k.Field); err == nil {
+		raw.Unmarshal(&value)
+	}
+	id, _ := doc.Lookup("_id").ObjectIDOK()
+	return value, id.Hex()
+}
+
+// compare orders two keyset positions the way the keyset sorts them.
+func (k Keyset) compare(value1 interface{}, id1 string, value2 interface{}, id2 string) int {
+	c := compareValues(value1, value2)
+	if c == 0 {
+		c = strings.Compare(id1, id2)
+	}
+	if k.Descending {
+		return -c
+	}
+	return c
+}
+
+// compareValues orders values the way MongoDB does for the types sort
+// fields hold: missing and null first, then numbers, then strings.
+func compareValues(a, b interface{}) int {
+	rankA, numberA, stringA := sortKey(a)
+	rankB, numberB, stringB := sortKey(b)
+
+	switch {
+	case rankA != rankB:
+		return rankA - rankB
+	case rankA == 1:
+		if numberA < numberB {
+			return -1
+		}
+		if numberA > numberB {
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(stringA, stringB)
+	}
+}
+
+func sortKey(value interface{}) (int, float64, string) {
+	switch v := value.(type) {
+	case nil:
+		return 0, 0, ""
+	case int32:
+		return 1, float64(v), ""
+	case int64:
+		return 1, float64(v), ""
+	case int:
+		return 1, float64(v), ""
+	case float64:
+		return 1, v, ""
+	case string:
+		return 2, 0, v
+	}
+	return 3, 0, ""
+}
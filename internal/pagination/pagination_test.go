@@ -0,0 +1,148 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestMain lets the tests sign cursors with a random key, as the dev server
+// does.
+func TestMain(m *testing.M) {
+	os.Setenv("ALLOW_EPHEMERAL_KEYS", "true")
+	os.Exit(m.Run())
+}
+
+func TestLoadSecret(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		ephemeral string
+		wantErr   bool
+	}{
+		{name: "configured", secret: "s3cret", ephemeral: "false"},
+		{name: "missing", ephemeral: "false", wantErr: true},
+		{name: "missing but ephemeral allowed", ephemeral: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CURSOR_SECRET", tt.secret)
+			t.Setenv("ALLOW_EPHEMERAL_KEYS", tt.ephemeral)
+
+			key, err := loadSecret()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("loaded %d byte key, want an error", len(key))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.secret != "" && string(key) != tt.secret {
+				t.Errorf("key = %q, want %q", key, tt.secret)
+			}
+			if len(key) == 0 {
+				t.Error("loaded an empty key")
+			}
+		})
+	}
+}
+
+// unsigned encodes cursor the way a client forging one would, keeping the
+// signature of another cursor.
+func unsigned(t *testing.T, cursor interface{}, signature string) string {
+	t.Helper()
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." + signature
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	token := Cursor{Sort: "price_asc", Value: 9.99, ID: id}.Encode()
+
+	cursor, err := Decode(token, "price_asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Value != 9.99 || cursor.ID != id {
+		t.Errorf("decoded %+v", cursor)
+	}
+
+	if _, err := Decode(token, "price_desc"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor for another sort: error = %v, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func TestDecodeRejectsTamperedCursors(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	token := Cursor{Sort: "price_asc", Value: 9.99, ID: id}.Encode()
+	payload, signature, _ := strings.Cut(token, ".")
+
+	tests := map[string]string{
+		"changed value":     unsigned(t, Cursor{Sort: "price_asc", Value: 0.01, ID: id}, signature),
+		"operator as value": unsigned(t, map[string]interface{}{"s": "price_asc", "v": map[string]interface{}{"$ne": nil}, "i": id}, signature),
+		"no signature":      payload,
+		"empty signature":   payload + ".",
+		"other signature":   payload + "." + strings.Repeat("A", len(signature)),
+		"not base64":        "!!!." + signature,
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(token, "price_asc"); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestAfterRejectsValuesOfTheWrongType(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	price := Keyset{Field: "price"}
+	title := Keyset{Field: "title", Text: true}
+
+	tests := []struct {
+		name   string
+		keyset Keyset
+		value  interface{}
+		ok     bool
+	}{
+		{"number for a number field", price, 9.99, true},
+		{"null for a number field", price, nil, true},
+		{"string for a number field", price, "9.99", false},
+		{"string for a text field", title, "Berserk", true},
+		{"number for a text field", title, 1.0, false},
+		{"bool", price, true, false},
+		{"object", title, map[string]interface{}{"$gt": ""}, false},
+		{"array", price, []interface{}{1.0}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := test.keyset.After(Cursor{Value: test.value, ID: id})
+			if test.ok && (err != nil || filter == nil) {
+				t.Errorf("After = %v, %v; want a filter", filter, err)
+			}
+			if !test.ok && !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("After error = %v, want %v", err, ErrInvalidCursor)
+			}
+
+			_, err = Slice[bson.M](nil, "sort", test.keyset, Cursor{Value: test.value, ID: id}, 10)
+			if test.ok != (err == nil) {
+				t.Errorf("Slice error = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
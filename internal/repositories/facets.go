@@ -0,0 +1,37 @@
+package repositories
+
+import "manga_store/internal/models"
+
+// Price and rating facet boundaries. The last price bucket is open ended.
+var (
+	priceBucketBounds = []float64{0, 5, 10, 15, 20}
+	ratingFacetBounds = []float64{4, 3, 2, 1}
+)
+
+// facetValueLimit caps how many genres and authors a search facets on.
+const facetValueLimit = 30
+
+// priceBuckets pairs counts, one per entry in priceBucketBounds, with the
+// bucket each one counts.
+func priceBuckets(counts []int) []models.PriceBucket {
+	buckets := make([]models.PriceBucket, 0, len(priceBucketBounds))
+	for i, lower := range priceBucketBounds {
+		bucket := models.PriceBucket{Min: lower, Count: counts[i]}
+		if i+1 < len(priceBucketBounds) {
+			upper := priceBucketBounds[i+1]
+			bucket.Max = &upper
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// ratingBuckets pairs counts, one per entry in ratingFacetBounds, with the
+// minimum rating each one counts.
+func ratingBuckets(counts []int) []models.RatingBucket {
+	buckets := make([]models.RatingBucket, 0, len(ratingFacetBounds))
+	for i, bound := range ratingFacetBounds {
+		buckets = append(buckets, models.RatingBucket{MinRating: bound, Count: counts[i]})
+	}
+	return buckets
+}
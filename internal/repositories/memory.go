@@ -0,0 +1,340 @@
+package repositories
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"manga_store/internal/search"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStores returns empty stores that keep everything in process
+// memory. Graph events are applied to the graph as soon as the write they
+// belong to commits, so no relay is needed.
+func NewMemoryStores() Stores {
+	return newMemoryStores(false)
+}
+
+// NewQueuedMemoryStores returns memory stores whose graph events wait in the
+// outbox for a GraphSyncRelay, as they do over MongoDB.
+func NewQueuedMemoryStores() Stores {
+	return newMemoryStores(true)
+}
+
+func newMemoryStores(queued bool) Stores {
+	db := &memoryDB{
+		manga:  map[string]models.Manga{},
+		users:  map[string]models.User{},
+		orders: map[string]models.Order{},
+		graph:  NewMemoryGraphStore(),
+		queued: queued,
+	}
+
+	return Stores{
+		Tx:        db,
+		Manga:     MemoryMangaRepository{db: db},
+		Users:     MemoryUserRepository{db: db},
+		Orders:    MemoryOrderRepository{db: db},
+		Audit:     &MemoryAuditRepository{},
+		Outbox:    MemoryOutbox{db: db},
+		Graph:     db.graph,
+		Cache:     NewMemoryCache(),
+		Search:    search.NewMemoryIndex(search.DefaultBoosts),
+		Suggester: search.NewSuggester(),
+	}
+}
+
+// memoryDB holds the documents of the memory stores behind one lock. A
+// transaction holds the lock until it ends and restores a snapshot if it
+// fails, so transactions are serializable. Like a MongoDB transaction, one
+// whose context ends before it commits is rolled back.
+//
+// Documents are stored under their own ID, never the id a caller passed in:
+// fiber hands handlers strings backed by request buffers it reuses, and a
+// map key must not change under the map.
+type memoryDB struct {
+	mu      sync.Mutex
+	manga   map[string]models.Manga
+	users   map[string]models.User
+	orders  map[string]models.Order
+	events  []models.GraphEvent
+	pending []models.GraphEvent
+	graph   *MemoryGraphStore
+	queued  bool
+}
+
+type memoryTxKey struct{}
+
+func (db *memoryDB) inTransaction(ctx context.Context) bool {
+	return ctx.Value(memoryTxKey{}) == db
+}
+
+// lock takes the lock for one repository call and returns its release. A
+// call made inside a transaction already holds it.
+func (db *memoryDB) lock(ctx context.Context) func() {
+	if db.inTransaction(ctx) {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+func (db *memoryDB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if db.inTransaction(ctx) {
+		return fn(ctx)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	manga, users, orders := maps.Clone(db.manga), maps.Clone(db.users), maps.Clone(db.orders)
+	db.pending = nil
+
+	err := fn(context.WithValue(ctx, memoryTxKey{}, db))
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		db.manga, db.users, db.orders = manga, users, orders
+		db.pending = nil
+		return err
+	}
+
+	for _, event := range db.pending {
+		db.publish(event)
+	}
+	db.pending = nil
+
+	return nil
+}
+
+// publish applies a committed event to the graph, or queues it for the
+// relay when the stores are queued. Events are kept, marked processed once
+// applied, for tests to inspect.
+func (db *memoryDB) publish(event models.GraphEvent) {
+	if db.queued {
+		db.events = append(db.events, event)
+		return
+	}
+
+	event.Status = models.GraphEventProcessed
+	event.ProcessedAt = time.Now()
+	if err := db.graph.Apply(context.Background(), event); err != nil {
+		event.Status = models.GraphEventFailed
+		event.LastError = err.Error()
+	}
+	db.events = append(db.events, event)
+}
+
+// MemoryOutbox hands graph events straight to the memory graph, once the
+// transaction recording them commits. Queued stores keep them for the relay
+// instead.
+type MemoryOutbox struct {
+	db *memoryDB
+}
+
+func (o MemoryOutbox) Record(ctx context.Context, eventType models.GraphEventType, payload models.GraphEventPayload) error {
+	now := time.Now().Unix()
+	event := models.GraphEvent{
+		ID:            primitive.NewObjectID().Hex(),
+		Type:          eventType,
+		Payload:       payload,
+		Keys:          payload.Keys(),
+		Status:        models.GraphEventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	if o.db.inTransaction(ctx) {
+		o.db.pending = append(o.db.pending, event)
+		return nil
+	}
+
+	defer o.db.lock(ctx)()
+	o.db.publish(event)
+	return nil
+}
+
+func (o MemoryOutbox) Claim(ctx context.Context, lease time.Duration) (*models.GraphEvent, error) {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for i, event := range o.db.events {
+		if event.Status != models.GraphEventPending || event.NextAttemptAt > now || event.LockedUntil > now {
+			continue
+		}
+		if o.blocked(i) {
+			continue
+		}
+		event.LockedUntil = now + int64(lease.Seconds())
+		o.db.events[i] = event
+		return &event, nil
+	}
+	return nil, nil
+}
+
+// blocked reports whether an event earlier than the i-th one that shares a
+// key with it is still pending. Parked events hold nothing back, as in
+// MongoOutbox.
+func (o MemoryOutbox) blocked(i int) bool {
+	for _, earlier := range o.db.events[:i] {
+		if earlier.Status != models.GraphEventPending {
+			continue
+		}
+		for _, key := range earlier.Keys {
+			if slices.Contains(o.db.events[i].Keys, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o MemoryOutbox) Complete(ctx context.Context, id string) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	return o.update(id, func(event *models.GraphEvent) {
+		event.Status = models.GraphEventProcessed
+		event.ProcessedAt = time.Now()
+		event.LockedUntil = 0
+		event.Attempts++
+	})
+}
+
+func (o MemoryOutbox) Fail(ctx context.Context, failed models.GraphEvent) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	return o.update(failed.ID, func(event *models.GraphEvent) {
+		event.Status = failed.Status
+		event.Attempts = failed.Attempts
+		event.LastError = failed.LastError
+		event.NextAttemptAt = failed.NextAttemptAt
+		event.LockedUntil = 0
+	})
+}
+
+func (o MemoryOutbox) update(id string, change func(event *models.GraphEvent)) error {
+	for i := range o.db.events {
+		if o.db.events[i].ID == id {
+			change(&o.db.events[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Events returns every graph event recorded so far, oldest first.
+func (o MemoryOutbox) Events() []models.GraphEvent {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	return append([]models.GraphEvent{}, o.db.events...)
+}
+
+type MemoryAuditRepository struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (r *MemoryAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = primitive.NewObjectID().Hex()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// Entries returns every audit entry recorded so far, oldest first.
+func (r *MemoryAuditRepository) Entries() []models.AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.AuditEntry{}, r.entries...)
+}
+
+// rawDocument encodes v the way MongoDB would store it, with the hex id as
+// an ObjectID _id, so memory stores can share the pagination helpers.
+func rawDocument(v interface{}, id string) (bson.Raw, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range doc {
+		if doc[i].Key == "_id" {
+			doc[i].Value = objectID
+		}
+	}
+
+	return bson.Marshal(doc)
+}
+
+func newID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// The clone functions copy a document deeply, so callers can never change
+// what a memory store holds except through the store.
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+func cloneManga(manga models.Manga) models.Manga {
+	manga.Genres = cloneStrings(manga.Genres)
+	return manga
+}
+
+func cloneUser(user models.User) models.User {
+	if user.PurchaseHistory != nil {
+		user.PurchaseHistory = append([]models.Purchase{}, user.PurchaseHistory...)
+	}
+	if user.Ratings != nil {
+		user.Ratings = append([]models.Rating{}, user.Ratings...)
+	}
+	if user.Roles != nil {
+		user.Roles = append([]models.Role{}, user.Roles...)
+	}
+	if user.TwoFactor != nil {
+		twoFactor := *user.TwoFactor
+		twoFactor.RecoveryCodes = cloneStrings(twoFactor.RecoveryCodes)
+		user.TwoFactor = &twoFactor
+	}
+	return user
+}
+
+func cloneOrder(order models.Order) models.Order {
+	if order.Items != nil {
+		items := make([]models.OrderItem, len(order.Items))
+		for i, item := range order.Items {
+			item.Genres = cloneStrings(item.Genres)
+			items[i] = item
+		}
+		order.Items = items
+	}
+	if order.StatusHistory != nil {
+		order.StatusHistory = append([]models.OrderStatusChange{}, order.StatusHistory...)
+	}
+	return order
+}
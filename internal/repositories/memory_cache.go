@@ -0,0 +1,353 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errWrongType = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+
+// MemoryCache keeps the cache in a map. Keys expire lazily, the next time
+// they are read. Everything stored is copied first, since the strings
+// callers pass may be backed by fiber's reused request buffers.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	value     *string
+	set       map[string]bool
+	hash      map[string]string
+	window    []time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]*cacheEntry{}}
+}
+
+// entry returns the live entry for key, or nil.
+func (c *MemoryCache) entry(key string) *cacheEntry {
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *MemoryCache) expire(entry *cacheEntry, ttl time.Duration) {
+	entry.expiresAt = time.Time{}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return "", ErrCacheMiss
+	}
+	if entry.value == nil {
+		return "", errWrongType
+	}
+	return *entry.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value = strings.Clone(value)
+	entry := &cacheEntry{value: &value}
+	c.expire(entry, ttl)
+	c.entries[strings.Clone(key)] = entry
+	return nil
+}
+
+func (c *MemoryCache) GetDel(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return "", ErrCacheMiss
+	}
+	if entry.value == nil {
+		return "", errWrongType
+	}
+	delete(c.entries, key)
+	return *entry.value, nil
+}
+
+func (c *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entry(key) != nil, nil
+}
+
+func (c *MemoryCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return nil
+	}
+	if ttl <= 0 {
+		delete(c.entries, key)
+		return nil
+	}
+	c.expire(entry, ttl)
+	return nil
+}
+
+func (c *MemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil || entry.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(entry.expiresAt), nil
+}
+
+func (c *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		entry = &cacheEntry{value: new(string)}
+		c.entries[strings.Clone(key)] = entry
+	}
+	if entry.value == nil {
+		return 0, errWrongType
+	}
+
+	var count int64
+	if *entry.value != "" {
+		parsed, err := strconv.ParseInt(*entry.value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		count = parsed
+	}
+	count++
+	*entry.value = strconv.FormatInt(count, 10)
+
+	return count, nil
+}
+
+func (c *MemoryCache) SAdd(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		entry = &cacheEntry{set: map[string]bool{}}
+		c.entries[strings.Clone(key)] = entry
+	}
+	if entry.set == nil {
+		return errWrongType
+	}
+	for _, member := range members {
+		entry.set[strings.Clone(member)] = true
+	}
+	if ttl > 0 {
+		c.expire(entry, ttl)
+	}
+	return nil
+}
+
+func (c *MemoryCache) SRem(ctx context.Context, key string, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return nil
+	}
+	if entry.set == nil {
+		return errWrongType
+	}
+	for _, member := range members {
+		delete(entry.set, member)
+	}
+	if len(entry.set) == 0 {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+func (c *MemoryCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return []string{}, nil
+	}
+	if entry.set == nil {
+		return nil, errWrongType
+	}
+
+	members := make([]string, 0, len(entry.set))
+	for member := range entry.set {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+	return members, nil
+}
+
+func (c *MemoryCache) HSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		entry = &cacheEntry{hash: map[string]string{}}
+		c.entries[strings.Clone(key)] = entry
+	}
+	if entry.hash == nil {
+		return errWrongType
+	}
+	entry.hash[strings.Clone(field)] = strings.Clone(value)
+	if ttl > 0 {
+		c.expire(entry, ttl)
+	}
+	return nil
+}
+
+func (c *MemoryCache) HGet(ctx context.Context, key, field string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return "", ErrCacheMiss
+	}
+	if entry.hash == nil {
+		return "", errWrongType
+	}
+	value, ok := entry.hash[field]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (c *MemoryCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return map[string]string{}, nil
+	}
+	if entry.hash == nil {
+		return nil, errWrongType
+	}
+
+	hash := make(map[string]string, len(entry.hash))
+	for field, value := range entry.hash {
+		hash[field] = value
+	}
+	return hash, nil
+}
+
+func (c *MemoryCache) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return 0, nil
+	}
+	if entry.hash == nil {
+		return 0, errWrongType
+	}
+
+	var deleted int64
+	for _, field := range fields {
+		if _, ok := entry.hash[field]; ok {
+			delete(entry.hash, field)
+			deleted++
+		}
+	}
+	if len(entry.hash) == 0 {
+		delete(c.entries, key)
+	}
+	return deleted, nil
+}
+
+func (c *MemoryCache) HExists(ctx context.Context, key, field string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(key)
+	if entry == nil {
+		return false, nil
+	}
+	if entry.hash == nil {
+		return false, errWrongType
+	}
+	_, ok := entry.hash[field]
+	return ok, nil
+}
+
+func (c *MemoryCache) SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (Window, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entry := c.entry(key)
+	if entry == nil {
+		entry = &cacheEntry{window: []time.Time{}}
+		c.entries[strings.Clone(key)] = entry
+	}
+	if entry.window == nil {
+		return Window{}, errWrongType
+	}
+
+	entry.window = slices.DeleteFunc(entry.window, func(at time.Time) bool {
+		return !at.After(now.Add(-window))
+	})
+
+	admitted := int64(len(entry.window)) < limit
+	if admitted {
+		entry.window = append(entry.window, now)
+	}
+	c.expire(entry, window)
+
+	oldest := now
+	if len(entry.window) > 0 {
+		oldest = entry.window[0]
+	}
+
+	return Window{Admitted: admitted, Count: int64(len(entry.window)), Oldest: oldest}, nil
+}
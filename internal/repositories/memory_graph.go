@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryGraphStore keeps the recommendation graph in maps and answers the
+// recommendation queries with the same ranking the Cypher uses.
+type MemoryGraphStore struct {
+	mu        sync.RWMutex
+	users     map[string]string
+	manga     map[string]models.GraphManga
+	viewed    map[string]map[string]bool
+	purchased map[string]map[string]bool
+	rated     map[string]map[string]float64
+}
+
+func NewMemoryGraphStore() *MemoryGraphStore {
+	return &MemoryGraphStore{
+		users:     map[string]string{},
+		manga:     map[string]models.GraphManga{},
+		viewed:    map[string]map[string]bool{},
+		purchased: map[string]map[string]bool{},
+		rated:     map[string]map[string]float64{},
+	}
+}
+
+func (g *MemoryGraphStore) Apply(ctx context.Context, event models.GraphEvent) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	userID := event.Payload.UserID
+
+	switch event.Type {
+	case models.GraphEventMangaUpserted:
+		for _, manga := range event.Payload.Manga {
+			manga.Genres = cloneStrings(manga.Genres)
+			g.manga[manga.ID] = manga
+		}
+	case models.GraphEventMangaDeleted:
+		for _, manga := range event.Payload.Manga {
+			delete(g.manga, manga.ID)
+			for _, edges := range g.viewed {
+				delete(edges, manga.ID)
+			}
+			for _, edges := range g.purchased {
+				delete(edges, manga.ID)
+			}
+			for _, edges := range g.rated {
+				delete(edges, manga.ID)
+			}
+		}
+	case models.GraphEventUserUpserted:
+		g.users[userID] = event.Payload.Email
+	case models.GraphEventUserDeleted:
+		delete(g.users, userID)
+		delete(g.viewed, userID)
+		delete(g.purchased, userID)
+		delete(g.rated, userID)
+	case models.GraphEventMangaViewed:
+		g.mergeUser(userID)
+		for _, manga := range event.Payload.Manga {
+			g.mergeManga(manga)
+			g.viewed[userID][manga.ID] = true
+		}
+	case models.GraphEventMangaPurchased:
+		g.mergeUser(userID)
+		for _, manga := range event.Payload.Manga {
+			g.mergeManga(manga)
+			g.purchased[userID][manga.ID] = true
+		}
+	case models.GraphEventPurchaseRemoved:
+		for _, manga := range event.Payload.Manga {
+			delete(g.purchased[userID], manga.ID)
+		}
+	case models.GraphEventMangaRated:
+		g.mergeUser(userID)
+		for _, manga := range event.Payload.Manga {
+			g.mergeManga(manga)
+			g.rated[userID][manga.ID] = event.Payload.Score
+		}
+	case models.GraphEventRatingRemoved:
+		for _, manga := range event.Payload.Manga {
+			delete(g.rated[userID], manga.ID)
+		}
+	default:
+		return errors.New("unknown graph event type " + string(event.Type))
+	}
+
+	return nil
+}
+
+func (g *MemoryGraphStore) mergeUser(userID string) {
+	if _, ok := g.users[userID]; !ok {
+		g.users[userID] = ""
+	}
+	if g.viewed[userID] == nil {
+		g.viewed[userID] = map[string]bool{}
+		g.purchased[userID] = map[string]bool{}
+		g.rated[userID] = map[string]float64{}
+	}
+}
+
+func (g *MemoryGraphStore) mergeManga(manga models.GraphManga) {
+	if _, ok := g.manga[manga.ID]; !ok {
+		manga.Genres = cloneStrings(manga.Genres)
+		g.manga[manga.ID] = manga
+	}
+}
+
+// Rating returns the score of the RATED edge from a user to a manga, and
+// whether there is one.
+func (g *MemoryGraphStore) Rating(userID, mangaID string) (float64, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	score, ok := g.rated[userID][mangaID]
+	return score, ok
+}
+
+// Purchased reports whether there is a PURCHASED edge from a user to a manga.
+func (g *MemoryGraphStore) Purchased(userID, mangaID string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.purchased[userID][mangaID]
+}
+
+// seen reports whether the user has rated or bought a manga, which keeps
+// it out of their recommendations.
+func (g *MemoryGraphStore) seen(userID, mangaID string) bool {
+	_, rated := g.rated[userID][mangaID]
+	return rated || g.purchased[userID][mangaID]
+}
+
+type recommendation struct {
+	id    string
+	score float64
+	count int
+}
+
+// rank orders recommendations by score and count, highest first, then by
+// ID, and returns the page from skip.
+func rank(recommendations []recommendation, skip, limit int) []string {
+	slices.SortFunc(recommendations, func(a, b recommendation) int {
+		switch {
+		case a.score != b.score:
+			if a.score > b.score {
+				return -1
+			}
+			return 1
+		case a.count != b.count:
+			return b.count - a.count
+		}
+		return strings.Compare(a.id, b.id)
+	})
+
+	ids := []string{}
+	for _, r := range recommendations[min(skip, len(recommendations)):] {
+		if len(ids) == limit {
+			break
+		}
+		ids = append(ids, r.id)
+	}
+	return ids
+}
+
+func (g *MemoryGraphStore) RecommendByPreferences(ctx context.Context, userID string, skip, limit int) ([]string, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	userGenres := map[string]bool{}
+	for mangaID, score := range g.rated[userID] {
+		if score > 4 {
+			for _, genre := range g.manga[mangaID].Genres {
+				userGenres[genre] = true
+			}
+		}
+	}
+	if len(userGenres) == 0 {
+		return nil, nil
+	}
+
+	var recommendations []recommendation
+	for id, manga := range g.manga {
+		if g.seen(userID, id) {
+			continue
+		}
+		shared := 0
+		for _, genre := range manga.Genres {
+			if userGenres[genre] {
+				shared++
+			}
+		}
+		if shared > 0 {
+			recommendations = append(recommendations, recommendation{id: id, score: float64(shared)})
+		}
+	}
+
+	return rank(recommendations, skip, limit), nil
+}
+
+func (g *MemoryGraphStore) RecommendBySimilarUsers(ctx context.Context, userID string, skip, limit int) ([]string, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	totals := map[string]*recommendation{}
+	for mangaID, score := range g.rated[userID] {
+		if score <= 4 {
+			continue
+		}
+		for otherID, ratings := range g.rated {
+			if otherID == userID || ratings[mangaID] <= 4 {
+				continue
+			}
+			for similarID, similarScore := range ratings {
+				if g.seen(userID, similarID) {
+					continue
+				}
+				if totals[similarID] == nil {
+					totals[similarID] = &recommendation{id: similarID}
+				}
+				totals[similarID].score += similarScore
+				totals[similarID].count++
+			}
+		}
+	}
+
+	recommendations := make([]recommendation, 0, len(totals))
+	for _, total := range totals {
+		recommendations = append(recommendations, recommendation{
+			id:    total.id,
+			score: total.score / float64(total.count),
+			count: total.count,
+		})
+	}
+
+	return rank(recommendations, skip, limit), nil
+}
+
+func (g *MemoryGraphStore) Snapshot(ctx context.Context) (*models.GraphSnapshot, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	snapshot := &models.GraphSnapshot{}
+	for _, manga := range g.manga {
+		manga.Genres = cloneStrings(manga.Genres)
+		snapshot.Manga = append(snapshot.Manga, manga)
+	}
+	for id, email := range g.users {
+		snapshot.Users = append(snapshot.Users, models.GraphUser{ID: id, Email: email})
+	}
+	for userID, edges := range g.rated {
+		for mangaID, score := range edges {
+			snapshot.Ratings = append(snapshot.Ratings, models.GraphRating{UserID: userID, MangaID: mangaID, Score: score})
+		}
+	}
+	for userID, edges := range g.purchased {
+		for mangaID := range edges {
+			snapshot.Purchases = append(snapshot.Purchases, models.GraphPurchase{UserID: userID, MangaID: mangaID})
+		}
+	}
+
+	return snapshot, nil
+}
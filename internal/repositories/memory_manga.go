@@ -0,0 +1,386 @@
+package repositories
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type MemoryMangaRepository struct {
+	db *memoryDB
+}
+
+// active returns the manga matching keep that have not been deleted, in
+// insertion order.
+func (r MemoryMangaRepository) active(keep func(models.Manga) bool) []models.Manga {
+	mangas := []models.Manga{}
+	for _, manga := range r.db.manga {
+		if !manga.IsDeleted && (keep == nil || keep(manga)) {
+			mangas = append(mangas, cloneManga(manga))
+		}
+	}
+	slices.SortFunc(mangas, func(a, b models.Manga) int { return strings.Compare(a.ID, b.ID) })
+	return mangas
+}
+
+func (r MemoryMangaRepository) Get(ctx context.Context, id string) (*models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok || manga.IsDeleted {
+		return nil, ErrNotFound
+	}
+	manga = cloneManga(manga)
+	return &manga, nil
+}
+
+func (r MemoryMangaRepository) GetWithDeleted(ctx context.Context, id string) (*models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	manga = cloneManga(manga)
+	return &manga, nil
+}
+
+func (r MemoryMangaRepository) Find(ctx context.Context, ids []string) ([]models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	return r.active(func(manga models.Manga) bool { return wanted[manga.ID] }), nil
+}
+
+func (r MemoryMangaRepository) All(ctx context.Context) ([]models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	return r.active(nil), nil
+}
+
+func (r MemoryMangaRepository) List(ctx context.Context, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Manga], error) {
+	defer r.db.lock(ctx)()
+
+	cursor, err := pagination.Decode(params.Cursor, sort)
+	if err != nil {
+		return pagination.Page[models.Manga]{}, err
+	}
+
+	docs, err := mangaDocuments(r.active(nil))
+	if err != nil {
+		return pagination.Page[models.Manga]{}, err
+	}
+
+	return pagination.Slice[models.Manga](docs, sort, keyset, cursor, params.PageSize())
+}
+
+func (r MemoryMangaRepository) Popular(ctx context.Context, limit int) ([]models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	mangas := r.active(nil)
+	slices.SortStableFunc(mangas, func(a, b models.Manga) int {
+		if a.Sold != b.Sold {
+			return b.Sold - a.Sold
+		}
+		return b.Views - a.Views
+	})
+
+	return mangas[:min(len(mangas), limit)], nil
+}
+
+func (r MemoryMangaRepository) Trash(ctx context.Context) ([]models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	mangas := []models.Manga{}
+	for _, manga := range r.db.manga {
+		if manga.IsDeleted {
+			mangas = append(mangas, cloneManga(manga))
+		}
+	}
+	slices.SortFunc(mangas, func(a, b models.Manga) int { return b.DeletedAt - a.DeletedAt })
+
+	return mangas, nil
+}
+
+func (r MemoryMangaRepository) Create(ctx context.Context, manga models.Manga) (*models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	if manga.ID == "" {
+		manga.ID = newID()
+	}
+	r.db.manga[manga.ID] = cloneManga(manga)
+
+	return &manga, nil
+}
+
+func (r MemoryMangaRepository) Update(ctx context.Context, id string, update models.UpdateMangaRequest, updatedAt int) (*models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok || manga.IsDeleted {
+		return nil, ErrNotFound
+	}
+	if manga.Version != *update.Version {
+		return nil, ErrVersionConflict
+	}
+
+	manga = cloneManga(manga)
+	if update.Title != nil {
+		manga.Title = *update.Title
+	}
+	if update.Author != nil {
+		manga.Author = *update.Author
+	}
+	if update.Description != nil {
+		manga.Description = *update.Description
+	}
+	if update.ImageURL != nil {
+		manga.ImageURL = *update.ImageURL
+	}
+	if update.Genres != nil {
+		manga.Genres = cloneStrings(*update.Genres)
+	}
+	if update.Price != nil {
+		manga.Price = *update.Price
+	}
+	if update.Quantity != nil {
+		manga.Quantity = *update.Quantity
+	}
+	manga.UpdatedAt = updatedAt
+	manga.Version++
+	r.db.manga[manga.ID] = manga
+
+	manga = cloneManga(manga)
+	return &manga, nil
+}
+
+func (r MemoryMangaRepository) Delete(ctx context.Context, id string, deletedAt int) error {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok || manga.IsDeleted {
+		return ErrNotFound
+	}
+	manga.IsDeleted = true
+	manga.DeletedAt = deletedAt
+	r.db.manga[manga.ID] = manga
+
+	return nil
+}
+
+func (r MemoryMangaRepository) Restore(ctx context.Context, id string, restoredAt int) (*models.Manga, error) {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok || !manga.IsDeleted {
+		return nil, ErrNotFound
+	}
+	manga.IsDeleted = false
+	manga.DeletedAt = 0
+	manga.UpdatedAt = restoredAt
+	manga.Version++
+	r.db.manga[manga.ID] = manga
+
+	manga = cloneManga(manga)
+	return &manga, nil
+}
+
+func (r MemoryMangaRepository) Purge(ctx context.Context, deletedBefore int) (int64, error) {
+	defer r.db.lock(ctx)()
+
+	var purged int64
+	for id, manga := range r.db.manga {
+		if manga.IsDeleted && manga.DeletedAt <= deletedBefore {
+			delete(r.db.manga, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (r MemoryMangaRepository) IncrementViews(ctx context.Context, id string) error {
+	defer r.db.lock(ctx)()
+
+	if manga, ok := r.db.manga[id]; ok && !manga.IsDeleted {
+		manga.Views++
+		r.db.manga[manga.ID] = manga
+	}
+	return nil
+}
+
+func (r MemoryMangaRepository) SetRating(ctx context.Context, id string, rating float64, ratedTimes int) error {
+	defer r.db.lock(ctx)()
+
+	if manga, ok := r.db.manga[id]; ok {
+		manga.Rating = rating
+		manga.RatedTimes = ratedTimes
+		r.db.manga[manga.ID] = manga
+	}
+	return nil
+}
+
+func (r MemoryMangaRepository) ReserveStock(ctx context.Context, id string, quantity int) (bool, error) {
+	defer r.db.lock(ctx)()
+
+	manga, ok := r.db.manga[id]
+	if !ok || manga.IsDeleted || manga.Quantity < quantity {
+		return false, nil
+	}
+	manga.Quantity -= quantity
+	manga.Sold += quantity
+	r.db.manga[manga.ID] = manga
+
+	return true, nil
+}
+
+func (r MemoryMangaRepository) ReleaseStock(ctx context.Context, id string, quantity int) error {
+	defer r.db.lock(ctx)()
+
+	if manga, ok := r.db.manga[id]; ok {
+		manga.Quantity += quantity
+		manga.Sold -= quantity
+		r.db.manga[manga.ID] = manga
+	}
+	return nil
+}
+
+func (r MemoryMangaRepository) Search(ctx context.Context, query MangaSearch) (*models.SearchMangaResponse, error) {
+	defer r.db.lock(ctx)()
+
+	response := &models.SearchMangaResponse{Items: []models.Manga{}}
+
+	rank := map[string]int{}
+	for i, id := range query.Ranked {
+		rank[id] = i
+	}
+	matches := r.active(func(manga models.Manga) bool {
+		if query.Ranked != nil {
+			if _, ok := rank[manga.ID]; !ok {
+				return false
+			}
+		}
+		return matchesSearch(manga, query.Request)
+	})
+
+	if query.ByRank {
+		slices.SortFunc(matches, func(a, b models.Manga) int { return rank[a.ID] - rank[b.ID] })
+		results := matches[min(query.Cursor.Offset, len(matches)):]
+		if len(results) > query.Limit {
+			results = results[:query.Limit]
+			response.NextCursor = pagination.OffsetCursor(query.Sort, query.Cursor.Offset+query.Limit)
+		}
+		response.Items = append(response.Items, results...)
+	} else {
+		docs, err := mangaDocuments(matches)
+		if err != nil {
+			return nil, err
+		}
+		page, err := pagination.Slice[models.Manga](docs, query.Sort, query.Keyset, query.Cursor, query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		response.Items, response.NextCursor = page.Items, page.NextCursor
+	}
+
+	genres, authors := map[string]int{}, map[string]int{}
+	priceCounts := make([]int, len(priceBucketBounds))
+	ratingCounts := make([]int, len(ratingFacetBounds))
+	for _, manga := range matches {
+		for _, genre := range manga.Genres {
+			genres[genre]++
+		}
+		authors[manga.Author]++
+
+		bucket := len(priceBucketBounds) - 1
+		for i := 0; i+1 < len(priceBucketBounds); i++ {
+			if manga.Price >= priceBucketBounds[i] && manga.Price < priceBucketBounds[i+1] {
+				bucket = i
+			}
+		}
+		priceCounts[bucket]++
+
+		for i, bound := range ratingFacetBounds {
+			if manga.Rating >= bound {
+				ratingCounts[i]++
+			}
+		}
+
+		if manga.Quantity > 0 {
+			response.Facets.InStock++
+		} else {
+			response.Facets.OutOfStock++
+		}
+	}
+
+	response.Total = len(matches)
+	response.Facets.Genres = facetCounts(genres)
+	response.Facets.Authors = facetCounts(authors)
+	response.Facets.Price = priceBuckets(priceCounts)
+	response.Facets.Rating = ratingBuckets(ratingCounts)
+
+	return response, nil
+}
+
+// matchesSearch applies the structured filters of a search the way
+// searchFilter does for MongoDB.
+func matchesSearch(manga models.Manga, request models.SearchMangaRequest) bool {
+	for _, genre := range request.Genres {
+		if !slices.Contains(manga.Genres, genre) {
+			return false
+		}
+	}
+	if author := strings.TrimSpace(request.Author); author != "" {
+		if !strings.Contains(strings.ToLower(manga.Author), strings.ToLower(author)) {
+			return false
+		}
+	}
+	if request.MinPrice != nil && manga.Price < *request.MinPrice {
+		return false
+	}
+	if request.MaxPrice != nil && manga.Price > *request.MaxPrice {
+		return false
+	}
+	if request.MinRating != nil && manga.Rating < *request.MinRating {
+		return false
+	}
+	if request.InStock && manga.Quantity <= 0 {
+		return false
+	}
+	return true
+}
+
+// facetCounts returns the most common values first, as $sortByCount does.
+func facetCounts(counts map[string]int) []models.FacetCount {
+	facets := make([]models.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, models.FacetCount{Value: value, Count: count})
+	}
+	slices.SortFunc(facets, func(a, b models.FacetCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+
+	return facets[:min(len(facets), facetValueLimit)]
+}
+
+func mangaDocuments(mangas []models.Manga) ([]bson.Raw, error) {
+	docs := make([]bson.Raw, 0, len(mangas))
+	for _, manga := range mangas {
+		doc, err := rawDocument(manga, manga.ID)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type MemoryOrderRepository struct {
+	db *memoryDB
+}
+
+func (r MemoryOrderRepository) find(keep func(models.Order) bool) []models.Order {
+	orders := []models.Order{}
+	for _, order := range r.db.orders {
+		if keep(order) {
+			orders = append(orders, cloneOrder(order))
+		}
+	}
+	slices.SortFunc(orders, func(a, b models.Order) int {
+		if a.CreatedAt != b.CreatedAt {
+			return b.CreatedAt - a.CreatedAt
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	return orders
+}
+
+func (r MemoryOrderRepository) Create(ctx context.Context, order models.Order) (*models.Order, error) {
+	defer r.db.lock(ctx)()
+
+	if order.ID == "" {
+		order.ID = newID()
+	}
+	r.db.orders[order.ID] = cloneOrder(order)
+
+	return &order, nil
+}
+
+func (r MemoryOrderRepository) Get(ctx context.Context, id string) (*models.Order, error) {
+	defer r.db.lock(ctx)()
+
+	order, ok := r.db.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	order = cloneOrder(order)
+	return &order, nil
+}
+
+func (r MemoryOrderRepository) ForUser(ctx context.Context, userID string) ([]models.Order, error) {
+	defer r.db.lock(ctx)()
+
+	return r.find(func(order models.Order) bool { return order.UserID == userID }), nil
+}
+
+func (r MemoryOrderRepository) List(ctx context.Context, filter OrderFilter, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Order], error) {
+	defer r.db.lock(ctx)()
+
+	cursor, err := pagination.Decode(params.Cursor, sort)
+	if err != nil {
+		return pagination.Page[models.Order]{}, err
+	}
+
+	orders := r.find(func(order models.Order) bool {
+		return (filter.UserID == "" || order.UserID == filter.UserID) &&
+			(filter.Status == "" || order.Status == filter.Status)
+	})
+
+	docs := make([]bson.Raw, 0, len(orders))
+	for _, order := range orders {
+		doc, err := rawDocument(order, order.ID)
+		if err != nil {
+			return pagination.Page[models.Order]{}, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return pagination.Slice[models.Order](docs, sort, keyset, cursor, params.PageSize())
+}
+
+func (r MemoryOrderRepository) Transition(ctx context.Context, id string, from models.OrderStatus, change models.OrderStatusChange) (*models.Order, error) {
+	defer r.db.lock(ctx)()
+
+	order, ok := r.db.orders[id]
+	if !ok || order.Status != from {
+		return nil, ErrNotFound
+	}
+	order = cloneOrder(order)
+	order.Status = change.Status
+	order.UpdatedAt = change.ChangedAt
+	order.StatusHistory = append(order.StatusHistory, change)
+	r.db.orders[order.ID] = order
+
+	order = cloneOrder(order)
+	return &order, nil
+}
+
+func (r MemoryOrderRepository) Buyers(ctx context.Context, mangaID string) ([]string, error) {
+	defer r.db.lock(ctx)()
+
+	seen := map[string]bool{}
+	buyers := []string{}
+	for _, order := range r.find(func(order models.Order) bool { return order.Status.Active() }) {
+		for _, item := range order.Items {
+			if item.MangaID == mangaID && !seen[order.UserID] {
+				seen[order.UserID] = true
+				buyers = append(buyers, order.UserID)
+			}
+		}
+	}
+
+	return buyers, nil
+}
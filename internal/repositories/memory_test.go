@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryTransactionRollsBack(t *testing.T) {
+	stores := NewMemoryStores()
+	ctx := context.Background()
+
+	manga, err := stores.Manga.Create(ctx, models.Manga{Title: "Dorohedoro", Quantity: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	err = stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := stores.Manga.ReserveStock(ctx, manga.ID, 2); err != nil {
+			return err
+		}
+		if err := stores.Outbox.Record(ctx, models.GraphEventMangaPurchased, models.GraphEventPayload{UserID: "u1"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("err = %v, want %v", err, failed)
+	}
+
+	got, err := stores.Manga.Get(ctx, manga.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Quantity != 2 || got.Sold != 0 {
+		t.Errorf("quantity = %d, sold = %d after rollback, want 2 and 0", got.Quantity, got.Sold)
+	}
+	if events := stores.Outbox.(MemoryOutbox).Events(); len(events) != 0 {
+		t.Errorf("published %d graph events from a rolled back transaction", len(events))
+	}
+}
+
+func TestMemoryGraphRecommendations(t *testing.T) {
+	graph := NewMemoryGraphStore()
+	ctx := context.Background()
+
+	rate := func(userID string, manga models.GraphManga, score float64) {
+		t.Helper()
+		err := graph.Apply(ctx, models.GraphEvent{
+			Type:    models.GraphEventMangaRated,
+			Payload: models.GraphEventPayload{UserID: userID, Manga: []models.GraphManga{manga}, Score: score},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	berserk := models.GraphManga{ID: "berserk", Genres: []string{"dark fantasy", "action"}}
+	claymore := models.GraphManga{ID: "claymore", Genres: []string{"dark fantasy", "action"}}
+	vinland := models.GraphManga{ID: "vinland", Genres: []string{"action", "history"}}
+	yotsuba := models.GraphManga{ID: "yotsuba", Genres: []string{"comedy"}}
+
+	rate("alice", berserk, 5)
+	rate("bob", berserk, 4.5)
+	rate("bob", vinland, 5)
+	rate("bob", claymore, 4)
+	rate("carol", yotsuba, 5)
+
+	byPreferences, err := graph.RecommendByPreferences(ctx, "alice", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"claymore", "vinland"}; !slices.Equal(byPreferences, want) {
+		t.Errorf("by preferences = %v, want %v", byPreferences, want)
+	}
+
+	bySimilarUsers, err := graph.RecommendBySimilarUsers(ctx, "alice", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vinland", "claymore"}; !slices.Equal(bySimilarUsers, want) {
+		t.Errorf("by similar users = %v, want %v", bySimilarUsers, want)
+	}
+}
+
+func TestMemoryCacheSlidingWindow(t *testing.T) {
+	cache := NewMemoryCache()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		w, err := cache.SlidingWindow(ctx, "ratelimit:test", 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if admitted := i < 2; w.Admitted != admitted || w.Count != int64(min(i+1, 2)) {
+			t.Errorf("request %d: admitted = %v with count %d, want %v with count %d", i+1, w.Admitted, w.Count, admitted, min(i+1, 2))
+		}
+	}
+
+	if err := cache.Set(ctx, "session", "user", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := cache.Get(ctx, "session"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expired key: err = %v, want ErrCacheMiss", err)
+	}
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+type MemoryUserRepository struct {
+	db *memoryDB
+}
+
+// update applies change to a copy of the user with id and stores it, if
+// there is such a user and match accepts it. It reports whether it did.
+func (r MemoryUserRepository) update(ctx context.Context, id string, match func(models.User) bool, change func(*models.User)) bool {
+	defer r.db.lock(ctx)()
+
+	user, ok := r.db.users[id]
+	if !ok || (match != nil && !match(user)) {
+		return false
+	}
+	user = cloneUser(user)
+	change(&user)
+	r.db.users[user.ID] = user
+
+	return true
+}
+
+func (r MemoryUserRepository) find(ctx context.Context, keep func(models.User) bool) []models.User {
+	defer r.db.lock(ctx)()
+
+	users := []models.User{}
+	for _, user := range r.db.users {
+		if keep(user) {
+			users = append(users, cloneUser(user))
+		}
+	}
+	slices.SortFunc(users, func(a, b models.User) int { return strings.Compare(a.ID, b.ID) })
+
+	return users
+}
+
+func (r MemoryUserRepository) Get(ctx context.Context, id string) (*models.User, error) {
+	defer r.db.lock(ctx)()
+
+	user, ok := r.db.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r MemoryUserRepository) GetActive(ctx context.Context, id string) (*models.User, error) {
+	user, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDeleted {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r MemoryUserRepository) GetActiveByEmail(ctx context.Context, email string) (*models.User, error) {
+	users := r.find(ctx, func(user models.User) bool {
+		return !user.IsDeleted && user.Email == email
+	})
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (r MemoryUserRepository) Raters(ctx context.Context, mangaID string) ([]models.User, error) {
+	return r.find(ctx, func(user models.User) bool {
+		return !user.IsDeleted && slices.ContainsFunc(user.Ratings, func(rating models.Rating) bool {
+			return rating.MangaID == mangaID
+		})
+	}), nil
+}
+
+func (r MemoryUserRepository) All(ctx context.Context) ([]models.User, error) {
+	return r.find(ctx, func(user models.User) bool { return !user.IsDeleted }), nil
+}
+
+func (r MemoryUserRepository) ActivePurchasers(ctx context.Context, mangaID string, buyerIDs []string) ([]string, error) {
+	users := r.find(ctx, func(user models.User) bool {
+		if user.IsDeleted {
+			return false
+		}
+		return slices.Contains(buyerIDs, user.ID) || slices.ContainsFunc(user.PurchaseHistory, func(purchase models.Purchase) bool {
+			return purchase.MangaID == mangaID
+		})
+	})
+
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+func (r MemoryUserRepository) Create(ctx context.Context, user models.User) (*models.User, error) {
+	defer r.db.lock(ctx)()
+
+	if user.ID == "" {
+		user.ID = newID()
+	}
+	r.db.users[user.ID] = cloneUser(user)
+
+	return &user, nil
+}
+
+func (r MemoryUserRepository) SetDeleted(ctx context.Context, id string, deleted bool) error {
+	r.update(ctx, id, nil, func(user *models.User) { user.IsDeleted = deleted })
+	return nil
+}
+
+func (r MemoryUserRepository) VerifyEmail(ctx context.Context, id string) error {
+	r.update(ctx, id, nil, func(user *models.User) { user.EmailVerified = true })
+	return nil
+}
+
+func (r MemoryUserRepository) ResetPassword(ctx context.Context, id, passwordHash string) error {
+	r.update(ctx, id,
+		func(user models.User) bool { return !user.IsDeleted },
+		func(user *models.User) {
+			user.PasswordHash = passwordHash
+			user.EmailVerified = true
+		},
+	)
+	return nil
+}
+
+func (r MemoryUserRepository) AddRating(ctx context.Context, id string, rating models.Rating) error {
+	r.update(ctx, id, nil, func(user *models.User) { user.Ratings = append(user.Ratings, rating) })
+	return nil
+}
+
+func (r MemoryUserRepository) UpdateRating(ctx context.Context, id string, rating models.Rating) error {
+	r.update(ctx, id, nil, func(user *models.User) {
+		for i := range user.Ratings {
+			if user.Ratings[i].MangaID == rating.MangaID {
+				user.Ratings[i].Score = rating.Score
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (r MemoryUserRepository) RemoveRating(ctx context.Context, id, mangaID string) error {
+	r.update(ctx, id, nil, func(user *models.User) {
+		user.Ratings = slices.DeleteFunc(user.Ratings, func(rating models.Rating) bool {
+			return rating.MangaID == mangaID
+		})
+	})
+	return nil
+}
+
+func (r MemoryUserRepository) SetTwoFactor(ctx context.Context, id string, twoFactor *models.TwoFactor) error {
+	r.update(ctx, id, nil, func(user *models.User) {
+		user.TwoFactor = nil
+		if twoFactor != nil {
+			copied := *twoFactor
+			copied.RecoveryCodes = cloneStrings(twoFactor.RecoveryCodes)
+			user.TwoFactor = &copied
+		}
+	})
+	return nil
+}
+
+func (r MemoryUserRepository) EnableTwoFactor(ctx context.Context, id, secret string, step int64, recoveryCodes []string) (bool, error) {
+	return r.update(ctx, id,
+		func(user models.User) bool {
+			return user.TwoFactor != nil && user.TwoFactor.Secret == secret && !user.TwoFactor.Enabled
+		},
+		func(user *models.User) {
+			user.TwoFactor.Enabled = true
+			user.TwoFactor.EnabledAt = time.Now().Unix()
+			user.TwoFactor.LastUsedStep = step
+			user.TwoFactor.RecoveryCodes = cloneStrings(recoveryCodes)
+		},
+	), nil
+}
+
+func (r MemoryUserRepository) SetRecoveryCodes(ctx context.Context, id string, hashes []string) error {
+	r.update(ctx, id,
+		func(user models.User) bool { return user.TwoFactor != nil },
+		func(user *models.User) { user.TwoFactor.RecoveryCodes = cloneStrings(hashes) },
+	)
+	return nil
+}
+
+func (r MemoryUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	return r.update(ctx, id,
+		func(user models.User) bool { return user.TwoFactor != nil && user.TwoFactor.LastUsedStep < step },
+		func(user *models.User) { user.TwoFactor.LastUsedStep = step },
+	), nil
+}
+
+func (r MemoryUserRepository) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	return r.update(ctx, id,
+		func(user models.User) bool {
+			return user.TwoFactor != nil && slices.Contains(user.TwoFactor.RecoveryCodes, hash)
+		},
+		func(user *models.User) {
+			user.TwoFactor.RecoveryCodes = slices.DeleteFunc(user.TwoFactor.RecoveryCodes, func(code string) bool {
+				return code == hash
+			})
+		},
+	), nil
+}
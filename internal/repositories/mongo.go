@@ -0,0 +1,257 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/databases"
+	"manga_store/internal/helpers"
+	"manga_store/internal/models"
+	"manga_store/internal/search"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Default returns the production stores over the clients the databases
+// package connected.
+func Default() Stores {
+	return NewMongoStores(databases.Database(), databases.Redis(), databases.Neo4j())
+}
+
+// NewMongoStores returns stores over db, with the cache in Redis and the
+// graph in Neo4j. The search index is picked by SEARCH_INDEX: "mongo", the
+// default, searches the collection's text index, and "memory" keeps a BM25
+// index in process that the owner of the stores must load.
+func NewMongoStores(db *mongo.Database, client *redis.Client, graph databases.Graph) Stores {
+	manga := db.Collection("manga")
+
+	var index search.SearchIndex = search.NewMongoIndex(manga)
+	if helpers.GetEnv("SEARCH_INDEX", "mongo") == "memory" {
+		index = search.NewMemoryIndex(search.DefaultBoosts)
+	}
+
+	return Stores{
+		Tx:        MongoTransactor{client: db.Client()},
+		Manga:     NewMongoMangaRepository(manga),
+		Users:     NewMongoUserRepository(db.Collection("users")),
+		Orders:    NewMongoOrderRepository(db.Collection("orders")),
+		Audit:     NewMongoAuditRepository(db.Collection("audit_log")),
+		Outbox:    NewMongoOutbox(db.Collection("outbox")),
+		Graph:     NewNeo4jGraphStore(graph),
+		Cache:     NewRedisCache(client),
+		Search:    index,
+		Suggester: search.NewSuggester(),
+	}
+}
+
+// MongoTransactor runs multi-document transactions, which need a replica
+// set or sharded cluster.
+type MongoTransactor struct {
+	client *mongo.Client
+}
+
+func (t MongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
+// MongoOutbox writes graph events to the outbox collection, where
+// GraphSyncRelay picks them up.
+type MongoOutbox struct {
+	outbox *mongo.Collection
+}
+
+func NewMongoOutbox(outbox *mongo.Collection) MongoOutbox {
+	return MongoOutbox{outbox: outbox}
+}
+
+func (o MongoOutbox) Record(ctx context.Context, eventType models.GraphEventType, payload models.GraphEventPayload) error {
+	now := time.Now().Unix()
+
+	_, err := o.outbox.InsertOne(ctx, models.GraphEvent{
+		Type:          eventType,
+		Payload:       payload,
+		Keys:          payload.Keys(),
+		Status:        models.GraphEventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+
+	return err
+}
+
+// Claim leases the oldest due event that no earlier pending event shares a
+// key with. The search runs in MongoDB, so any number of held back events
+// can sit ahead of the one it finds.
+func (o MongoOutbox) Claim(ctx context.Context, lease time.Duration) (*models.GraphEvent, error) {
+	for {
+		now := time.Now().Unix()
+
+		candidate, err := o.nextUnblocked(ctx, now)
+		if err != nil || candidate == nil {
+			return nil, err
+		}
+
+		eventID, err := objectID(candidate.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Another relay may have claimed the event since it was found.
+		var event models.GraphEvent
+		err = o.outbox.FindOneAndUpdate(ctx,
+			bson.M{"_id": eventID, "status": models.GraphEventPending, "lockedUntil": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"lockedUntil": now + int64(lease.Seconds())}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&event)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+}
+
+// nextUnblocked finds the oldest due event with no earlier pending event
+// sharing one of its keys. Events keep the order they were recorded in, by
+// creation time and then ID. Events parked as failed hold nothing back, so
+// one that keeps failing cannot stall the users and manga it touches.
+func (o MongoOutbox) nextUnblocked(ctx context.Context, now int64) (*models.GraphEvent, error) {
+	earlier := bson.M{"$or": bson.A{
+		bson.M{"$lt": bson.A{"$createdAt", "$$createdAt"}},
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$createdAt", "$$createdAt"}},
+			bson.M{"$lt": bson.A{"$_id", "$$id"}},
+		}},
+	}}
+
+	cursor, err := o.outbox.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status":        models.GraphEventPending,
+			"nextAttemptAt": bson.M{"$lte": now},
+			"lockedUntil":   bson.M{"$lte": now},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         o.outbox.Name(),
+			"localField":   "keys",
+			"foreignField": "keys",
+			"let":          bson.M{"createdAt": "$createdAt", "id": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"status": models.GraphEventPending, "$expr": earlier}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "blockers",
+		}}},
+		{{Key: "$match", Value: bson.M{"blockers": bson.M{"$size": 0}}}},
+		{{Key: "$limit", Value: 1}},
+		{{Key: "$project", Value: bson.M{"blockers": 0}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []models.GraphEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return &events[0], nil
+}
+
+func (o MongoOutbox) Complete(ctx context.Context, id string) error {
+	eventID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.outbox.UpdateOne(ctx, bson.M{"_id": eventID}, bson.M{
+		"$set": bson.M{
+			"status":      models.GraphEventProcessed,
+			"processedAt": time.Now(),
+			"lockedUntil": 0,
+		},
+		"$inc": bson.M{"attempts": 1},
+	})
+
+	return err
+}
+
+func (o MongoOutbox) Fail(ctx context.Context, event models.GraphEvent) error {
+	eventID, err := objectID(event.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.outbox.UpdateOne(ctx, bson.M{"_id": eventID}, bson.M{"$set": bson.M{
+		"status":        event.Status,
+		"attempts":      event.Attempts,
+		"lastError":     event.LastError,
+		"nextAttemptAt": event.NextAttemptAt,
+		"lockedUntil":   0,
+	}})
+
+	return err
+}
+
+type MongoAuditRepository struct {
+	auditLog *mongo.Collection
+}
+
+func NewMongoAuditRepository(auditLog *mongo.Collection) MongoAuditRepository {
+	return MongoAuditRepository{auditLog: auditLog}
+}
+
+func (r MongoAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	_, err := r.auditLog.InsertOne(ctx, entry)
+	return err
+}
+
+// objectID parses a hex ID. An ID that cannot be an ObjectID cannot match
+// any document either, so it is reported as ErrNotFound.
+func objectID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrNotFound
+	}
+	return objectID, nil
+}
+
+func objectIDs(ids []string) []primitive.ObjectID {
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	return objectIDs
+}
+
+func insertedID(result *mongo.InsertOneResult) string {
+	return result.InsertedID.(primitive.ObjectID).Hex()
+}
+
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
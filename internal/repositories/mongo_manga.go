@@ -0,0 +1,452 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoMangaRepository struct {
+	manga *mongo.Collection
+}
+
+func NewMongoMangaRepository(manga *mongo.Collection) MongoMangaRepository {
+	return MongoMangaRepository{manga: manga}
+}
+
+// activeManga narrows filter to manga that have not been deleted. Every
+// catalog read goes through it so trashed titles never leak back out.
+func activeManga(filter bson.M) bson.M {
+	filter["isDeleted"] = false
+	return filter
+}
+
+func (r MongoMangaRepository) findOne(ctx context.Context, filter bson.M) (*models.Manga, error) {
+	var manga models.Manga
+	if err := r.manga.FindOne(ctx, filter).Decode(&manga); err != nil {
+		return nil, notFound(err)
+	}
+	return &manga, nil
+}
+
+func (r MongoMangaRepository) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]models.Manga, error) {
+	cursor, err := r.manga.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mangas := []models.Manga{}
+	if err := cursor.All(ctx, &mangas); err != nil {
+		return nil, err
+	}
+
+	return mangas, nil
+}
+
+func (r MongoMangaRepository) Get(ctx context.Context, id string) (*models.Manga, error) {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, activeManga(bson.M{"_id": mangaID}))
+}
+
+func (r MongoMangaRepository) GetWithDeleted(ctx context.Context, id string) (*models.Manga, error) {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, bson.M{"_id": mangaID})
+}
+
+func (r MongoMangaRepository) Find(ctx context.Context, ids []string) ([]models.Manga, error) {
+	return r.find(ctx, activeManga(bson.M{"_id": bson.M{"$in": objectIDs(ids)}}))
+}
+
+func (r MongoMangaRepository) All(ctx context.Context) ([]models.Manga, error) {
+	return r.find(ctx, activeManga(bson.M{}))
+}
+
+func (r MongoMangaRepository) List(ctx context.Context, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Manga], error) {
+	return pagination.Find[models.Manga](ctx, r.manga, activeManga(bson.M{}), sort, keyset, params)
+}
+
+func (r MongoMangaRepository) Popular(ctx context.Context, limit int) ([]models.Manga, error) {
+	return r.find(ctx, activeManga(bson.M{}), options.Find().
+		SetSort(bson.D{
+			{Key: "sold", Value: -1},
+			{Key: "views", Value: -1},
+		}).
+		SetLimit(int64(limit)))
+}
+
+func (r MongoMangaRepository) Trash(ctx context.Context) ([]models.Manga, error) {
+	return r.find(ctx, bson.M{"isDeleted": true}, options.Find().SetSort(bson.M{"deletedAt": -1}))
+}
+
+func (r MongoMangaRepository) Create(ctx context.Context, manga models.Manga) (*models.Manga, error) {
+	result, err := r.manga.InsertOne(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+	manga.ID = insertedID(result)
+
+	return &manga, nil
+}
+
+func (r MongoMangaRepository) Update(ctx context.Context, id string, update models.UpdateMangaRequest, updatedAt int) (*models.Manga, error) {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updatedAt": updatedAt}
+	if update.Title != nil {
+		set["title"] = *update.Title
+	}
+	if update.Author != nil {
+		set["author"] = *update.Author
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if update.ImageURL != nil {
+		set["imageUrl"] = *update.ImageURL
+	}
+	if update.Genres != nil {
+		set["genres"] = *update.Genres
+	}
+	if update.Price != nil {
+		set["price"] = *update.Price
+	}
+	if update.Quantity != nil {
+		set["quantity"] = *update.Quantity
+	}
+
+	var updated models.Manga
+	err = r.manga.FindOneAndUpdate(ctx,
+		activeManga(bson.M{"_id": mangaID, "version": *update.Version}),
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		count, err := r.manga.CountDocuments(ctx, activeManga(bson.M{"_id": mangaID}))
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, ErrVersionConflict
+	}
+
+	return &updated, nil
+}
+
+func (r MongoMangaRepository) Delete(ctx context.Context, id string, deletedAt int) error {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.manga.UpdateOne(ctx, activeManga(bson.M{"_id": mangaID}), bson.M{
+		"$set": bson.M{"isDeleted": true, "deletedAt": deletedAt},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r MongoMangaRepository) Restore(ctx context.Context, id string, restoredAt int) (*models.Manga, error) {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var manga models.Manga
+	err = r.manga.FindOneAndUpdate(ctx,
+		bson.M{"_id": mangaID, "isDeleted": true},
+		bson.M{
+			"$set":   bson.M{"isDeleted": false, "updatedAt": restoredAt},
+			"$unset": bson.M{"deletedAt": ""},
+			"$inc":   bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&manga)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &manga, nil
+}
+
+func (r MongoMangaRepository) Purge(ctx context.Context, deletedBefore int) (int64, error) {
+	result, err := r.manga.DeleteMany(ctx, bson.M{"isDeleted": true, "deletedAt": bson.M{"$lte": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r MongoMangaRepository) IncrementViews(ctx context.Context, id string) error {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.manga.UpdateOne(ctx, activeManga(bson.M{"_id": mangaID}), bson.M{"$inc": bson.M{"views": 1}})
+	return err
+}
+
+func (r MongoMangaRepository) SetRating(ctx context.Context, id string, rating float64, ratedTimes int) error {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
+		"$set": bson.M{"rating": rating, "ratedTimes": ratedTimes},
+	})
+	return err
+}
+
+func (r MongoMangaRepository) ReserveStock(ctx context.Context, id string, quantity int) (bool, error) {
+	mangaID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+
+	result, err := r.manga.UpdateOne(ctx,
+		activeManga(bson.M{"_id": mangaID, "quantity": bson.M{"$gte": quantity}}),
+		bson.M{"$inc": bson.M{"quantity": -quantity, "sold": quantity}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+func (r MongoMangaRepository) ReleaseStock(ctx context.Context, id string, quantity int) error {
+	mangaID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
+		"$inc": bson.M{"quantity": quantity, "sold": -quantity},
+	})
+	return err
+}
+
+// Search runs the filters, the page of results and every facet in a single
+// aggregation.
+func (r MongoMangaRepository) Search(ctx context.Context, query MangaSearch) (*models.SearchMangaResponse, error) {
+	response := &models.SearchMangaResponse{Items: []models.Manga{}}
+
+	filter := searchFilter(query.Request)
+	var resultStages []bson.M
+
+	if query.Ranked != nil {
+		ranked := objectIDs(query.Ranked)
+		filter["_id"] = bson.M{"$in": ranked}
+		if query.ByRank {
+			resultStages = []bson.M{
+				{"$addFields": bson.M{"searchRank": bson.M{"$indexOfArray": bson.A{ranked, "$_id"}}}},
+				{"$sort": bson.M{"searchRank": 1}},
+				{"$skip": query.Cursor.Offset},
+				{"$limit": query.Limit + 1},
+				{"$project": bson.M{"searchRank": 0}},
+			}
+		}
+	}
+
+	if !query.ByRank {
+		after, err := query.Keyset.After(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after != nil {
+			resultStages = append(resultStages, bson.M{"$match": after})
+		}
+		resultStages = append(resultStages, bson.M{"$sort": query.Keyset.Sort()}, bson.M{"$limit": query.Limit + 1})
+	}
+
+	ratingCounts := bson.M{"_id": nil}
+	for i, bound := range ratingFacetBounds {
+		ratingCounts[fmt.Sprintf("r%d", i)] = bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$rating", bound}}, 1, 0}}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"results": resultStages,
+			"genres": bson.A{
+				bson.M{"$unwind": "$genres"},
+				bson.M{"$sortByCount": "$genres"},
+				bson.M{"$limit": facetValueLimit},
+			},
+			"authors": bson.A{
+				bson.M{"$sortByCount": "$author"},
+				bson.M{"$limit": facetValueLimit},
+			},
+			"price": bson.A{
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price",
+					"boundaries": priceBucketBounds,
+					"default":    "above",
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+			"rating": bson.A{bson.M{"$group": ratingCounts}},
+			"stock": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"total":   bson.M{"$sum": 1},
+					"inStock": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$quantity", 0}}, 1, 0}}},
+				}},
+			},
+		}}},
+	}
+
+	aggregate, err := r.manga.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []struct {
+		Results []bson.Raw          `bson:"results"`
+		Genres  []models.FacetCount `bson:"genres"`
+		Authors []models.FacetCount `bson:"authors"`
+		Price   []struct {
+			Lower interface{} `bson:"_id"`
+			Count int         `bson:"count"`
+		} `bson:"price"`
+		Rating []bson.M `bson:"rating"`
+		Stock  []struct {
+			Total   int `bson:"total"`
+			InStock int `bson:"inStock"`
+		} `bson:"stock"`
+	}
+	if err := aggregate.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+	if len(facets) == 0 {
+		return response, nil
+	}
+	result := facets[0]
+
+	if query.ByRank {
+		results := result.Results
+		if len(results) > query.Limit {
+			results = results[:query.Limit]
+			response.NextCursor = pagination.OffsetCursor(query.Sort, query.Cursor.Offset+query.Limit)
+		}
+		for _, doc := range results {
+			var manga models.Manga
+			if err := bson.Unmarshal(doc, &manga); err != nil {
+				return nil, err
+			}
+			response.Items = append(response.Items, manga)
+		}
+	} else {
+		page, err := pagination.Trim[models.Manga](result.Results, query.Limit, query.Sort, query.Keyset)
+		if err != nil {
+			return nil, err
+		}
+		response.Items, response.NextCursor = page.Items, page.NextCursor
+	}
+	response.Facets.Genres = append([]models.FacetCount{}, result.Genres...)
+	response.Facets.Authors = append([]models.FacetCount{}, result.Authors...)
+
+	priceCounts := make([]int, len(priceBucketBounds))
+	for _, bucket := range result.Price {
+		if lower, ok := bucket.Lower.(float64); ok {
+			for i, bound := range priceBucketBounds {
+				if bound == lower {
+					priceCounts[i] = bucket.Count
+				}
+			}
+		} else {
+			priceCounts[len(priceCounts)-1] = bucket.Count
+		}
+	}
+	response.Facets.Price = priceBuckets(priceCounts)
+
+	ratingCountsByBound := make([]int, len(ratingFacetBounds))
+	if len(result.Rating) > 0 {
+		for i := range ratingFacetBounds {
+			ratingCountsByBound[i] = int(toInt64(result.Rating[0][fmt.Sprintf("r%d", i)]))
+		}
+	}
+	response.Facets.Rating = ratingBuckets(ratingCountsByBound)
+
+	if len(result.Stock) > 0 {
+		response.Total = result.Stock[0].Total
+		response.Facets.InStock = result.Stock[0].InStock
+		response.Facets.OutOfStock = result.Stock[0].Total - result.Stock[0].InStock
+	}
+
+	return response, nil
+}
+
+// searchFilter turns the structured part of a search into a $match filter on
+// the active catalog. User input is only ever matched literally.
+func searchFilter(request models.SearchMangaRequest) bson.M {
+	filter := activeManga(bson.M{})
+
+	if len(request.Genres) > 0 {
+		filter["genres"] = bson.M{"$all": request.Genres}
+	}
+	if author := strings.TrimSpace(request.Author); author != "" {
+		filter["author"] = primitive.Regex{Pattern: regexp.QuoteMeta(author), Options: "i"}
+	}
+
+	price := bson.M{}
+	if request.MinPrice != nil {
+		price["$gte"] = *request.MinPrice
+	}
+	if request.MaxPrice != nil {
+		price["$lte"] = *request.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+
+	if request.MinRating != nil {
+		filter["rating"] = bson.M{"$gte": *request.MinRating}
+	}
+	if request.InStock {
+		filter["quantity"] = bson.M{"$gt": 0}
+	}
+
+	return filter
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoOrderRepository struct {
+	orders *mongo.Collection
+}
+
+func NewMongoOrderRepository(orders *mongo.Collection) MongoOrderRepository {
+	return MongoOrderRepository{orders: orders}
+}
+
+func (r MongoOrderRepository) Create(ctx context.Context, order models.Order) (*models.Order, error) {
+	result, err := r.orders.InsertOne(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	order.ID = insertedID(result)
+
+	return &order, nil
+}
+
+func (r MongoOrderRepository) Get(ctx context.Context, id string) (*models.Order, error) {
+	orderID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := r.orders.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		return nil, notFound(err)
+	}
+
+	return &order, nil
+}
+
+func (r MongoOrderRepository) ForUser(ctx context.Context, userID string) ([]models.Order, error) {
+	cursor, err := r.orders.Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r MongoOrderRepository) List(ctx context.Context, filter OrderFilter, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Order], error) {
+	match := bson.M{}
+	if filter.Status != "" {
+		match["status"] = filter.Status
+	}
+	if filter.UserID != "" {
+		match["userId"] = filter.UserID
+	}
+
+	return pagination.Find[models.Order](ctx, r.orders, match, sort, keyset, params)
+}
+
+func (r MongoOrderRepository) Transition(ctx context.Context, id string, from models.OrderStatus, change models.OrderStatusChange) (*models.Order, error) {
+	orderID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated models.Order
+	err = r.orders.FindOneAndUpdate(ctx,
+		bson.M{"_id": orderID, "status": from},
+		bson.M{
+			"$set":  bson.M{"status": change.Status, "updatedAt": change.ChangedAt},
+			"$push": bson.M{"statusHistory": change},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &updated, nil
+}
+
+func (r MongoOrderRepository) Buyers(ctx context.Context, mangaID string) ([]string, error) {
+	buyers, err := r.orders.Distinct(ctx, "userId", bson.M{
+		"items.mangaId": mangaID,
+		"status":        bson.M{"$nin": []models.OrderStatus{models.OrderStatusCancelled, models.OrderStatusRefunded}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(buyers))
+	for _, buyer := range buyers {
+		ids = append(ids, fmt.Sprint(buyer))
+	}
+
+	return ids, nil
+}
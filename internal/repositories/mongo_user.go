@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MongoUserRepository struct {
+	users *mongo.Collection
+}
+
+func NewMongoUserRepository(users *mongo.Collection) MongoUserRepository {
+	return MongoUserRepository{users: users}
+}
+
+func (r MongoUserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.users.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// update applies change to the user with id matching filter, and reports
+// whether a user matched.
+func (r MongoUserRepository) update(ctx context.Context, id string, filter, change bson.M) (bool, error) {
+	userID, err := objectID(id)
+	if err != nil {
+		return false, err
+	}
+	filter["_id"] = userID
+
+	result, err := r.users.UpdateOne(ctx, filter, change)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r MongoUserRepository) Get(ctx context.Context, id string) (*models.User, error) {
+	userID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, bson.M{"_id": userID})
+}
+
+func (r MongoUserRepository) GetActive(ctx context.Context, id string) (*models.User, error) {
+	userID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, bson.M{"_id": userID, "isDeleted": false})
+}
+
+func (r MongoUserRepository) GetActiveByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email, "isDeleted": false})
+}
+
+func (r MongoUserRepository) Raters(ctx context.Context, mangaID string) ([]models.User, error) {
+	cursor, err := r.users.Find(ctx, bson.M{"ratings.mangaId": mangaID, "isDeleted": false})
+	if err != nil {
+		return nil, err
+	}
+
+	var raters []models.User
+	if err := cursor.All(ctx, &raters); err != nil {
+		return nil, err
+	}
+
+	return raters, nil
+}
+
+func (r MongoUserRepository) All(ctx context.Context) ([]models.User, error) {
+	cursor, err := r.users.Find(ctx, bson.M{"isDeleted": false})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r MongoUserRepository) ActivePurchasers(ctx context.Context, mangaID string, buyerIDs []string) ([]string, error) {
+	userIDs, err := r.users.Distinct(ctx, "_id", bson.M{
+		"isDeleted": false,
+		"$or": []bson.M{
+			{"_id": bson.M{"$in": objectIDs(buyerIDs)}},
+			{"purchaseHistory.mangaId": mangaID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if id, ok := userID.(primitive.ObjectID); ok {
+			ids = append(ids, id.Hex())
+		}
+	}
+
+	return ids, nil
+}
+
+func (r MongoUserRepository) Create(ctx context.Context, user models.User) (*models.User, error) {
+	result, err := r.users.InsertOne(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = insertedID(result)
+
+	return &user, nil
+}
+
+func (r MongoUserRepository) SetDeleted(ctx context.Context, id string, deleted bool) error {
+	_, err := r.update(ctx, id, bson.M{}, bson.M{"$set": bson.M{"isDeleted": deleted}})
+	return err
+}
+
+func (r MongoUserRepository) VerifyEmail(ctx context.Context, id string) error {
+	_, err := r.update(ctx, id, bson.M{}, bson.M{"$set": bson.M{"emailVerified": true}})
+	return err
+}
+
+func (r MongoUserRepository) ResetPassword(ctx context.Context, id, passwordHash string) error {
+	_, err := r.update(ctx, id, bson.M{"isDeleted": false}, bson.M{"$set": bson.M{
+		"passwordHash":  passwordHash,
+		"emailVerified": true,
+	}})
+	return err
+}
+
+func (r MongoUserRepository) AddRating(ctx context.Context, id string, rating models.Rating) error {
+	_, err := r.update(ctx, id, bson.M{}, bson.M{"$push": bson.M{"ratings": rating}})
+	return err
+}
+
+func (r MongoUserRepository) UpdateRating(ctx context.Context, id string, rating models.Rating) error {
+	_, err := r.update(ctx, id, bson.M{"ratings.mangaId": rating.MangaID},
+		bson.M{"$set": bson.M{"ratings.$.score": rating.Score}})
+	return err
+}
+
+func (r MongoUserRepository) RemoveRating(ctx context.Context, id, mangaID string) error {
+	_, err := r.update(ctx, id, bson.M{}, bson.M{
+		"$pull": bson.M{"ratings": bson.M{"mangaId": mangaID}},
+	})
+	return err
+}
+
+func (r MongoUserRepository) SetTwoFactor(ctx context.Context, id string, twoFactor *models.TwoFactor) error {
+	change := bson.M{"$unset": bson.M{"twoFactor": ""}}
+	if twoFactor != nil {
+		change = bson.M{"$set": bson.M{"twoFactor": twoFactor}}
+	}
+
+	_, err := r.update(ctx, id, bson.M{}, change)
+	return err
+}
+
+func (r MongoUserRepository) EnableTwoFactor(ctx context.Context, id, secret string, step int64, recoveryCodes []string) (bool, error) {
+	return r.update(ctx, id,
+		bson.M{"twoFactor.secret": secret, "twoFactor.enabled": false},
+		bson.M{"$set": bson.M{
+			"twoFactor.enabled":       true,
+			"twoFactor.enabledAt":     time.Now().Unix(),
+			"twoFactor.lastUsedStep":  step,
+			"twoFactor.recoveryCodes": recoveryCodes,
+		}},
+	)
+}
+
+func (r MongoUserRepository) SetRecoveryCodes(ctx context.Context, id string, hashes []string) error {
+	_, err := r.update(ctx, id, bson.M{}, bson.M{"$set": bson.M{"twoFactor.recoveryCodes": hashes}})
+	return err
+}
+
+func (r MongoUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	return r.update(ctx, id,
+		bson.M{"twoFactor.lastUsedStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"twoFactor.lastUsedStep": step}},
+	)
+}
+
+func (r MongoUserRepository) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	userID, err := objectID(id)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": userID, "twoFactor.recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"twoFactor.recoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,291 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/databases"
+	"manga_store/internal/models"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Neo4jGraphStore keeps the recommendation graph in Neo4j. Events are
+// applied in write sessions and recommendations read in read sessions, one
+// per call.
+type Neo4jGraphStore struct {
+	graph databases.Graph
+}
+
+func NewNeo4jGraphStore(graph databases.Graph) Neo4jGraphStore {
+	return Neo4jGraphStore{graph: graph}
+}
+
+// graphEventQueries holds the Cypher applied for each event type. Every
+// statement is written with MERGE or MATCH so replaying an event is harmless.
+var graphEventQueries = map[models.GraphEventType]string{
+	models.GraphEventMangaUpserted: `
+		UNWIND $manga AS manga
+		MERGE (m:Manga {id: manga.id})
+		SET m.title = manga.title, m.genres = manga.genres
+	`,
+	models.GraphEventMangaDeleted: `
+		UNWIND $manga AS manga
+		MATCH (m:Manga {id: manga.id})
+		DETACH DELETE m
+	`,
+	models.GraphEventUserUpserted: `
+		MERGE (u:User {id: $userID})
+		SET u.email = $email
+	`,
+	models.GraphEventUserDeleted: `
+		MATCH (u:User {id: $userID})
+		DETACH DELETE u
+	`,
+	models.GraphEventMangaViewed: `
+		MERGE (u:User {id: $userID})
+		WITH u
+		UNWIND $manga AS manga
+		MERGE (m:Manga {id: manga.id})
+		ON CREATE SET m.title = manga.title, m.genres = manga.genres
+		MERGE (u)-[:VIEWED]->(m)
+	`,
+	models.GraphEventMangaPurchased: `
+		MERGE (u:User {id: $userID})
+		WITH u
+		UNWIND $manga AS manga
+		MERGE (m:Manga {id: manga.id})
+		ON CREATE SET m.title = manga.title, m.genres = manga.genres
+		MERGE (u)-[:PURCHASED]->(m)
+	`,
+	models.GraphEventPurchaseRemoved: `
+		UNWIND $manga AS manga
+		MATCH (u:User {id: $userID})-[p:PURCHASED]->(m:Manga {id: manga.id})
+		DELETE p
+	`,
+	models.GraphEventMangaRated: `
+		MERGE (u:User {id: $userID})
+		WITH u
+		UNWIND $manga AS manga
+		MERGE (m:Manga {id: manga.id})
+		ON CREATE SET m.title = manga.title, m.genres = manga.genres
+		MERGE (u)-[r:RATED]->(m)
+		SET r.score = $score
+	`,
+	models.GraphEventRatingRemoved: `
+		UNWIND $manga AS manga
+		MATCH (u:User {id: $userID})-[r:RATED]->(m:Manga {id: manga.id})
+		DELETE r
+	`,
+}
+
+func (g Neo4jGraphStore) Apply(ctx context.Context, event models.GraphEvent) error {
+	query, ok := graphEventQueries[event.Type]
+	if !ok {
+		return errors.New("unknown graph event type " + string(event.Type))
+	}
+
+	manga := make([]map[string]interface{}, 0, len(event.Payload.Manga))
+	for _, m := range event.Payload.Manga {
+		manga = append(manga, map[string]interface{}{
+			"id":     m.ID,
+			"title":  m.Title,
+			"genres": m.Genres,
+		})
+	}
+
+	_, err := g.graph.Write(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		_, err := tx.Run(ctx, query, map[string]interface{}{
+			"userID": event.Payload.UserID,
+			"email":  event.Payload.Email,
+			"manga":  manga,
+			"score":  event.Payload.Score,
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+func (g Neo4jGraphStore) RecommendByPreferences(ctx context.Context, userID string, skip, limit int) ([]string, error) {
+	// Find manga sharing genres with the ones the user rated highly (> 4),
+	// ranked by how many genres they share
+	genreQuery := `
+	    MATCH (u:User {id: $userID})-[r:RATED]->(manga:Manga)
+	    WHERE r.score > 4
+	    WITH u, apoc.coll.flatten(collect(DISTINCT manga.genres)) AS userGenres
+
+	    MATCH (otherManga:Manga)
+	    WHERE any(genre IN otherManga.genres WHERE genre IN userGenres)
+	    AND NOT (u)-[:RATED|PURCHASED]->(otherManga)
+	    WITH otherManga, size([genre IN otherManga.genres WHERE genre IN userGenres]) AS sharedGenres
+	    RETURN otherManga.id AS id
+	    ORDER BY sharedGenres DESC, id
+	    SKIP $skip
+	    LIMIT $limit
+	`
+
+	return g.recommend(ctx, genreQuery, userID, skip, limit)
+}
+
+func (g Neo4jGraphStore) RecommendBySimilarUsers(ctx context.Context, userID string, skip, limit int) ([]string, error) {
+	// Neo4j query for collaborative filtering
+	recQuery := `
+        // Step 1: Find the manga rated by the target user with high ratings
+        MATCH (u:User {id: $userID})-[r:RATED]->(manga:Manga)
+        WHERE r.score > 4
+        WITH u, manga
+
+        // Step 2: Find other users who have rated the same manga highly
+        MATCH (otherUser:User)-[otherRating:RATED]->(manga)
+        WHERE otherUser <> u AND otherRating.score > 4
+
+        // Step 3: Find other manga rated by similar users
+        MATCH (otherUser)-[similarRating:RATED]->(similarManga:Manga)
+        WHERE NOT (u)-[:RATED|PURCHASED]->(similarManga)
+
+        // Step 4: Aggregate the recommendations and calculate the average rating
+        WITH similarManga, avg(similarRating.score) AS avgRating, count(similarRating) AS ratingCount
+        RETURN similarManga.id AS id, avgRating, ratingCount
+        ORDER BY avgRating DESC, ratingCount DESC, id
+        SKIP $skip
+        LIMIT $limit
+    `
+
+	return g.recommend(ctx, recQuery, userID, skip, limit)
+}
+
+// recommend runs a recommendation query and returns the manga IDs it ranks.
+func (g Neo4jGraphStore) recommend(ctx context.Context, query, userID string, skip, limit int) ([]string, error) {
+	result, err := g.graph.Read(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		res, err := tx.Run(ctx, query, map[string]interface{}{
+			"userID": userID,
+			"skip":   skip,
+			"limit":  limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var mangaIDs []string
+		for res.Next(ctx) {
+			record := res.Record()
+			id, ok := record.Get("id")
+			if ok {
+				mangaIDs = append(mangaIDs, id.(string))
+			}
+		}
+
+		if err = res.Err(); err != nil {
+			return nil, err
+		}
+
+		return mangaIDs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mangaIDs, _ := result.([]string)
+	return mangaIDs, nil
+}
+
+func (g Neo4jGraphStore) Snapshot(ctx context.Context) (*models.GraphSnapshot, error) {
+	snapshot := &models.GraphSnapshot{}
+
+	records, err := g.read(ctx, `MATCH (m:Manga) RETURN m.id AS id, m.title AS title, m.genres AS genres`)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		snapshot.Manga = append(snapshot.Manga, models.GraphManga{
+			ID:     recordString(record, "id"),
+			Title:  recordString(record, "title"),
+			Genres: recordStrings(record, "genres"),
+		})
+	}
+
+	records, err = g.read(ctx, `MATCH (u:User) RETURN u.id AS id, u.email AS email`)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		snapshot.Users = append(snapshot.Users, models.GraphUser{
+			ID:    recordString(record, "id"),
+			Email: recordString(record, "email"),
+		})
+	}
+
+	records, err = g.read(ctx, `MATCH (u:User)-[r:RATED]->(m:Manga) RETURN u.id AS userID, m.id AS mangaID, r.score AS score`)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		snapshot.Ratings = append(snapshot.Ratings, models.GraphRating{
+			UserID:  recordString(record, "userID"),
+			MangaID: recordString(record, "mangaID"),
+			Score:   recordFloat(record, "score"),
+		})
+	}
+
+	records, err = g.read(ctx, `MATCH (u:User)-[:PURCHASED]->(m:Manga) RETURN DISTINCT u.id AS userID, m.id AS mangaID`)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		snapshot.Purchases = append(snapshot.Purchases, models.GraphPurchase{
+			UserID:  recordString(record, "userID"),
+			MangaID: recordString(record, "mangaID"),
+		})
+	}
+
+	return snapshot, nil
+}
+
+// read runs a query without parameters and returns all of its records.
+func (g Neo4jGraphStore) read(ctx context.Context, query string) ([]*neo4j.Record, error) {
+	result, err := g.graph.Read(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		res, err := tx.Run(ctx, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Collect(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records, _ := result.([]*neo4j.Record)
+	return records, nil
+}
+
+func recordString(record *neo4j.Record, key string) string {
+	value, _ := record.Get(key)
+	s, _ := value.(string)
+	return s
+}
+
+func recordStrings(record *neo4j.Record, key string) []string {
+	value, _ := record.Get(key)
+	items, _ := value.([]interface{})
+
+	var values []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// recordFloat reads a number, which Neo4j returns as an int64 when it was
+// stored without a fractional part.
+func recordFloat(record *neo4j.Record, key string) float64 {
+	value, _ := record.Get(key)
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/models"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxBackends are the queued memory outbox, and the MongoDB instance
+// named by MONGO_TEST_URI when it is set.
+var outboxBackends = []struct {
+	name   string
+	outbox func(t *testing.T) Outbox
+}{
+	{"memory", func(t *testing.T) Outbox { return NewQueuedMemoryStores().Outbox }},
+	{"mongo", mongoOutbox},
+}
+
+func mongoOutbox(t *testing.T) Outbox {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("manga_store_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	return NewMongoOutbox(db.Collection("outbox"))
+}
+
+// TestOutboxClaimsPastHeldBackEvents parks one event for user a, leaves the
+// next one for user a backing off, and queues more events for user a behind
+// it than any fixed window of candidates would hold. Events for manga p,
+// which only the parked event shares, and for user b must still be claimed.
+func TestOutboxClaimsPastHeldBackEvents(t *testing.T) {
+	for _, backend := range outboxBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			outbox := backend.outbox(t)
+
+			record := func(payload models.GraphEventPayload) {
+				t.Helper()
+				if err := outbox.Record(ctx, models.GraphEventMangaRated, payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+			claim := func() *models.GraphEvent {
+				t.Helper()
+				event, err := outbox.Claim(ctx, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return event
+			}
+
+			record(models.GraphEventPayload{UserID: "a", Manga: []models.GraphManga{{ID: "p"}}})
+			parked := claim()
+			parked.Status = models.GraphEventFailed
+			parked.Attempts = 10
+			if err := outbox.Fail(ctx, *parked); err != nil {
+				t.Fatal(err)
+			}
+
+			record(models.GraphEventPayload{UserID: "a"})
+			backingOff := claim()
+			if backingOff == nil || backingOff.Payload.UserID != "a" || len(backingOff.Payload.Manga) != 0 {
+				t.Fatalf("claimed %+v, want the event queued behind the parked one", backingOff)
+			}
+			backingOff.Attempts = 1
+			backingOff.NextAttemptAt = time.Now().Add(time.Hour).Unix()
+			if err := outbox.Fail(ctx, *backingOff); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 60; i++ {
+				record(models.GraphEventPayload{UserID: "a", Score: float64(i)})
+			}
+			record(models.GraphEventPayload{Manga: []models.GraphManga{{ID: "p"}}})
+			record(models.GraphEventPayload{UserID: "b"})
+
+			for _, want := range []string{"manga:p", "user:b"} {
+				event := claim()
+				if event == nil || len(event.Keys) != 1 || event.Keys[0] != want {
+					t.Fatalf("claimed %+v, want the event for %s", event, want)
+				}
+				if err := outbox.Complete(ctx, event.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if event := claim(); event != nil {
+				t.Errorf("claimed %+v while every other event for user a waits on one backing off", event)
+			}
+		})
+	}
+}
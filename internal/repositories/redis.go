@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache keeps the cache in Redis. Writes that also set an expiry are
+// sent as one MULTI block.
+type RedisCache struct {
+	redis *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) RedisCache {
+	return RedisCache{redis: client}
+}
+
+func cacheMiss(err error) error {
+	if err == redis.Nil {
+		return ErrCacheMiss
+	}
+	return err
+}
+
+func (c RedisCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.redis.Get(ctx, key).Result()
+	return value, cacheMiss(err)
+}
+
+func (c RedisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.redis.Set(ctx, key, value, ttl).Err()
+}
+
+func (c RedisCache) GetDel(ctx context.Context, key string) (string, error) {
+	value, err := c.redis.GetDel(ctx, key).Result()
+	return value, cacheMiss(err)
+}
+
+func (c RedisCache) Del(ctx context.Context, keys ...string) error {
+	return c.redis.Del(ctx, keys...).Err()
+}
+
+func (c RedisCache) Exists(ctx context.Context, key string) (bool, error) {
+	count, err := c.redis.Exists(ctx, key).Result()
+	return count > 0, err
+}
+
+func (c RedisCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.redis.Expire(ctx, key, ttl).Err()
+}
+
+func (c RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.redis.PTTL(ctx, key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (c RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.redis.Incr(ctx, key).Result()
+}
+
+func (c RedisCache) SAdd(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+
+	pipe := c.redis.TxPipeline()
+	pipe.SAdd(ctx, key, values...)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (c RedisCache) SRem(ctx context.Context, key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return c.redis.SRem(ctx, key, values...).Err()
+}
+
+func (c RedisCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	return c.redis.SMembers(ctx, key).Result()
+}
+
+func (c RedisCache) HSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	pipe := c.redis.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (c RedisCache) HGet(ctx context.Context, key, field string) (string, error) {
+	value, err := c.redis.HGet(ctx, key, field).Result()
+	return value, cacheMiss(err)
+}
+
+func (c RedisCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.redis.HGetAll(ctx, key).Result()
+}
+
+func (c RedisCache) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return c.redis.HDel(ctx, key, fields...).Result()
+}
+
+func (c RedisCache) HExists(ctx context.Context, key, field string) (bool, error) {
+	return c.redis.HExists(ctx, key, field).Result()
+}
+
+// slidingWindow keeps one sorted-set entry per admitted request, scored by
+// its time in milliseconds. Entries older than the window are trimmed before
+// counting, and a request is only recorded if it fits under the limit. It
+// returns {admitted, count, oldest score}.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+local count = redis.call("ZCARD", key)
+local admitted = 0
+if count < limit then
+	redis.call("ZADD", key, now, member)
+	count = count + 1
+	admitted = 1
+end
+redis.call("PEXPIRE", key, window)
+
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+return {admitted, count, tonumber(oldest[2] or now)}
+`)
+
+// windowSequence keeps sorted-set members unique when two requests arrive
+// in the same nanosecond.
+var windowSequence atomic.Uint64
+
+func (c RedisCache) SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (Window, error) {
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 36) + ":" + strconv.FormatUint(windowSequence.Add(1), 36)
+
+	result, err := slidingWindow.Run(ctx, c.redis, []string{key},
+		now.UnixMilli(), window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return Window{}, err
+	}
+
+	return Window{
+		Admitted: result[0] == 1,
+		Count:    result[1],
+		Oldest:   time.UnixMilli(result[2]),
+	}, nil
+}
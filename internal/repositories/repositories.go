@@ -0,0 +1,227 @@
+// Package repositories is the storage layer behind the services. Each store
+// is an interface with a production implementation over MongoDB, Neo4j or
+// Redis and an in-memory one, so the whole API can run inside a test
+// without any of those servers.
+package repositories
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"manga_store/internal/search"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrVersionConflict = errors.New("version conflict")
+	ErrCacheMiss       = errors.New("cache miss")
+)
+
+// Transactor runs a unit of work atomically. Repository calls made with the
+// context fn receives take part in the transaction; calls made with any
+// other context do not.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// MangaRepository stores the catalog. Unless a method says otherwise it
+// only sees manga that have not been deleted.
+type MangaRepository interface {
+	Get(ctx context.Context, id string) (*models.Manga, error)
+	// GetWithDeleted also finds manga in the trash.
+	GetWithDeleted(ctx context.Context, id string) (*models.Manga, error)
+	// Find returns the manga among ids, in no particular order.
+	Find(ctx context.Context, ids []string) ([]models.Manga, error)
+	All(ctx context.Context) ([]models.Manga, error)
+	List(ctx context.Context, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Manga], error)
+	Search(ctx context.Context, query MangaSearch) (*models.SearchMangaResponse, error)
+	// Popular returns the best sellers, ties broken by views.
+	Popular(ctx context.Context, limit int) ([]models.Manga, error)
+	// Trash returns deleted manga, most recently deleted first.
+	Trash(ctx context.Context) ([]models.Manga, error)
+
+	Create(ctx context.Context, manga models.Manga) (*models.Manga, error)
+	// Update applies the fields set in update, provided the manga is still
+	// at update.Version, and bumps the version. It returns ErrNotFound or
+	// ErrVersionConflict when nothing was updated.
+	Update(ctx context.Context, id string, update models.UpdateMangaRequest, updatedAt int) (*models.Manga, error)
+	Delete(ctx context.Context, id string, deletedAt int) error
+	// Restore takes a manga out of the trash and bumps its version.
+	Restore(ctx context.Context, id string, restoredAt int) (*models.Manga, error)
+	// Purge removes manga deleted at or before deletedBefore for good.
+	Purge(ctx context.Context, deletedBefore int) (int64, error)
+	IncrementViews(ctx context.Context, id string) error
+	SetRating(ctx context.Context, id string, rating float64, ratedTimes int) error
+	// ReserveStock takes quantity copies only if that many are left, and
+	// reports whether it did.
+	ReserveStock(ctx context.Context, id string, quantity int) (bool, error)
+	// ReleaseStock puts copies back, whether or not the manga is deleted.
+	ReleaseStock(ctx context.Context, id string, quantity int) error
+}
+
+// MangaSearch is a catalog search as the repository runs it. When Ranked is
+// not nil only those manga can match; with ByRank they are returned in that
+// order and paged by Cursor.Offset, otherwise they are paged by Keyset.
+type MangaSearch struct {
+	Request models.SearchMangaRequest
+	Ranked  []string
+	ByRank  bool
+	Sort    string
+	Keyset  pagination.Keyset
+	Cursor  pagination.Cursor
+	Limit   int
+}
+
+// UserRepository stores accounts along with their ratings and two-factor
+// settings. Get finds deleted users too; the other lookups do not.
+type UserRepository interface {
+	Get(ctx context.Context, id string) (*models.User, error)
+	GetActive(ctx context.Context, id string) (*models.User, error)
+	GetActiveByEmail(ctx context.Context, email string) (*models.User, error)
+	// Raters returns the active users who have rated a manga.
+	Raters(ctx context.Context, mangaID string) ([]models.User, error)
+	// All returns every active user.
+	All(ctx context.Context) ([]models.User, error)
+	// ActivePurchasers returns the IDs of the active users among buyerIDs,
+	// and of those with mangaID in the purchase history kept on the user.
+	ActivePurchasers(ctx context.Context, mangaID string, buyerIDs []string) ([]string, error)
+
+	Create(ctx context.Context, user models.User) (*models.User, error)
+	SetDeleted(ctx context.Context, id string, deleted bool) error
+	VerifyEmail(ctx context.Context, id string) error
+	// ResetPassword changes an active user's password and marks the email
+	// verified.
+	ResetPassword(ctx context.Context, id, passwordHash string) error
+
+	AddRating(ctx context.Context, id string, rating models.Rating) error
+	UpdateRating(ctx context.Context, id string, rating models.Rating) error
+	RemoveRating(ctx context.Context, id, mangaID string) error
+
+	// SetTwoFactor replaces the user's two-factor settings; nil removes them.
+	SetTwoFactor(ctx context.Context, id string, twoFactor *models.TwoFactor) error
+	// EnableTwoFactor turns on two-factor authentication set up with secret,
+	// and reports false if it was already enabled or set up again since.
+	EnableTwoFactor(ctx context.Context, id, secret string, step int64, recoveryCodes []string) (bool, error)
+	SetRecoveryCodes(ctx context.Context, id string, hashes []string) error
+	// UseTOTPStep records a TOTP time step as used, and reports false if the
+	// same or a later step was used already.
+	UseTOTPStep(ctx context.Context, id string, step int64) (bool, error)
+	// UseRecoveryCode removes a recovery code, and reports false if the user
+	// does not have it.
+	UseRecoveryCode(ctx context.Context, id, hash string) (bool, error)
+}
+
+// OrderRepository stores orders.
+type OrderRepository interface {
+	Create(ctx context.Context, order models.Order) (*models.Order, error)
+	Get(ctx context.Context, id string) (*models.Order, error)
+	// ForUser returns every order the user placed, newest first.
+	ForUser(ctx context.Context, userID string) ([]models.Order, error)
+	List(ctx context.Context, filter OrderFilter, sort string, keyset pagination.Keyset, params pagination.Params) (pagination.Page[models.Order], error)
+	// Transition moves an order on from status from and records change. It
+	// returns ErrNotFound if the order is no longer in status from.
+	Transition(ctx context.Context, id string, from models.OrderStatus, change models.OrderStatusChange) (*models.Order, error)
+	// Buyers returns the IDs of users with an active order for a manga.
+	Buyers(ctx context.Context, mangaID string) ([]string, error)
+}
+
+// OrderFilter narrows an order list; zero fields match every order.
+type OrderFilter struct {
+	UserID string
+	Status models.OrderStatus
+}
+
+// AuditRepository stores authorization decisions.
+type AuditRepository interface {
+	Record(ctx context.Context, entry models.AuditEntry) error
+}
+
+// Outbox queues graph changes. Record them with the context of the
+// transaction making the matching write, so the change reaches the graph
+// only if the write commits. The other methods are for GraphSyncRelay.
+type Outbox interface {
+	Record(ctx context.Context, eventType models.GraphEventType, payload models.GraphEventPayload) error
+	// Claim leases the oldest pending event that is due for lease, or
+	// returns nil when there is none. An event is not due while an earlier
+	// one sharing a key with it is still pending, so events for the same
+	// user or manga are applied one at a time, in order. Events parked as
+	// failed hold nothing back.
+	Claim(ctx context.Context, lease time.Duration) (*models.GraphEvent, error)
+	// Complete marks a claimed event processed.
+	Complete(ctx context.Context, id string) error
+	// Fail stores the status, attempts, error and next attempt the relay set
+	// on a claimed event after it failed, and releases the lease.
+	Fail(ctx context.Context, event models.GraphEvent) error
+}
+
+// GraphStore holds the graph the recommendations are computed from.
+type GraphStore interface {
+	// Apply makes the change an outbox event describes. Applying the same
+	// event twice is harmless.
+	Apply(ctx context.Context, event models.GraphEvent) error
+	// RecommendByPreferences ranks unseen manga by how many genres they
+	// share with the ones the user rated above 4.
+	RecommendByPreferences(ctx context.Context, userID string, skip, limit int) ([]string, error)
+	// RecommendBySimilarUsers ranks unseen manga by the average score given
+	// by users who rated the same manga above 4 as the user did.
+	RecommendBySimilarUsers(ctx context.Context, userID string, skip, limit int) ([]string, error)
+	// Snapshot reads the nodes and the RATED and PURCHASED edges, for
+	// comparing the graph with MongoDB.
+	Snapshot(ctx context.Context) (*models.GraphSnapshot, error)
+}
+
+// Cache is the key-value store for sessions, tokens, carts and counters.
+// A ttl of 0 means the key does not expire. Get, GetDel and HGet return
+// ErrCacheMiss for missing keys.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	GetDel(ctx context.Context, key string) (string, error)
+	Del(ctx context.Context, keys ...string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// TTL returns how long key has left, or 0 if it is missing or does not
+	// expire.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Incr(ctx context.Context, key string) (int64, error)
+
+	// SAdd adds members to a set and sets the whole set to expire after ttl.
+	SAdd(ctx context.Context, key string, ttl time.Duration, members ...string) error
+	SRem(ctx context.Context, key string, members ...string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+
+	// HSet sets a hash field and sets the whole hash to expire after ttl.
+	HSet(ctx context.Context, key, field, value string, ttl time.Duration) error
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) (int64, error)
+	HExists(ctx context.Context, key, field string) (bool, error)
+
+	// SlidingWindow admits one request against a limit per window.
+	SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (Window, error)
+}
+
+// Window is the state of a sliding window after a request was counted.
+type Window struct {
+	Admitted bool
+	Count    int64
+	Oldest   time.Time
+}
+
+// Stores is everything the services persist to. The search index and the
+// suggester are derived from the catalog and live alongside it, so every
+// service built from the same Stores sees the same ones.
+type Stores struct {
+	Tx        Transactor
+	Manga     MangaRepository
+	Users     UserRepository
+	Orders    OrderRepository
+	Audit     AuditRepository
+	Outbox    Outbox
+	Graph     GraphStore
+	Cache     Cache
+	Search    search.SearchIndex
+	Suggester *search.Suggester
+}
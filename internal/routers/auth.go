@@ -2,24 +2,41 @@ package routers
 
 import (
 	"manga_store/internal/handlers"
+	"manga_store/internal/mailer"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/repositories"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type AuthRouter struct {
 	authHandler handlers.AuthHandler
+	stores      repositories.Stores
 }
 
-func NewAuthRouter() AuthRouter {
+func NewAuthRouter(stores repositories.Stores, mail mailer.Mailer) AuthRouter {
 	return AuthRouter{
-		authHandler: handlers.NewAuthHandler(),
+		authHandler: handlers.NewAuthHandler(stores, mail),
+		stores:      stores,
 	}
 }
 
 func (r AuthRouter) SetupRoutes(app *fiber.App) {
-	authGroup := app.Group("auth")
+	authGroup := app.Group("auth", middlewares.RateLimit(r.stores.Cache, "auth"))
 
 	authGroup.Post("/register", r.authHandler.Register)
 	authGroup.Post("/login", r.authHandler.Login)
+	authGroup.Post("/login/verify", r.authHandler.CompleteLogin)
 	authGroup.Post("/logout", r.authHandler.Logout)
+	authGroup.Post("/logout/all", middlewares.Authenticate(r.stores), r.authHandler.LogoutEverywhere)
+
+	authGroup.Post("/token", r.authHandler.Token)
+	authGroup.Post("/token/verify", r.authHandler.CompleteToken)
+	authGroup.Post("/token/refresh", r.authHandler.RefreshToken)
+	authGroup.Post("/token/revoke", r.authHandler.RevokeToken)
+
+	authGroup.Get("/verify", r.authHandler.VerifyEmail)
+	authGroup.Post("/verify/resend", r.authHandler.ResendVerification)
+	authGroup.Post("/forgot-password", r.authHandler.ForgotPassword)
+	authGroup.Post("/reset-password", r.authHandler.ResetPassword)
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package routers
+
+import (
+	"manga_store/internal/handlers"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CartRouter struct {
+	cartHandler handlers.CartHandler
+	stores      repositories.Stores
+}
+
+func NewCartRouter(stores repositories.Stores) CartRouter {
+	return CartRouter{
+		cartHandler: handlers.NewCartHandler(stores),
+		stores:      stores,
+	}
+}
+
+func (r CartRouter) SetupRoutes(app *fiber.App) {
+	cartGroup := app.Group("/cart", middlewares.RateLimit(r.stores.Cache, "cart"))
+
+	cartGroup.Get("/", r.cartHandler.GetCart)
+	cartGroup.Post("/", r.cartHandler.AddItem)
+	cartGroup.Delete("/", r.cartHandler.ClearCart)
+	cartGroup.Post("/checkout", r.cartHandler.Checkout)
+
+	cartGroup.Put("/:mangaId", r.cartHandler.UpdateItem)
+	cartGroup.Delete("/:mangaId", r.cartHandler.RemoveItem)
+}
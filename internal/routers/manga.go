@@ -2,31 +2,41 @@ package routers
 
 import (
 	"manga_store/internal/handlers"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type MangaRouter struct {
 	mangaHandler handlers.MangaHandler
+	stores       repositories.Stores
 }
 
-func NewMangaRouter() MangaRouter {
+func NewMangaRouter(stores repositories.Stores) MangaRouter {
 	return MangaRouter{
-		mangaHandler: handlers.NewMangaHandler(),
+		mangaHandler: handlers.NewMangaHandler(stores),
+		stores:       stores,
 	}
 }
 
 func (r MangaRouter) SetupRoutes(app *fiber.App) {
-	mangaGroup := app.Group("/manga")
+	mangaGroup := app.Group("/manga", middlewares.RateLimit(r.stores.Cache, "manga"))
+	catalogEditor := middlewares.RequireRole(r.stores, models.RoleCatalogEditor)
 
-	mangaGroup.Get("/", r.mangaHandler.GetNewestManga)
-	mangaGroup.Post("/", r.mangaHandler.CreateManga)
-	mangaGroup.Post("/search", r.mangaHandler.SearchManga)
+	mangaGroup.Get("/", r.mangaHandler.ListManga)
+	mangaGroup.Post("/", catalogEditor, r.mangaHandler.CreateManga)
+	mangaGroup.Post("/search", middlewares.RateLimit(r.stores.Cache, "search"), r.mangaHandler.SearchManga)
+	mangaGroup.Get("/suggest", r.mangaHandler.SuggestManga)
 	mangaGroup.Get("/popular", r.mangaHandler.GetPopularManga)
 	mangaGroup.Post("/purchase", r.mangaHandler.PurchaseManga)
+	mangaGroup.Get("/trash", catalogEditor, r.mangaHandler.GetTrash)
 	
 	mangaGroup.Get("/:id", r.mangaHandler.GetMangaByID)
-	mangaGroup.Delete("/:id", r.mangaHandler.DeleteManga)
+	mangaGroup.Patch("/:id", catalogEditor, r.mangaHandler.UpdateManga)
+	mangaGroup.Delete("/:id", catalogEditor, r.mangaHandler.DeleteManga)
+	mangaGroup.Post("/:id/restore", catalogEditor, r.mangaHandler.RestoreManga)
 	mangaGroup.Post("/:id/rate", r.mangaHandler.RateManga)
 	mangaGroup.Delete("/:id/rate", r.mangaHandler.RemoveMangaRating)
 }
@@ -0,0 +1,34 @@
+package routers
+
+import (
+	"manga_store/internal/handlers"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OrderRouter struct {
+	orderHandler handlers.OrderHandler
+	stores       repositories.Stores
+}
+
+func NewOrderRouter(stores repositories.Stores) OrderRouter {
+	return OrderRouter{
+		orderHandler: handlers.NewOrderHandler(stores),
+		stores:       stores,
+	}
+}
+
+func (r OrderRouter) SetupRoutes(app *fiber.App) {
+	orderGroup := app.Group("/orders", middlewares.RateLimit(r.stores.Cache, "orders"))
+	orderManager := middlewares.RequireRole(r.stores, models.RoleOrderManager)
+
+	orderGroup.Get("/", r.orderHandler.GetOrders)
+	orderGroup.Get("/all", orderManager, r.orderHandler.ListOrders)
+
+	orderGroup.Get("/:id", r.orderHandler.GetOrder)
+	orderGroup.Post("/:id/cancel", r.orderHandler.CancelOrder)
+	orderGroup.Patch("/:id/status", orderManager, r.orderHandler.UpdateOrderStatus)
+}
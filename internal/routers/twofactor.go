@@ -0,0 +1,29 @@
+package routers
+
+import (
+	"manga_store/internal/handlers"
+	"manga_store/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TwoFactorRouter struct {
+	twoFactorHandler handlers.TwoFactorHandler
+	stores           repositories.Stores
+}
+
+func NewTwoFactorRouter(stores repositories.Stores) TwoFactorRouter {
+	return TwoFactorRouter{
+		twoFactorHandler: handlers.NewTwoFactorHandler(stores),
+		stores:           stores,
+	}
+}
+
+func (r TwoFactorRouter) SetupRoutes(app *fiber.App) {
+	twoFactorGroup := app.Group("/user/2fa")
+
+	twoFactorGroup.Post("/setup", r.twoFactorHandler.Setup)
+	twoFactorGroup.Post("/enable", r.twoFactorHandler.Enable)
+	twoFactorGroup.Post("/disable", r.twoFactorHandler.Disable)
+	twoFactorGroup.Post("/recovery-codes", r.twoFactorHandler.RegenerateRecoveryCodes)
+}
@@ -2,26 +2,33 @@ package routers
 
 import (
 	"manga_store/internal/handlers"
+	"manga_store/internal/middlewares"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type UserRouter struct {
 	UserHandler handlers.UserHandler
+	stores      repositories.Stores
 }
 
-func NewUserRouter() UserRouter {
+func NewUserRouter(stores repositories.Stores) UserRouter {
 	return UserRouter{
-		UserHandler: handlers.NewUserHandler(),
+		UserHandler: handlers.NewUserHandler(stores),
+		stores:      stores,
 	}
 }
 
 func (r UserRouter) SetupRoutes(app *fiber.App) {
-	userGroup := app.Group("/user")
+	userGroup := app.Group("/user", middlewares.RateLimit(r.stores.Cache, "user"))
+	support := middlewares.RequireRole(r.stores, models.RoleSupport)
 
 	userGroup.Get("/", r.UserHandler.GetUser)
 	userGroup.Delete("/", r.UserHandler.DeleteUser)
-	userGroup.Post("/restore/:id", r.UserHandler.RestoreUser)
+	userGroup.Post("/restore/:id", support, r.UserHandler.RestoreUser)
+	userGroup.Post("/unlock", support, r.UserHandler.UnlockLogin)
 
 	userGroup.Get("/recs/preferences", r.UserHandler.GetRecsByPreferences)
 	userGroup.Get("/recs/similar_users", r.UserHandler.GetRecsBySimilarUsers)
@@ -0,0 +1,94 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "has": true,
+	"he": true, "her": true, "his": true, "in": true, "into": true, "is": true,
+	"it": true, "its": true, "of": true, "on": true, "or": true, "she": true,
+	"that": true, "the": true, "their": true, "them": true, "they": true,
+	"this": true, "to": true, "was": true, "were": true, "who": true,
+	"will": true, "with": true,
+}
+
+// Analyze splits text into lower-cased, stemmed terms, dropping stopwords.
+// Documents and queries must go through the same analysis to match.
+func Analyze(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if stopwords[word] {
+			continue
+		}
+		terms = append(terms, Stem(word))
+	}
+
+	return terms
+}
+
+// Stem reduces an English word to a rough stem by stripping common
+// inflections, so "stories", "fighting" and "loved" match "story", "fight"
+// and "love". It is deliberately lighter than a full Porter stemmer: words
+// it does not recognise are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 3 || !isASCII(word) {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed"} {
+		stem, ok := strings.CutSuffix(word, suffix)
+		if ok && len(stem) >= 3 && hasVowel(stem) {
+			word = undouble(stem)
+			break
+		}
+	}
+
+	if stem, ok := strings.CutSuffix(word, "ly"); ok && len(stem) >= 4 {
+		word = stem
+	}
+
+	if stem, ok := strings.CutSuffix(word, "e"); ok && len(stem) >= 3 {
+		word = stem
+	}
+
+	return word
+}
+
+// undouble turns the "runn" left by "running" back into "run".
+func undouble(stem string) string {
+	n := len(stem)
+	if n >= 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+func hasVowel(word string) bool {
+	return strings.ContainsAny(word, "aeiouy")
+}
+
+func isASCII(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"stories":  "story",
+		"fighting": "fight",
+		"fights":   "fight",
+		"loved":    "lov",
+		"love":     "lov",
+		"running":  "run",
+		"classes":  "class",
+		"bus":      "bus",
+		"quickly":  "quick",
+		"ninja":    "ninja",
+		"one":      "one",
+		"naïve":    "naïve",
+	}
+
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	got := Analyze("The Promised Neverland: Children's Escape!")
+	want := []string{"promis", "neverland", "children", "s", "escap"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Analyze = %q, want %q", got, want)
+	}
+}
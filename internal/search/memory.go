@@ -0,0 +1,257 @@
+package search
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldAuthor
+	fieldDescription
+	numFields
+)
+
+// BM25 parameters: k1 controls how quickly repeated terms stop adding to the
+// score, b how strongly long fields are penalised.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Boosts weigh a match in each field, so a title match outranks the same
+// match in a description.
+type Boosts struct {
+	Title       float64
+	Author      float64
+	Description float64
+}
+
+var DefaultBoosts = Boosts{Title: 3, Author: 2, Description: 1}
+
+type memoryDoc struct {
+	lengths   [numFields]int
+	terms     []string
+	genres    []string
+	author    string
+	createdAt int
+}
+
+// MemoryIndex is an in-process inverted index over the catalog, ranked with
+// BM25 across title, author and description. It is safe for concurrent use.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	boosts   [numFields]float64
+	docs     map[string]*memoryDoc
+	postings map[string]map[string]*[numFields]int
+	totalLen [numFields]int
+}
+
+func NewMemoryIndex(boosts Boosts) *MemoryIndex {
+	return &MemoryIndex{
+		boosts:   [numFields]float64{boosts.Title, boosts.Author, boosts.Description},
+		docs:     map[string]*memoryDoc{},
+		postings: map[string]map[string]*[numFields]int{},
+	}
+}
+
+// Load replaces the whole index with manga. The new index is built before
+// it is swapped in, so searches keep being served while it loads.
+func (idx *MemoryIndex) Load(ctx context.Context, manga []models.Manga) error {
+	fresh := NewMemoryIndex(Boosts{})
+	if err := fresh.Index(ctx, manga...); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs, idx.postings, idx.totalLen = fresh.docs, fresh.postings, fresh.totalLen
+	return nil
+}
+
+func (idx *MemoryIndex) Index(ctx context.Context, manga ...models.Manga) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, m := range manga {
+		idx.remove(m.ID)
+		if m.IsDeleted {
+			continue
+		}
+
+		doc := &memoryDoc{
+			genres:    m.Genres,
+			author:    strings.ToLower(m.Author),
+			createdAt: m.CreatedAt,
+		}
+		fields := [numFields]string{m.Title, m.Author, m.Description}
+		for f, text := range fields {
+			terms := Analyze(text)
+			doc.lengths[f] = len(terms)
+			idx.totalLen[f] += len(terms)
+
+			for _, term := range terms {
+				postings, ok := idx.postings[term]
+				if !ok {
+					postings = map[string]*[numFields]int{}
+					idx.postings[term] = postings
+				}
+				freqs, ok := postings[m.ID]
+				if !ok {
+					freqs = &[numFields]int{}
+					postings[m.ID] = freqs
+					doc.terms = append(doc.terms, term)
+				}
+				freqs[f]++
+			}
+		}
+
+		idx.docs[m.ID] = doc
+	}
+
+	return nil
+}
+
+func (idx *MemoryIndex) Remove(ctx context.Context, ids ...string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range ids {
+		idx.remove(id)
+	}
+
+	return nil
+}
+
+func (idx *MemoryIndex) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	for f := range doc.lengths {
+		idx.totalLen[f] -= doc.lengths[f]
+	}
+	delete(idx.docs, id)
+}
+
+func (idx *MemoryIndex) Search(ctx context.Context, q Query) ([]Hit, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	author := strings.ToLower(strings.TrimSpace(q.Author))
+	matches := func(doc *memoryDoc) bool {
+		if author != "" && !strings.Contains(doc.author, author) {
+			return false
+		}
+		return hasAllGenres(doc.genres, q.Genres)
+	}
+
+	scores := map[string]float64{}
+	terms := uniqueTerms(Analyze(q.Text))
+	if len(terms) == 0 {
+		for id, doc := range idx.docs {
+			if matches(doc) {
+				scores[id] = 0
+			}
+		}
+	}
+
+	n := float64(len(idx.docs))
+	var avgLen [numFields]float64
+	for f := range avgLen {
+		if n > 0 {
+			avgLen[f] = float64(idx.totalLen[f]) / n
+		}
+	}
+
+	for _, term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, freqs := range postings {
+			doc := idx.docs[id]
+			if !matches(doc) {
+				continue
+			}
+
+			for f, tf := range freqs {
+				if tf == 0 {
+					continue
+				}
+				norm := 1.0
+				if avgLen[f] > 0 {
+					norm = 1 - bm25B + bm25B*float64(doc.lengths[f])/avgLen[f]
+				}
+				scores[id] += idx.boosts[f] * idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		ci, cj := idx.docs[hits[i].ID].createdAt, idx.docs[hits[j].ID].createdAt
+		if ci != cj {
+			return ci > cj
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	return hits, nil
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := map[string]bool{}
+	unique := terms[:0]
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+func hasAllGenres(have, want []string) bool {
+	for _, genre := range want {
+		found := false
+		for _, g := range have {
+			if g == genre {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"slices"
+	"testing"
+)
+
+func loadIndex(t *testing.T, manga ...models.Manga) *MemoryIndex {
+	t.Helper()
+
+	idx := NewMemoryIndex(DefaultBoosts)
+	if err := idx.Index(context.Background(), manga...); err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func searchIDs(t *testing.T, idx *MemoryIndex, q Query) []string {
+	t.Helper()
+
+	hits, err := idx.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestTitleMatchOutranksDescriptionMatch(t *testing.T) {
+	idx := loadIndex(t,
+		models.Manga{ID: "description", Title: "Blade of the Immortal", Description: "A samurai hunts a monster across Japan."},
+		models.Manga{ID: "title", Title: "Monster", Description: "A surgeon hunts a former patient across Germany."},
+		models.Manga{ID: "neither", Title: "Yotsuba&!", Description: "A girl moves to a new town."},
+	)
+
+	got := searchIDs(t, idx, Query{Text: "monster"})
+	if want := []string{"title", "description"}; !slices.Equal(got, want) {
+		t.Errorf("search for monster = %v, want %v", got, want)
+	}
+}
+
+func TestAuthorMatchOutranksDescriptionMatch(t *testing.T) {
+	idx := loadIndex(t,
+		models.Manga{ID: "description", Title: "Pluto", Description: "A tribute to Urasawa's favourite robot story."},
+		models.Manga{ID: "author", Title: "20th Century Boys", Author: "Naoki Urasawa", Description: "Childhood friends face a cult."},
+	)
+
+	got := searchIDs(t, idx, Query{Text: "urasawa"})
+	if want := []string{"author", "description"}; !slices.Equal(got, want) {
+		t.Errorf("search for urasawa = %v, want %v", got, want)
+	}
+}
+
+func TestStemmedFormsMatch(t *testing.T) {
+	idx := loadIndex(t,
+		models.Manga{ID: "fight", Title: "Fighting Spirit", Description: "A bullied boy takes up boxing."},
+		models.Manga{ID: "story", Title: "Ghost Stories", Description: "Haunted school tales."},
+		models.Manga{ID: "love", Title: "Kaguya-sama", Description: "Two students loved by the school refuse to confess."},
+	)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"fight", []string{"fight"}},
+		{"fights", []string{"fight"}},
+		{"story", []string{"story"}},
+		{"loving", []string{"love"}},
+		{"haunting", []string{"story"}},
+	}
+
+	for _, test := range tests {
+		got := searchIDs(t, idx, Query{Text: test.query})
+		if !slices.Equal(got, test.want) {
+			t.Errorf("search for %q = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestRemovedMangaDropOut(t *testing.T) {
+	ctx := context.Background()
+	idx := loadIndex(t,
+		models.Manga{ID: "berserk", Title: "Berserk", Description: "A mercenary's dark fantasy."},
+		models.Manga{ID: "claymore", Title: "Claymore", Description: "Dark fantasy about half-demon warriors."},
+	)
+
+	if err := idx.Remove(ctx, "berserk", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, idx, Query{Text: "berserk"}); len(got) != 0 {
+		t.Errorf("removed manga still found: %v", got)
+	}
+	if got := searchIDs(t, idx, Query{Text: "dark fantasy"}); !slices.Equal(got, []string{"claymore"}) {
+		t.Errorf("search after remove = %v, want [claymore]", got)
+	}
+
+	// Indexing a deleted copy, as the trash does, drops it too.
+	if err := idx.Index(ctx, models.Manga{ID: "claymore", Title: "Claymore", IsDeleted: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, idx, Query{}); len(got) != 0 {
+		t.Errorf("deleted manga still listed: %v", got)
+	}
+}
+
+func TestReindexReplacesTheOldCopy(t *testing.T) {
+	idx := loadIndex(t, models.Manga{ID: "1", Title: "Dragon Ball"})
+
+	if err := idx.Index(context.Background(), models.Manga{ID: "1", Title: "Dragon Ball Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, idx, Query{Text: "dragon"}); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("search for dragon = %v, want one hit", got)
+	}
+	if got := searchIDs(t, idx, Query{Text: "z"}); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("search for the new title = %v, want [1]", got)
+	}
+}
+
+func TestFiltersNarrowResults(t *testing.T) {
+	idx := loadIndex(t,
+		models.Manga{ID: "vinland", Title: "Vinland Saga", Author: "Makoto Yukimura", Genres: []string{"action", "history"}, Description: "Vikings at war."},
+		models.Manga{ID: "berserk", Title: "Berserk", Author: "Kentaro Miura", Genres: []string{"action"}, Description: "War and demons."},
+	)
+
+	if got := searchIDs(t, idx, Query{Text: "war", Genres: []string{"history"}}); !slices.Equal(got, []string{"vinland"}) {
+		t.Errorf("genre filter = %v, want [vinland]", got)
+	}
+	if got := searchIDs(t, idx, Query{Text: "war", Author: "miura"}); !slices.Equal(got, []string{"berserk"}) {
+		t.Errorf("author filter = %v, want [berserk]", got)
+	}
+	if got := searchIDs(t, idx, Query{Text: "war", Limit: 1}); len(got) != 1 {
+		t.Errorf("limit 1 returned %v", got)
+	}
+}
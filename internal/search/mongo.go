@@ -0,0 +1,77 @@
+package search
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoIndex searches the manga collection through its weighted text index
+// (see the catalog_text migration). The collection is the index, so Index
+// and Remove have nothing to do.
+type MongoIndex struct {
+	manga *mongo.Collection
+}
+
+func NewMongoIndex(manga *mongo.Collection) MongoIndex {
+	return MongoIndex{manga: manga}
+}
+
+func (idx MongoIndex) Index(ctx context.Context, manga ...models.Manga) error {
+	return nil
+}
+
+func (idx MongoIndex) Remove(ctx context.Context, ids ...string) error {
+	return nil
+}
+
+func (idx MongoIndex) Search(ctx context.Context, q Query) ([]Hit, error) {
+	filter := bson.M{"isDeleted": false}
+	if len(q.Genres) > 0 {
+		filter["genres"] = bson.M{"$all": q.Genres}
+	}
+	if author := strings.TrimSpace(q.Author); author != "" {
+		filter["author"] = primitive.Regex{Pattern: regexp.QuoteMeta(author), Options: "i"}
+	}
+
+	findOptions := options.Find()
+	if text := strings.TrimSpace(q.Text); text != "" {
+		filter["$text"] = bson.M{"$search": text}
+		findOptions.
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "createdAt", Value: -1}})
+	} else {
+		findOptions.
+			SetProjection(bson.M{"_id": 1}).
+			SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	}
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := idx.manga.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Score float64            `bson:"score"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, Hit{ID: result.ID.Hex(), Score: result.Score})
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,37 @@
+// Package search ranks catalog manga for free-text queries. Two indexes are
+// provided: MongoIndex uses a MongoDB text index and keeps nothing in memory,
+// while MemoryIndex is an embedded inverted index scored with BM25 that must
+// be loaded and kept up to date by its owner.
+package search
+
+import (
+	"context"
+	"manga_store/internal/models"
+)
+
+// Query is a catalog search. Text is matched against title, author and
+// description; Genres and Author narrow the results without affecting their
+// score. With no Text, matches are returned newest first. A Limit of 0
+// returns every match.
+type Query struct {
+	Text   string
+	Genres []string
+	Author string
+	Limit  int
+}
+
+// Hit is one matching manga and its relevance. Scores are only comparable
+// within the results of a single search.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+type SearchIndex interface {
+	// Index adds manga to the index, replacing any earlier copy.
+	Index(ctx context.Context, manga ...models.Manga) error
+	// Remove drops manga from the index. Unknown IDs are ignored.
+	Remove(ctx context.Context, ids ...string) error
+	// Search returns the best matches for q, most relevant first.
+	Search(ctx context.Context, q Query) ([]Hit, error)
+}
@@ -0,0 +1,380 @@
+package search
+
+import (
+	"manga_store/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	SuggestionTitle  = "title"
+	SuggestionAuthor = "author"
+
+	// maxCompletionCandidates bounds how many trie matches are ranked for
+	// one prefix, so a one-letter prefix stays cheap on a large catalog.
+	maxCompletionCandidates = 500
+)
+
+type Completion struct {
+	Text    string `json:"text"`
+	Type    string `json:"type"`
+	MangaID string `json:"mangaId,omitempty"`
+}
+
+type Suggestions struct {
+	Completions []Completion `json:"completions"`
+	// DidYouMean is the query with misspelled words replaced by the closest
+	// catalog words, or empty when every word is known.
+	DidYouMean string `json:"didYouMean,omitempty"`
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	keys     map[string]bool
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: map[rune]*trieNode{}}
+}
+
+type suggestion struct {
+	Completion
+	normalized string
+	weight     int
+}
+
+// Suggester completes title and author prefixes from an in-process trie and
+// corrects misspelled words by edit distance against the catalog's
+// vocabulary. Each title and author is indexed from every word, so "tit"
+// completes "Attack on Titan". It is safe for concurrent use.
+type Suggester struct {
+	mu         sync.RWMutex
+	root       *trieNode
+	entries    map[string]*suggestion
+	titles     map[string]models.Manga
+	authors    map[string]map[string]int
+	vocabulary map[string]int
+}
+
+func NewSuggester() *Suggester {
+	return &Suggester{
+		root:       newTrieNode(),
+		entries:    map[string]*suggestion{},
+		titles:     map[string]models.Manga{},
+		authors:    map[string]map[string]int{},
+		vocabulary: map[string]int{},
+	}
+}
+
+// Load replaces everything the suggester knows with manga.
+func (s *Suggester) Load(manga []models.Manga) {
+	fresh := NewSuggester()
+	for _, m := range manga {
+		fresh.add(m)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.root, s.entries, s.titles, s.authors, s.vocabulary = fresh.root, fresh.entries, fresh.titles, fresh.authors, fresh.vocabulary
+}
+
+// Add indexes a manga, replacing any earlier copy of it.
+func (s *Suggester) Add(manga models.Manga) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(manga.ID)
+	if !manga.IsDeleted {
+		s.add(manga)
+	}
+}
+
+func (s *Suggester) Remove(mangaID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(mangaID)
+}
+
+func popularity(manga models.Manga) int {
+	return manga.Sold*10 + manga.Views
+}
+
+func (s *Suggester) add(manga models.Manga) {
+	s.titles[manga.ID] = manga
+
+	title := &suggestion{
+		Completion: Completion{Text: manga.Title, Type: SuggestionTitle, MangaID: manga.ID},
+		normalized: normalize(manga.Title),
+		weight:     popularity(manga),
+	}
+	s.entries["title:"+manga.ID] = title
+	s.insert(title.normalized, "title:"+manga.ID)
+
+	if author := normalize(manga.Author); author != "" {
+		key := "author:" + author
+		if s.authors[author] == nil {
+			s.authors[author] = map[string]int{}
+			s.entries[key] = &suggestion{
+				Completion: Completion{Text: manga.Author, Type: SuggestionAuthor},
+				normalized: author,
+			}
+			s.insert(author, key)
+		}
+		s.authors[author][manga.ID] = popularity(manga)
+		s.entries[key].weight += popularity(manga)
+	}
+
+	for _, word := range vocabularyWords(manga) {
+		s.vocabulary[word]++
+	}
+}
+
+// remove forgets a manga. Its trie paths are left in place and skipped at
+// lookup, since other entries may share them; Load clears them out.
+func (s *Suggester) remove(mangaID string) {
+	manga, ok := s.titles[mangaID]
+	if !ok {
+		return
+	}
+	delete(s.titles, mangaID)
+	delete(s.entries, "title:"+mangaID)
+
+	author := normalize(manga.Author)
+	if weights, ok := s.authors[author]; ok {
+		key := "author:" + author
+		s.entries[key].weight -= weights[mangaID]
+		delete(weights, mangaID)
+		if len(weights) == 0 {
+			delete(s.authors, author)
+			delete(s.entries, key)
+		}
+	}
+
+	for _, word := range vocabularyWords(manga) {
+		s.vocabulary[word]--
+		if s.vocabulary[word] <= 0 {
+			delete(s.vocabulary, word)
+		}
+	}
+}
+
+// insert indexes key under text and under every suffix of text that starts
+// a word.
+func (s *Suggester) insert(text, key string) {
+	for start := 0; start < len(text); start++ {
+		if start > 0 && text[start-1] != ' ' {
+			continue
+		}
+
+		node := s.root
+		for _, r := range text[start:] {
+			child, ok := node.children[r]
+			if !ok {
+				child = newTrieNode()
+				node.children[r] = child
+			}
+			node = child
+		}
+		if node.keys == nil {
+			node.keys = map[string]bool{}
+		}
+		node.keys[key] = true
+	}
+}
+
+// Suggest returns up to limit completions for query, best first, and a
+// corrected query when some of its words are not in the catalog. When the
+// query as typed completes nothing, the corrected query is completed
+// instead.
+func (s *Suggester) Suggest(query string, limit int) Suggestions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix := normalize(query)
+	suggestions := Suggestions{Completions: []Completion{}}
+	if prefix == "" {
+		return suggestions
+	}
+
+	suggestions.Completions = s.complete(prefix, limit)
+
+	if corrected := s.correct(prefix); corrected != prefix {
+		suggestions.DidYouMean = corrected
+		if len(suggestions.Completions) == 0 {
+			suggestions.Completions = s.complete(corrected, limit)
+		}
+	}
+
+	return suggestions
+}
+
+func (s *Suggester) complete(prefix string, limit int) []Completion {
+	node := s.root
+	for _, r := range prefix {
+		node = node.children[r]
+		if node == nil {
+			return []Completion{}
+		}
+	}
+
+	seen := map[string]bool{}
+	var matches []*suggestion
+	var walk func(n *trieNode)
+	walk = func(n *trieNode) {
+		for key := range n.keys {
+			if len(matches) >= maxCompletionCandidates {
+				return
+			}
+			entry, ok := s.entries[key]
+			if !ok || seen[key] || !hasWordPrefix(entry.normalized, prefix) {
+				continue
+			}
+			seen[key] = true
+			matches = append(matches, entry)
+		}
+		for _, child := range n.children {
+			if len(matches) >= maxCompletionCandidates {
+				return
+			}
+			walk(child)
+		}
+	}
+	walk(node)
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		aStart, bStart := strings.HasPrefix(a.normalized, prefix), strings.HasPrefix(b.normalized, prefix)
+		if aStart != bStart {
+			return aStart
+		}
+		if a.weight != b.weight {
+			return a.weight > b.weight
+		}
+		return a.Text < b.Text
+	})
+
+	completions := make([]Completion, 0, min(limit, len(matches)))
+	for _, match := range matches {
+		if len(completions) == limit {
+			break
+		}
+		completions = append(completions, match.Completion)
+	}
+
+	return completions
+}
+
+// correct replaces each word of query that is not in the vocabulary with the
+// closest word that is. The last word is left alone while it is still the
+// start of a known word, since the shopper may not have finished typing it.
+func (s *Suggester) correct(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		if s.vocabulary[word] > 0 {
+			continue
+		}
+		if i == len(words)-1 && s.startsWord(word) {
+			continue
+		}
+		if closest, ok := s.closestWord(word); ok {
+			words[i] = closest
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+func (s *Suggester) startsWord(prefix string) bool {
+	node := s.root
+	for _, r := range prefix {
+		node = node.children[r]
+		if node == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// closestWord finds the vocabulary word nearest to word, allowing one edit
+// for short words and two for longer ones. Ties go to the more common word.
+func (s *Suggester) closestWord(word string) (string, bool) {
+	maxDistance := 1
+	if len([]rune(word)) > 4 {
+		maxDistance = 2
+	}
+
+	best, bestDistance, bestCount := "", maxDistance+1, 0
+	for candidate, count := range s.vocabulary {
+		distance := editDistance(word, candidate, maxDistance)
+		if distance < bestDistance ||
+			distance == bestDistance && (count > bestCount || count == bestCount && candidate < best) {
+			best, bestDistance, bestCount = candidate, distance, count
+		}
+	}
+
+	return best, best != "" && bestDistance <= maxDistance
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent letters each
+// cost one. Anything above max is reported as max+1.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return min(prev[len(rb)], max+1)
+}
+
+// normalize lower-cases text and collapses everything but letters and digits
+// into single spaces.
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func hasWordPrefix(text, prefix string) bool {
+	for start := 0; start < len(text); start++ {
+		if (start == 0 || text[start-1] == ' ') && strings.HasPrefix(text[start:], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func vocabularyWords(manga models.Manga) []string {
+	return strings.Fields(normalize(manga.Title + " " + manga.Author))
+}
@@ -0,0 +1,171 @@
+package search
+
+import (
+	"manga_store/internal/models"
+	"slices"
+	"testing"
+)
+
+func loadSuggester(manga ...models.Manga) *Suggester {
+	s := NewSuggester()
+	s.Load(manga)
+	return s
+}
+
+func completionTexts(suggestions Suggestions) []string {
+	texts := make([]string, 0, len(suggestions.Completions))
+	for _, completion := range suggestions.Completions {
+		texts = append(texts, completion.Text)
+	}
+	return texts
+}
+
+var suggestCatalog = []models.Manga{
+	{ID: "1", Title: "Attack on Titan", Author: "Hajime Isayama", Sold: 100},
+	{ID: "2", Title: "Berserk", Author: "Kentaro Miura", Sold: 50},
+	{ID: "3", Title: "Bleach", Author: "Tite Kubo", Sold: 80},
+	{ID: "4", Title: "Blue Lock", Author: "Muneyuki Kaneshiro", Sold: 10, Views: 200},
+	{ID: "5", Title: "Naruto", Author: "Masashi Kishimoto", Sold: 90},
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"naruto", "naruto", 2, 0},
+		{"narto", "naruto", 2, 1},
+		{"nauro", "naruto", 2, 2},
+		{"anruto", "naruto", 2, 1}, // adjacent swap
+		{"nrt", "naruto", 2, 3},    // length difference above max
+		{"bleech", "bleach", 1, 1},
+		{"blaach", "berserk", 2, 3},
+		{"", "a", 1, 1},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b, test.max); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.a, test.b, test.max, got, test.want)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// Short words allow one edit, longer ones two.
+		{"bleech", "bleach"},
+		{"beserk", "berserk"},
+		{"narot", "naruto"},
+		{"atack on titan", "attack on titan"},
+		{"lokc", "lock"},
+		{"lcko", ""},
+		// Known words and unfinished last words are left alone.
+		{"naruto", ""},
+		{"ber", ""},
+		{"kentaro miura", ""},
+		// Too far from anything in the catalog.
+		{"zzzzzz", ""},
+	}
+
+	for _, test := range tests {
+		if got := s.Suggest(test.query, 5).DidYouMean; got != test.want {
+			t.Errorf("Suggest(%q).DidYouMean = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestCompletionRanking(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	// Popularity is ten points a sale plus views: Bleach 800, Blue Lock 300.
+	if got, want := completionTexts(s.Suggest("bl", 5)), []string{"Bleach", "Blue Lock"}; !slices.Equal(got, want) {
+		t.Errorf("completions for bl = %v, want %v", got, want)
+	}
+
+	// Entries that start with the prefix come before those with a later
+	// word that does, however popular.
+	if got, want := completionTexts(s.Suggest("ti", 5)), []string{"Tite Kubo", "Attack on Titan"}; !slices.Equal(got, want) {
+		t.Errorf("completions for ti = %v, want %v", got, want)
+	}
+
+	if got := completionTexts(s.Suggest("b", 2)); len(got) != 2 {
+		t.Errorf("limit 2 returned %v", got)
+	}
+}
+
+func TestCompletionTypes(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	got := s.Suggest("miura", 5).Completions
+	want := []Completion{{Text: "Kentaro Miura", Type: SuggestionAuthor}}
+	if !slices.Equal(got, want) {
+		t.Errorf("completions for miura = %+v, want %+v", got, want)
+	}
+
+	got = s.Suggest("berserk", 5).Completions
+	want = []Completion{{Text: "Berserk", Type: SuggestionTitle, MangaID: "2"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("completions for berserk = %+v, want %+v", got, want)
+	}
+}
+
+func TestMisspelledQueryCompletesTheCorrection(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	suggestions := s.Suggest("narutp", 5)
+	if suggestions.DidYouMean != "naruto" {
+		t.Errorf("DidYouMean = %q, want naruto", suggestions.DidYouMean)
+	}
+	if got := completionTexts(suggestions); !slices.Equal(got, []string{"Naruto"}) {
+		t.Errorf("completions = %v, want [Naruto]", got)
+	}
+}
+
+func TestEmptyAndShortQueries(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	for _, query := range []string{"", "   ", "!?", "-"} {
+		suggestions := s.Suggest(query, 5)
+		if suggestions.Completions == nil || len(suggestions.Completions) != 0 || suggestions.DidYouMean != "" {
+			t.Errorf("Suggest(%q) = %+v, want no suggestions", query, suggestions)
+		}
+	}
+
+	// One letter completes every word starting with it.
+	if got, want := completionTexts(s.Suggest("N", 5)), []string{"Naruto"}; !slices.Equal(got, want) {
+		t.Errorf("completions for N = %v, want %v", got, want)
+	}
+	// A letter no word starts with completes nothing, and no word is within
+	// the one edit a short word is allowed.
+	if suggestions := s.Suggest("q", 5); len(suggestions.Completions) != 0 || suggestions.DidYouMean != "" {
+		t.Errorf("Suggest(q) = %+v, want no suggestions", suggestions)
+	}
+
+	empty := NewSuggester().Suggest("naruto", 5)
+	if empty.Completions == nil || len(empty.Completions) != 0 || empty.DidYouMean != "" {
+		t.Errorf("empty suggester returned %+v", empty)
+	}
+}
+
+func TestRemovedMangaAreNotSuggested(t *testing.T) {
+	s := loadSuggester(suggestCatalog...)
+
+	s.Remove("2")
+	if got := completionTexts(s.Suggest("ber", 5)); len(got) != 0 {
+		t.Errorf("completions after remove = %v, want none", got)
+	}
+	if got := s.Suggest("beserk", 5).DidYouMean; got != "" {
+		t.Errorf("DidYouMean after remove = %q, want none", got)
+	}
+
+	s.Add(models.Manga{ID: "3", Title: "Bleach", Author: "Tite Kubo", IsDeleted: true})
+	if got := completionTexts(s.Suggest("kubo", 5)); len(got) != 0 {
+		t.Errorf("completions for a deleted manga's author = %v, want none", got)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"manga_store/internal/logger"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"time"
+)
+
+type AuditService struct {
+	auditLog repositories.AuditRepository
+}
+
+func NewAuditService(stores repositories.Stores) AuditService {
+	return AuditService{
+		auditLog: stores.Audit,
+	}
+}
+
+// Record stores an authorization decision. A failed write is logged rather
+// than returned so the audit log can never take the API down with it. The
+// decision has been made by then, so it is recorded even if the request has
+// been cancelled.
+func (s AuditService) Record(ctx context.Context, entry models.AuditEntry) {
+	ctx, cancel := withTimeout(context.WithoutCancel(ctx), opCache)
+	defer cancel()
+
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().Unix()
+	}
+
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		logger.Error("Failed to write audit entry for " + entry.Method + " " + entry.Path + ": " + err.Error())
+	}
+}
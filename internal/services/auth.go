@@ -2,40 +2,85 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
-	"manga_store/internal/databases"
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"manga_store/internal/mailer"
 	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"net/url"
 	"time"
 
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	authTokenPrefix      = "auth_token:"
+	loginChallengePrefix = "login_challenge:"
+
+	verifyEmailPurpose   = "verify_email"
+	resetPasswordPurpose = "reset_password"
+
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+
+	loginChallengeTTL      = 5 * time.Minute
+	loginChallengeAttempts = 5
+
+	minPasswordLength = 8
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailNotVerified   = errors.New("email address has not been verified")
+	ErrEmailTaken         = errors.New("user with this email already exists")
+	ErrInvalidAuthToken   = errors.New("link is invalid or has expired")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+
+	ErrInvalidLoginChallenge = errors.New("login challenge is invalid or has expired, log in again")
+)
+
 type AuthService struct {
-	users *mongo.Collection
-	neo4j neo4j.SessionWithContext
+	tx        repositories.Transactor
+	users     repositories.UserRepository
+	outbox    repositories.Outbox
+	cache     repositories.Cache
+	mailer    mailer.Mailer
+	twoFactor TwoFactorService
+	apiURL    string
+	clientURL string
 }
 
-func NewAuthService() AuthService {
+func NewAuthService(stores repositories.Stores, mail mailer.Mailer) AuthService {
 	return AuthService{
-		users: databases.Users(),
-		neo4j: databases.Neo4j(context.Background()),
+		tx:        stores.Tx,
+		users:     stores.Users,
+		outbox:    stores.Outbox,
+		cache:     stores.Cache,
+		mailer:    mail,
+		twoFactor: NewTwoFactorService(stores),
+		apiURL:    helpers.GetEnv("API_URL", "http://localhost:3000"),
+		clientURL: helpers.GetEnv("CLIENT_URL", "http://localhost:5173"),
 	}
 }
 
-func (s AuthService) Register(email, password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s AuthService) Register(ctx context.Context, email, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	ctx, cancel := withTimeout(ctx, opWrite)
 	defer cancel()
 
-	var existingUser models.User
-	err := s.users.FindOne(ctx, bson.M{"email": email, "isDeleted": false}).Decode(&existingUser)
+	_, err := s.users.GetActiveByEmail(ctx, email)
 	if err == nil {
-		return errors.New("user with this email already exists")
+		return ErrEmailTaken
 	}
-	if err != mongo.ErrNoDocuments {
+	if !errors.Is(err, repositories.ErrNotFound) {
 		return err
 	}
 
@@ -50,48 +95,286 @@ func (s AuthService) Register(email, password string) error {
 		PurchaseHistory: []models.Purchase{},
 		Ratings:         []models.Rating{},
 	}
-	result, err := s.users.InsertOne(ctx, user)
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		created, err := s.users.Create(ctx, user)
+		if err != nil {
+			return err
+		}
+		user.ID = created.ID
+
+		return s.outbox.Record(ctx, models.GraphEventUserUpserted, models.GraphEventPayload{
+			UserID: user.ID,
+			Email:  email,
+		})
+	})
 	if err != nil {
 		return err
 	}
 
-	userID := result.InsertedID.(primitive.ObjectID).Hex()
+	// The account exists either way; a lost email can be sent again.
+	if err := s.sendVerification(ctx, user); err != nil {
+		logger.Error("Failed to send verification email to " + email + ": " + err.Error())
+	}
 
-	neo4jCtx := context.Background()
-	_, err = s.neo4j.ExecuteWrite(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(neo4jCtx, "CREATE (u:User {id: $id, email: $email})", map[string]interface{}{
-			"id":    userID,
-			"email": email,
-		})
-		return nil, err
-	})
+	return nil
+}
 
+// Login checks the user's password. For accounts with two-factor
+// authentication it returns a challenge instead of the user; the login is
+// finished by CompleteLogin with a code from the user's authenticator.
+func (s AuthService) Login(ctx context.Context, email, password string) (models.User, *models.LoginChallenge, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	user, err := s.users.GetActiveByEmail(ctx, email)
 	if err != nil {
-		_, _ = s.users.DeleteOne(ctx, bson.M{"_id": result.InsertedID})
-		return errors.New("failed to create user in Neo4j, registration rolled back")
+		return models.User{}, nil, ErrInvalidCredentials
 	}
 
-	return nil
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return models.User{}, nil, ErrInvalidCredentials
+	}
+
+	if !user.EmailVerified {
+		return models.User{}, nil, ErrEmailNotVerified
+	}
+
+	if user.TwoFactorEnabled() {
+		challenge, err := s.createLoginChallenge(ctx, user.ID)
+		if err != nil {
+			return models.User{}, nil, err
+		}
+		return models.User{}, challenge, nil
+	}
+
+	return *user, nil, nil
 }
 
-func (s AuthService) Login(email, password string) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ChallengeEmail returns the email of the user a login challenge was issued
+// to, so the second login step can be guarded by the same lockout as the
+// first.
+func (s AuthService) ChallengeEmail(ctx context.Context, challengeID string) (string, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
 	defer cancel()
 
-	var user models.User
-	err := s.users.FindOne(ctx, bson.M{"email": email, "isDeleted": false}).Decode(&user)
+	user, err := s.challengeUser(ctx, loginChallengePrefix+hashToken(challengeID))
 	if err != nil {
-		return models.User{}, errors.New("invalid email or password")
+		return "", err
 	}
+	return user.Email, nil
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+// CompleteLogin finishes a two-factor login. A challenge allows a handful of
+// wrong codes and is discarded once it succeeds or runs out of attempts.
+func (s AuthService) CompleteLogin(ctx context.Context, challengeID, code string) (models.User, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	key := loginChallengePrefix + hashToken(challengeID)
+	user, err := s.challengeUser(ctx, key)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := s.twoFactor.verify(ctx, *user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			attempts, countErr := s.cache.Incr(ctx, key+":attempts")
+			if countErr == nil && attempts == 1 {
+				s.cache.Expire(ctx, key+":attempts", loginChallengeTTL)
+			}
+			if countErr == nil && attempts >= loginChallengeAttempts {
+				s.cache.Del(ctx, key, key+":attempts")
+			}
+		}
+		return models.User{}, err
+	}
+
+	if err := s.cache.Del(ctx, key, key+":attempts"); err != nil {
+		return models.User{}, err
+	}
+
+	return *user, nil
+}
+
+func (s AuthService) challengeUser(ctx context.Context, key string) (*models.User, error) {
+	userID, err := s.cache.Get(ctx, key)
+	if err != nil {
+		if err == repositories.ErrCacheMiss {
+			return nil, ErrInvalidLoginChallenge
+		}
+		return nil, err
+	}
+
+	user, err := s.users.GetActive(ctx, userID)
 	if err != nil {
-		return models.User{}, errors.New("invalid email or password")
+		s.cache.Del(ctx, key)
+		return nil, ErrInvalidLoginChallenge
 	}
 
 	return user, nil
 }
 
-func (s AuthService) Logout() error {
-	return nil
+func (s AuthService) createLoginChallenge(ctx context.Context, userID string) (*models.LoginChallenge, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	challengeID := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := s.cache.Set(ctx, loginChallengePrefix+hashToken(challengeID), userID, loginChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginChallenge{
+		ChallengeID: challengeID,
+		ExpiresIn:   int64(loginChallengeTTL.Seconds()),
+	}, nil
+}
+
+// ResendVerification emails a new verification link. It reports success for
+// unknown or already verified addresses so it cannot be used to probe which
+// emails have accounts.
+func (s AuthService) ResendVerification(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.users.GetActiveByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	return s.sendVerification(ctx, *user)
+}
+
+func (s AuthService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	userID, err := s.consumeAuthToken(ctx, verifyEmailPurpose, token)
+	if err != nil {
+		return err
+	}
+
+	return s.users.VerifyEmail(ctx, userID)
+}
+
+// ForgotPassword emails a password reset link. Like ResendVerification it
+// does not reveal whether the address has an account.
+func (s AuthService) ForgotPassword(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.users.GetActiveByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueAuthToken(ctx, resetPasswordPurpose, user.ID, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.clientURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Manga Store password",
+		Body: "Someone asked to reset the password for this account.\n\n" +
+			"Choose a new password here within the next hour:\n" + link + "\n\n" +
+			"If it wasn't you, ignore this email; your password has not changed.\n",
+	})
+}
+
+// ResetPassword sets a new password using a reset token and returns the
+// user's ID so the caller can end the user's existing logins. A reset also
+// proves the user owns the address, so it is marked verified.
+func (s AuthService) ResetPassword(ctx context.Context, token, password string) (string, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	userID, err := s.consumeAuthToken(ctx, resetPasswordPurpose, token)
+	if err != nil {
+		return "", err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.users.ResetPassword(ctx, userID, string(passwordHash)); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+func (s AuthService) sendVerification(ctx context.Context, user models.User) error {
+	token, err := s.issueAuthToken(ctx, verifyEmailPurpose, user.ID, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.apiURL + "/auth/verify?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Manga Store email",
+		Body:    "Welcome to Manga Store!\n\nConfirm your email address within 24 hours:\n" + link + "\n",
+	})
+}
+
+// issueAuthToken creates a single-use token for purpose. Only its hash is
+// stored, so a Redis dump does not hand out working links.
+func (s AuthService) issueAuthToken(ctx context.Context, purpose, userID string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := s.cache.Set(ctx, authTokenKey(purpose, token), userID, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeAuthToken redeems a token exactly once and returns its user.
+func (s AuthService) consumeAuthToken(ctx context.Context, purpose, token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidAuthToken
+	}
+
+	userID, err := s.cache.GetDel(ctx, authTokenKey(purpose, token))
+	if err != nil {
+		if err == repositories.ErrCacheMiss {
+			return "", ErrInvalidAuthToken
+		}
+		return "", err
+	}
+
+	if !primitive.IsValidObjectID(userID) {
+		return "", ErrInvalidAuthToken
+	}
+
+	return userID, nil
+}
+
+func authTokenKey(purpose, token string) string {
+	return authTokenPrefix + purpose + ":" + hashToken(token)
 }
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/mailer"
+	"manga_store/internal/repositories"
+	"testing"
+)
+
+func TestRegisterRejectsShortPasswords(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	s := NewAuthService(stores, mailer.NewMemoryMailer())
+
+	if err := s.Register(ctx, "reader@example.com", "1234567"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("registering with a 7 character password: error = %v, want %v", err, ErrWeakPassword)
+	}
+	if _, err := stores.Users.GetActiveByEmail(ctx, "reader@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("user was created with a weak password: %v", err)
+	}
+
+	if err := s.Register(ctx, "reader@example.com", "12345678"); err != nil {
+		t.Fatalf("registering with an 8 character password: %v", err)
+	}
+}
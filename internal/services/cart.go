@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"manga_store/internal/logger"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	cartTTL             = 30 * 24 * time.Hour
+	maxCartItemQuantity = 99
+	cartKeyPrefix       = "cart:"
+)
+
+var (
+	ErrCartEmpty         = errors.New("cart is empty")
+	ErrCartItemNotFound  = errors.New("item is not in the cart")
+	ErrInvalidQuantity   = errors.New("quantity must be between 1 and 99")
+	ErrInsufficientStock = errors.New("not enough copies in stock")
+	ErrMangaNotFound     = errors.New("manga not found")
+)
+
+type CartService struct {
+	manga  repositories.MangaRepository
+	cache  repositories.Cache
+	orders OrderService
+}
+
+func NewCartService(stores repositories.Stores) CartService {
+	return CartService{
+		manga:  stores.Manga,
+		cache:  stores.Cache,
+		orders: NewOrderService(stores),
+	}
+}
+
+func cartKey(userID primitive.ObjectID) string {
+	return cartKeyPrefix + userID.Hex()
+}
+
+// GetCart returns the user's cart priced against the current catalog.
+// Items whose manga has since been deleted are dropped from the cart.
+func (s CartService) GetCart(ctx context.Context, userID primitive.ObjectID) (*models.Cart, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	quantities, err := s.cartQuantities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := &models.Cart{Items: []models.CartItem{}}
+	if len(quantities) == 0 {
+		return cart, nil
+	}
+
+	mangaIDs := make([]string, 0, len(quantities))
+	for id := range quantities {
+		mangaIDs = append(mangaIDs, id)
+	}
+
+	mangas, err := s.manga.Find(ctx, mangaIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, manga := range mangas {
+		found[manga.ID] = true
+
+		quantity := quantities[manga.ID]
+		subtotal := manga.Price * float64(quantity)
+		cart.Items = append(cart.Items, models.CartItem{
+			MangaID:   manga.ID,
+			Title:     manga.Title,
+			ImageURL:  manga.ImageURL,
+			Genres:    manga.Genres,
+			Price:     manga.Price,
+			Quantity:  quantity,
+			Available: manga.Quantity,
+			InStock:   manga.Quantity >= quantity,
+			Subtotal:  subtotal,
+		})
+		cart.TotalItems += quantity
+		cart.Total += subtotal
+	}
+
+	var stale []string
+	for id := range quantities {
+		if !found[id] {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := s.cache.HDel(ctx, cartKey(userID), stale...); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(cart.Items, func(i, j int) bool {
+		return cart.Items[i].Title < cart.Items[j].Title
+	})
+
+	return cart, nil
+}
+
+func (s CartService) AddItem(ctx context.Context, userID, mangaID primitive.ObjectID, quantity int) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	if quantity <= 0 || quantity > maxCartItemQuantity {
+		return ErrInvalidQuantity
+	}
+
+	manga, err := s.findActiveManga(ctx, mangaID)
+	if err != nil {
+		return err
+	}
+
+	current := 0
+	value, err := s.cache.HGet(ctx, cartKey(userID), mangaID.Hex())
+	if err != nil && err != repositories.ErrCacheMiss {
+		return err
+	}
+	if err == nil {
+		if current, err = strconv.Atoi(value); err != nil {
+			return err
+		}
+	}
+
+	newQuantity := current + quantity
+	if newQuantity > maxCartItemQuantity {
+		return ErrInvalidQuantity
+	}
+	if newQuantity > manga.Quantity {
+		return ErrInsufficientStock
+	}
+
+	return s.setCartQuantity(ctx, userID, mangaID, newQuantity)
+}
+
+func (s CartService) UpdateItem(ctx context.Context, userID, mangaID primitive.ObjectID, quantity int) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	if quantity == 0 {
+		return s.RemoveItem(ctx, userID, mangaID)
+	}
+	if quantity < 0 || quantity > maxCartItemQuantity {
+		return ErrInvalidQuantity
+	}
+
+	exists, err := s.cache.HExists(ctx, cartKey(userID), mangaID.Hex())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCartItemNotFound
+	}
+
+	manga, err := s.findActiveManga(ctx, mangaID)
+	if err != nil {
+		return err
+	}
+	if quantity > manga.Quantity {
+		return ErrInsufficientStock
+	}
+
+	return s.setCartQuantity(ctx, userID, mangaID, quantity)
+}
+
+func (s CartService) RemoveItem(ctx context.Context, userID, mangaID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	removed, err := s.cache.HDel(ctx, cartKey(userID), mangaID.Hex())
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrCartItemNotFound
+	}
+
+	return nil
+}
+
+func (s CartService) ClearCart(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	return s.cache.Del(ctx, cartKey(userID))
+}
+
+// Checkout buys every item in the cart as a single order. Either every item
+// is taken from stock and the order is recorded, or nothing changes and the
+// cart is left as it was. Once the order is placed it is returned even if
+// the cart cannot be emptied, so a client retrying on an error never buys
+// the cart twice.
+func (s CartService) Checkout(ctx context.Context, userID primitive.ObjectID) (*models.Order, error) {
+	cart, err := s.GetCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	items := make([]models.OrderItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		if !item.InStock {
+			return nil, fmt.Errorf("%w: %s", ErrInsufficientStock, item.Title)
+		}
+		items = append(items, models.OrderItem{
+			MangaID:  item.MangaID,
+			Title:    item.Title,
+			Genres:   item.Genres,
+			Price:    item.Price,
+			Quantity: item.Quantity,
+		})
+	}
+
+	order, err := s.orders.PlaceOrder(ctx, userID, items)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ClearCart(ctx, userID); err != nil {
+		logger.Error(fmt.Sprintf("Error clearing the cart of user %s after order %s: %s", userID.Hex(), order.ID, err))
+	}
+
+	return order, nil
+}
+
+func (s CartService) cartQuantities(ctx context.Context, userID primitive.ObjectID) (map[string]int, error) {
+	fields, err := s.cache.HGetAll(ctx, cartKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[string]int, len(fields))
+	for mangaID, value := range fields {
+		quantity, err := strconv.Atoi(value)
+		if err != nil || quantity <= 0 {
+			continue
+		}
+		quantities[mangaID] = quantity
+	}
+
+	return quantities, nil
+}
+
+func (s CartService) setCartQuantity(ctx context.Context, userID, mangaID primitive.ObjectID, quantity int) error {
+	return s.cache.HSet(ctx, cartKey(userID), mangaID.Hex(), strconv.Itoa(quantity), cartTTL)
+}
+
+func (s CartService) findActiveManga(ctx context.Context, mangaID primitive.ObjectID) (*models.Manga, error) {
+	manga, err := s.manga.Get(ctx, mangaID.Hex())
+	if err != nil {
+		return nil, mangaNotFound(err)
+	}
+
+	return manga, nil
+}
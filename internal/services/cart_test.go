@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// stuckCache is a cache whose keys cannot be deleted.
+type stuckCache struct {
+	repositories.Cache
+}
+
+func (stuckCache) Del(ctx context.Context, keys ...string) error {
+	return errors.New("cache unavailable")
+}
+
+func TestCheckoutReturnsTheOrderWhenTheCartCannotBeCleared(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	stores.Cache = stuckCache{stores.Cache}
+	s := NewCartService(stores)
+
+	monster, err := stores.Manga.Create(ctx, models.Manga{Title: "Monster", Price: 8.99, Quantity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := stores.Users.Create(ctx, models.User{Email: "reader@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := primitive.ObjectIDFromHex(user.ID)
+	mangaID, _ := primitive.ObjectIDFromHex(monster.ID)
+
+	if err := s.AddItem(ctx, userID, mangaID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := s.Checkout(ctx, userID)
+	if err != nil {
+		t.Fatalf("checkout failed after the order was placed: %v", err)
+	}
+	if order == nil || len(order.Items) != 1 || order.Items[0].Quantity != 2 {
+		t.Errorf("order = %+v, want 2 copies of Monster", order)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"manga_store/internal/repositories"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	loginFailuresPrefix = "login_failures:"
+	loginBlockedPrefix  = "login_blocked:"
+	loginLockedPrefix   = "login_locked:"
+
+	loginFailureWindow = time.Hour
+	loginBaseDelay     = time.Second
+	loginMaxDelay      = 15 * time.Minute
+
+	// ipFreeFailures is how many failures an IP gets before backoff starts,
+	// so one office behind a NAT does not throttle itself.
+	ipFreeFailures = 10
+)
+
+var (
+	ErrLoginThrottled = errors.New("too many failed login attempts, try again later")
+	ErrAccountLocked  = errors.New("account is temporarily locked after too many failed login attempts")
+)
+
+// LockoutError carries how long the caller must wait before trying again.
+type LockoutError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string { return e.Err.Error() }
+func (e *LockoutError) Unwrap() error { return e.Err }
+
+// LockoutService slows down password guessing. Failures are counted per IP
+// and per email in the cache; each one blocks further attempts for an
+// exponentially growing delay, and LOGIN_MAX_FAILURES failures for one email
+// lock it for LOGIN_LOCK_MINUTES. Checks run before the bcrypt comparison, so
+// blocked attempts cost next to nothing.
+type LockoutService struct {
+	cache        repositories.Cache
+	maxFailures  int64
+	lockDuration time.Duration
+}
+
+func NewLockoutService(stores repositories.Stores) LockoutService {
+	return LockoutService{
+		cache:        stores.Cache,
+		maxFailures:  int64(helpers.GetEnvInt("LOGIN_MAX_FAILURES", 5)),
+		lockDuration: time.Duration(helpers.GetEnvInt("LOGIN_LOCK_MINUTES", 15)) * time.Minute,
+	}
+}
+
+// Check returns a *LockoutError if ip or email may not attempt a login yet.
+func (s LockoutService) Check(ctx context.Context, ip, email string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	email = normalizeEmail(email)
+
+	locked, err := s.cache.TTL(ctx, loginLockedPrefix+email)
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return &LockoutError{Err: ErrAccountLocked, RetryAfter: locked}
+	}
+
+	emailBlocked, err := s.cache.TTL(ctx, loginBlockedPrefix+"email:"+email)
+	if err != nil {
+		return err
+	}
+	ipBlocked, err := s.cache.TTL(ctx, loginBlockedPrefix+"ip:"+ip)
+	if err != nil {
+		return err
+	}
+	if ttl := max(emailBlocked, ipBlocked); ttl > 0 {
+		return &LockoutError{Err: ErrLoginThrottled, RetryAfter: ttl}
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed attempt and blocks the next one for a delay
+// that doubles with every failure. It ignores cancellation of ctx, so
+// hanging up after a wrong password does not get the attempt off the count.
+func (s LockoutService) RecordFailure(ctx context.Context, ip, email string) error {
+	ctx, cancel := withTimeout(context.WithoutCancel(ctx), opCache)
+	defer cancel()
+
+	email = normalizeEmail(email)
+
+	emailFailures, err := s.countFailure(ctx, "email:"+email)
+	if err != nil {
+		return err
+	}
+	ipFailures, err := s.countFailure(ctx, "ip:"+ip)
+	if err != nil {
+		return err
+	}
+
+	if emailFailures >= s.maxFailures {
+		logger.Warn(fmt.Sprintf("Locking login for %s after %d failed attempts", email, emailFailures))
+		return s.cache.Set(ctx, loginLockedPrefix+email, strconv.FormatInt(time.Now().Unix(), 10), s.lockDuration)
+	}
+
+	if err := s.cache.Set(ctx, loginBlockedPrefix+"email:"+email, "1", backoff(emailFailures)); err != nil {
+		return err
+	}
+	if ipFailures > ipFreeFailures {
+		return s.cache.Set(ctx, loginBlockedPrefix+"ip:"+ip, "1", backoff(ipFailures-ipFreeFailures))
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the email's failure history. The IP's history is
+// kept, since one correct guess does not make the other attempts benign.
+func (s LockoutService) RecordSuccess(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	email = normalizeEmail(email)
+	return s.cache.Del(ctx,
+		loginFailuresPrefix+"email:"+email,
+		loginBlockedPrefix+"email:"+email,
+	)
+}
+
+// Unlock lifts a lock on email ahead of time, for admins helping a user.
+func (s LockoutService) Unlock(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	email = normalizeEmail(email)
+	return s.cache.Del(ctx,
+		loginLockedPrefix+email,
+		loginFailuresPrefix+"email:"+email,
+		loginBlockedPrefix+"email:"+email,
+	)
+}
+
+func (s LockoutService) countFailure(ctx context.Context, subject string) (int64, error) {
+	key := loginFailuresPrefix + subject
+
+	failures, err := s.cache.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if failures == 1 {
+		if err := s.cache.Expire(ctx, key, loginFailureWindow); err != nil {
+			return 0, err
+		}
+	}
+
+	return failures, nil
+}
+
+func backoff(failures int64) time.Duration {
+	if failures > 20 {
+		return loginMaxDelay
+	}
+	delay := loginBaseDelay << (failures - 1)
+	if delay > loginMaxDelay {
+		return loginMaxDelay
+	}
+	return delay
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
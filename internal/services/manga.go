@@ -4,82 +4,132 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"manga_store/internal/databases"
+	"fmt"
+	"manga_store/internal/helpers"
 	"manga_store/internal/logger"
 	"manga_store/internal/models"
-	"sync"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
+	"manga_store/internal/search"
+	"strings"
 	"time"
 
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrInvalidMangaUpdate   = errors.New("invalid manga update")
+	ErrMangaVersionConflict = errors.New("manga was changed by someone else, reload it and try again")
+)
+
+const popularMangaKey = "popular_manga"
+
 type MangaService struct {
-	manga *mongo.Collection
-	users *mongo.Collection
-	redis *redis.Client
-	neo4j neo4j.SessionWithContext
+	tx             repositories.Transactor
+	manga          repositories.MangaRepository
+	users          repositories.UserRepository
+	orders         repositories.OrderRepository
+	outbox         repositories.Outbox
+	cache          repositories.Cache
+	search         search.SearchIndex
+	suggester      *search.Suggester
+	orderService   OrderService
+	trashRetention time.Duration
 }
 
-var mu = sync.Mutex{}
-
-func NewMangaService() MangaService {
+func NewMangaService(stores repositories.Stores) MangaService {
 	s := MangaService{
-		manga: databases.Manga(),
-		users: databases.Users(),
-		redis: databases.Redis(),
-		neo4j: databases.Neo4j(context.Background()),
+		tx:             stores.Tx,
+		manga:          stores.Manga,
+		users:          stores.Users,
+		orders:         stores.Orders,
+		outbox:         stores.Outbox,
+		cache:          stores.Cache,
+		search:         stores.Search,
+		suggester:      stores.Suggester,
+		orderService:   NewOrderService(stores),
+		trashRetention: time.Duration(helpers.GetEnvInt("MANGA_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
 	}
 
+	return s
+}
+
+// StartMaintenance refreshes the popular manga cache and purges the trash
+// once a minute until ctx ends. The returned channel is closed once it has
+// stopped.
+func (s MangaService) StartMaintenance(ctx context.Context) <-chan struct{} {
+	stopped := make(chan struct{})
+
 	go func(s MangaService) {
+		defer close(stopped)
 		for {
-			if err := s.updatePopularMangaCache(); err != nil {
+			if err := s.updatePopularMangaCache(ctx); err != nil && ctx.Err() == nil {
 				logger.Error("Erro updating popular manga cache")
 			}
-			time.Sleep(time.Minute)
+			if err := s.PurgeTrash(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("Error purging deleted manga: " + err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
 		}
 	}(s)
 
-	return s
+	return stopped
 }
 
-func (s MangaService) GetNewestManga(limit int) ([]models.Manga, error) {
-	ctx := context.Background()
-	var mangas []models.Manga
-
-	findOptions := options.Find()
-	findOptions.SetSort(map[string]interface{}{"createdAt": -1})
-	if limit > 0 {
-		findOptions.SetLimit(int64(limit))
+// mangaNotFound reports a manga the repository could not find as
+// ErrMangaNotFound.
+func mangaNotFound(err error) error {
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrMangaNotFound
 	}
+	return err
+}
 
-	cursor, err := s.manga.Find(ctx, bson.D{{}}, findOptions)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
+// mangaSorts are the orders manga lists can be paged in. Search also
+// accepts "relevance", its default when there is a query.
+var mangaSorts = map[string]pagination.Keyset{
+	"newest":     {Field: "createdAt", Descending: true},
+	"price_asc":  {Field: "price"},
+	"price_desc": {Field: "price", Descending: true},
+	"rating":     {Field: "rating", Descending: true},
+	"popular":    {Field: "sold", Descending: true},
+	"title":      {Field: "title", Text: true},
+}
 
-	for cursor.Next(ctx) {
-		var manga models.Manga
-		if err := cursor.Decode(&manga); err != nil {
-			return nil, err
-		}
-		mangas = append(mangas, manga)
+const sortRelevance = "relevance"
+
+func mangaSort(name string) (string, pagination.Keyset, error) {
+	if name == "" {
+		name = "newest"
 	}
+	keyset, ok := mangaSorts[name]
+	if !ok {
+		return "", pagination.Keyset{}, fmt.Errorf("%w %q", pagination.ErrInvalidSort, name)
+	}
+	return name, keyset, nil
+}
 
-	if err := cursor.Err(); err != nil {
-		return nil, err
+// ListManga returns one page of the active catalog, newest first unless
+// another sort is asked for.
+func (s MangaService) ListManga(ctx context.Context, params pagination.Params) (pagination.Page[models.Manga], error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	sort, keyset, err := mangaSort(params.Sort)
+	if err != nil {
+		return pagination.Page[models.Manga]{}, err
 	}
 
-	return mangas, nil
+	return s.manga.List(ctx, sort, keyset, params)
 }
 
-func (s MangaService) CreateManga(title, author, description string, price float64, quantity int, genres []string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s MangaService) CreateManga(ctx context.Context, title, author, description string, price float64, quantity int, genres []string) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
 	defer cancel()
 
 	manga := models.Manga{
@@ -92,252 +142,414 @@ func (s MangaService) CreateManga(title, author, description string, price float
 		CreatedAt:   int(time.Now().Unix()),
 	}
 
-	result, err := s.manga.InsertOne(ctx, manga)
-	if err != nil {
-		return err
-	}
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		created, err := s.manga.Create(ctx, manga)
+		if err != nil {
+			return err
+		}
 
-	mangaID := result.InsertedID.(primitive.ObjectID).Hex()
+		manga.ID = created.ID
 
-	neo4jCtx := context.Background()
-	_, err = s.neo4j.ExecuteWrite(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(neo4jCtx, `
-			CREATE (m:Manga {id: $id, title: $title, genres: $genres})
-		`, map[string]interface{}{
-			"id":     mangaID,
-			"title":  title,
-			"genres": genres,
+		return s.outbox.Record(ctx, models.GraphEventMangaUpserted, models.GraphEventPayload{
+			Manga: []models.GraphManga{graphManga(manga)},
 		})
-		return nil, err
 	})
-
 	if err != nil {
-
-		s.manga.DeleteOne(ctx, bson.M{"_id": result.InsertedID})
-		return errors.New("failed to create manga in Neo4j, creation rolled back")
+		return err
 	}
 
+	s.reindex(ctx, manga)
 	return nil
 }
 
-func (s MangaService) DeleteManga(mangaID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// DeleteManga moves a manga to the trash. It disappears from the catalog and
+// the graph at once, and is purged for good after the retention period
+// unless it is restored first.
+func (s MangaService) DeleteManga(ctx context.Context, mangaID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
 	defer cancel()
 
-	_, err := s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{"$set": bson.M{"isDeleted": true}})
-	if err != nil {
-		return err
-	}
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.manga.Delete(ctx, mangaID.Hex(), int(time.Now().Unix())); err != nil {
+			return mangaNotFound(err)
+		}
 
-	neo4jCtx := context.Background()
-	_, err = s.neo4j.ExecuteWrite(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(neo4jCtx, `
-			MATCH (m:Manga {id: $id})
-			DETACH DELETE m
-		`, map[string]interface{}{
-			"id": mangaID.Hex(),
+		return s.outbox.Record(ctx, models.GraphEventMangaDeleted, models.GraphEventPayload{
+			Manga: []models.GraphManga{{ID: mangaID.Hex()}},
 		})
-		return nil, err
 	})
-
 	if err != nil {
-		return errors.New("failed to delete manga in Neo4j")
+		return err
 	}
 
+	if err := s.search.Remove(ctx, mangaID.Hex()); err != nil {
+		logger.Error("Error removing manga from the search index: " + err.Error())
+	}
+	s.suggester.Remove(mangaID.Hex())
+	s.refreshPopularMangaCache(ctx)
 	return nil
 }
 
-func (s MangaService) SearchManga(query string, genres []string, author string, limit int) ([]models.Manga, error) {
-	ctx := context.Background()
-	var mangas []models.Manga
+// RestoreManga takes a manga out of the trash and queues its graph node to
+// be recreated, along with the RATED and PURCHASED edges that were removed
+// when it was deleted.
+func (s MangaService) RestoreManga(ctx context.Context, mangaID primitive.ObjectID) (*models.Manga, error) {
+	ctx, cancel := withTimeout(ctx, opBulk)
+	defer cancel()
+
+	var manga *models.Manga
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		manga, err = s.manga.Restore(ctx, mangaID.Hex(), int(time.Now().Unix()))
+		if err != nil {
+			return mangaNotFound(err)
+		}
 
-	filter := bson.M{}
-	if query != "" {
-		filter["$or"] = []bson.M{
-			{"title": bson.M{"$regex": query, "$options": "i"}},
-			{"description": bson.M{"$regex": query, "$options": "i"}},
+		restored := []models.GraphManga{graphManga(*manga)}
+		err = s.outbox.Record(ctx, models.GraphEventMangaUpserted, models.GraphEventPayload{Manga: restored})
+		if err != nil {
+			return err
 		}
+
+		return s.restoreMangaEdges(ctx, manga.ID, restored)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if len(genres) > 0 {
-		filter["genres"] = bson.M{"$all": genres}
+
+	s.reindex(ctx, *manga)
+	s.refreshPopularMangaCache(ctx)
+	return manga, nil
+}
+
+// restoreMangaEdges queues the graph events for every active user who still
+// rates or owns the manga.
+func (s MangaService) restoreMangaEdges(ctx context.Context, mangaID string, manga []models.GraphManga) error {
+	raters, err := s.users.Raters(ctx, mangaID)
+	if err != nil {
+		return err
 	}
-	if author != "" {
-		filter["author"] = bson.M{"$regex": author, "$options": "i"}
+	for _, user := range raters {
+		for _, rating := range user.Ratings {
+			if rating.MangaID != mangaID {
+				continue
+			}
+			err := s.outbox.Record(ctx, models.GraphEventMangaRated, models.GraphEventPayload{
+				UserID: user.ID,
+				Manga:  manga,
+				Score:  rating.Score,
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
-	if limit > 0 {
-		findOptions.SetLimit(int64(limit))
+	buyers, err := s.orders.Buyers(ctx, mangaID)
+	if err != nil {
+		return err
 	}
 
-	cursor, err := s.manga.Find(ctx, filter, findOptions)
+	userIDs, err := s.users.ActivePurchasers(ctx, mangaID, buyers)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var manga models.Manga
-		if err := cursor.Decode(&manga); err != nil {
-			return nil, err
+	for _, userID := range userIDs {
+		err := s.outbox.Record(ctx, models.GraphEventMangaPurchased, models.GraphEventPayload{
+			UserID: userID,
+			Manga:  manga,
+		})
+		if err != nil {
+			return err
 		}
-		mangas = append(mangas, manga)
 	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, err
-	}
+	return nil
+}
 
-	return mangas, nil
+// ListTrash returns deleted manga that have not been purged yet, most
+// recently deleted first.
+func (s MangaService) ListTrash(ctx context.Context) ([]models.Manga, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	return s.manga.Trash(ctx)
 }
 
-func (s MangaService) GetMangaByID(id, userID string) (*models.Manga, error) {
-	ctx := context.Background()
-	var manga models.Manga
+// PurgeTrash permanently removes manga that have been in the trash for longer
+// than MANGA_TRASH_RETENTION_DAYS. Orders keep their own copy of each item,
+// and carts drop purged titles the next time they are read.
+func (s MangaService) PurgeTrash(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, opBulk)
+	defer cancel()
 
-	objectId, err := primitive.ObjectIDFromHex(id)
+	cutoff := int(time.Now().Add(-s.trashRetention).Unix())
+	purged, err := s.manga.Purge(ctx, cutoff)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if purged > 0 {
+		logger.Info(fmt.Sprintf("Purged %d manga from the trash", purged))
+	}
+
+	return nil
+}
+
+// UpdateManga applies a partial update to an active manga, provided it is
+// still at the given version. The version is bumped on every update, and a
+// change to the title or genres is queued for the graph, where the
+// recommendation queries read them.
+func (s MangaService) UpdateManga(ctx context.Context, mangaID primitive.ObjectID, update models.UpdateMangaRequest) (*models.Manga, error) {
+	if update.Version == nil {
+		return nil, fmt.Errorf("%w: version is required", ErrInvalidMangaUpdate)
 	}
-	filter := bson.M{"_id": objectId}
 
-	err = s.manga.FindOne(ctx, filter).Decode(&manga)
+	update, err := cleanMangaUpdate(update)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
 		return nil, err
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	var updated *models.Manga
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.manga.Update(ctx, mangaID.Hex(), update, int(time.Now().Unix()))
+		if err != nil {
+			if errors.Is(err, repositories.ErrVersionConflict) {
+				return ErrMangaVersionConflict
+			}
+			return mangaNotFound(err)
+		}
 
-	update := bson.M{"$inc": bson.M{"views": 1}}
-	_, err = s.manga.UpdateOne(ctx, filter, update)
+		if update.Title == nil && update.Genres == nil {
+			return nil
+		}
+		return s.outbox.Record(ctx, models.GraphEventMangaUpserted, models.GraphEventPayload{
+			Manga: []models.GraphManga{graphManga(*updated)},
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.createOrUpdateViewInNeo4j(userID, id, manga.Title, manga.Genres); err != nil {
-		return nil, err
+	s.reindex(ctx, *updated)
+	return updated, nil
+}
+
+// cleanMangaUpdate validates the fields present in update and returns them
+// trimmed, with duplicate genres dropped.
+func cleanMangaUpdate(update models.UpdateMangaRequest) (models.UpdateMangaRequest, error) {
+	cleaned := models.UpdateMangaRequest{Version: update.Version}
+
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" {
+			return cleaned, fmt.Errorf("%w: title cannot be empty", ErrInvalidMangaUpdate)
+		}
+		cleaned.Title = &title
+	}
+	if update.Author != nil {
+		author := strings.TrimSpace(*update.Author)
+		if author == "" {
+			return cleaned, fmt.Errorf("%w: author cannot be empty", ErrInvalidMangaUpdate)
+		}
+		cleaned.Author = &author
+	}
+	if update.Description != nil {
+		description := strings.TrimSpace(*update.Description)
+		cleaned.Description = &description
+	}
+	if update.ImageURL != nil {
+		imageURL := strings.TrimSpace(*update.ImageURL)
+		cleaned.ImageURL = &imageURL
+	}
+	if update.Genres != nil {
+		genres := make([]string, 0, len(*update.Genres))
+		seen := map[string]bool{}
+		for _, genre := range *update.Genres {
+			genre = strings.TrimSpace(genre)
+			if genre == "" {
+				return cleaned, fmt.Errorf("%w: genres cannot be empty", ErrInvalidMangaUpdate)
+			}
+			if !seen[genre] {
+				seen[genre] = true
+				genres = append(genres, genre)
+			}
+		}
+		if len(genres) == 0 {
+			return cleaned, fmt.Errorf("%w: at least one genre is required", ErrInvalidMangaUpdate)
+		}
+		cleaned.Genres = &genres
+	}
+	if update.Price != nil {
+		if *update.Price < 0 {
+			return cleaned, fmt.Errorf("%w: price cannot be negative", ErrInvalidMangaUpdate)
+		}
+		cleaned.Price = update.Price
+	}
+	if update.Quantity != nil {
+		if *update.Quantity < 0 {
+			return cleaned, fmt.Errorf("%w: quantity cannot be negative", ErrInvalidMangaUpdate)
+		}
+		cleaned.Quantity = update.Quantity
+	}
+
+	if cleaned == (models.UpdateMangaRequest{Version: update.Version}) {
+		return cleaned, fmt.Errorf("%w: nothing to update", ErrInvalidMangaUpdate)
 	}
-	
 
-	return &manga, nil
+	return cleaned, nil
 }
 
-func (s MangaService) createOrUpdateViewInNeo4j(userID, mangaID string, title string, genres []string) error {
-	ctx := context.Background()
-
-	_, err := s.neo4j.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(ctx, `
-			MERGE (u:User {id: $userID})
-			ON CREATE SET u.id = $userID
-			MERGE (m:Manga {id: $mangaID})
-			ON CREATE SET m.title = $title, m.genres = $genres
-			MERGE (u)-[:VIEWED]->(m)
-		`, map[string]interface{}{
-			"userID":  userID,
-			"mangaID": mangaID,
-			"title":   title,
-			"genres":  genres,
-		})
-		return nil, err
-	})
+// SearchManga filters the active catalog and returns one page of results
+// together with facet counts over every match. Free text is ranked by the
+// configured search index and paged by offset; every other sort is paged by
+// keyset.
+func (s MangaService) SearchManga(ctx context.Context, request models.SearchMangaRequest) (*models.SearchMangaResponse, error) {
+	ctx, cancel := withTimeout(ctx, opSearch)
+	defer cancel()
 
-	return err
-}
+	params := pagination.Params{Limit: request.Limit, Cursor: request.Cursor, Sort: request.Sort}
+	hasQuery := strings.TrimSpace(request.Query) != ""
 
-func (s MangaService) PurchaseManga(userID, mangaID primitive.ObjectID) error {
-	ctx := context.Background()
+	sort := params.Sort
+	if sort == "" && hasQuery {
+		sort = sortRelevance
+	}
+	if sort == sortRelevance && !hasQuery {
+		sort = "newest"
+	}
 
-	var manga models.Manga
-	err := s.manga.FindOne(ctx, bson.M{"_id": mangaID, "isDeleted": false}).Decode(&manga)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return errors.New("manga not found")
+	var keyset pagination.Keyset
+	if sort != sortRelevance {
+		var err error
+		if sort, keyset, err = mangaSort(sort); err != nil {
+			return nil, err
 		}
-		return err
 	}
 
-	if manga.Quantity <= 0 {
-		return errors.New("manga is out of stock")
+	cursor, err := pagination.Decode(params.Cursor, sort)
+	if err != nil {
+		return nil, err
 	}
 
-	var user models.User
-	err = s.users.FindOne(ctx, bson.M{"_id": userID, "isDeleted": false}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return errors.New("user not found")
+	query := repositories.MangaSearch{
+		Request: request,
+		ByRank:  sort == sortRelevance,
+		Sort:    sort,
+		Keyset:  keyset,
+		Cursor:  cursor,
+		Limit:   params.PageSize(),
+	}
+
+	if hasQuery {
+		hits, err := s.search.Search(ctx, search.Query{Text: request.Query, Genres: request.Genres, Author: request.Author})
+		if err != nil {
+			return nil, err
+		}
+		if len(hits) == 0 {
+			return &models.SearchMangaResponse{Items: []models.Manga{}}, nil
+		}
+
+		query.Ranked = make([]string, 0, len(hits))
+		for _, hit := range hits {
+			query.Ranked = append(query.Ranked, hit.ID)
 		}
-		return err
 	}
 
-	purchase := models.Purchase{
-		MangaID:      manga.ID,
-		Title:        manga.Title,
-		Price:        manga.Price,
-		PurchaseDate: time.Now().Format(time.RFC3339),
+	return s.manga.Search(ctx, query)
+}
+
+// reindex updates the search index and suggester after a catalog write.
+// Both are derived from the collection, so a failure is logged rather than
+// failing a write that has already been committed. The write is done, so
+// the index is updated even when the request is cancelled in the meantime.
+func (s MangaService) reindex(ctx context.Context, manga models.Manga) {
+	ctx, cancel := withTimeout(context.WithoutCancel(ctx), opSearch)
+	defer cancel()
+
+	if err := s.search.Index(ctx, manga); err != nil {
+		logger.Error("Error updating the search index: " + err.Error())
 	}
-	userUpdate := bson.M{"$push": bson.M{"purchaseHistory": purchase}}
+	s.suggester.Add(manga)
+}
+
+// Suggest completes a partly typed title or author and offers a corrected
+// query when the words typed are not in the catalog.
+func (s MangaService) Suggest(query string, limit int) search.Suggestions {
+	return s.suggester.Suggest(query, limit)
+}
+
+// GetMangaByID returns a manga and counts the view. The lookup is bounded
+// like any read; counting the view is a write with its own budget.
+func (s MangaService) GetMangaByID(ctx context.Context, id, userID string) (*models.Manga, error) {
+	readCtx, cancelRead := withTimeout(ctx, opRead)
+	defer cancelRead()
 
-	_, err = s.users.UpdateOne(ctx, bson.M{"_id": userID}, userUpdate)
+	manga, err := s.manga.Get(readCtx, id)
 	if err != nil {
-		mu.Unlock()
-		return err
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	writeCtx, cancelWrite := withTimeout(ctx, opWrite)
+	defer cancelWrite()
 
-	mangaUpdate := bson.M{"$inc": bson.M{"quantity": -1, "sold": 1}}
-	_, err = s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, mangaUpdate)
+	err = s.tx.WithTransaction(writeCtx, func(ctx context.Context) error {
+		if err := s.manga.IncrementViews(ctx, id); err != nil {
+			return err
+		}
+
+		return s.outbox.Record(ctx, models.GraphEventMangaViewed, models.GraphEventPayload{
+			UserID: userID,
+			Manga:  []models.GraphManga{graphManga(*manga)},
+		})
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := s.createOrUpdatePurchaseInNeo4j(userID, mangaID, manga.Title, manga.Genres); err != nil {
-		return err
-	}
-	
-	return err
+	return manga, nil
 }
 
-func (s MangaService) createOrUpdatePurchaseInNeo4j(userID, mangaID primitive.ObjectID, title string, genres []string) error {
-	ctx := context.Background()
-
-	_, err := s.neo4j.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(ctx, `
-			MERGE (u:User {id: $userID})
-			ON CREATE SET u.id = $userID
-			MERGE (m:Manga {id: $mangaID})
-			ON CREATE SET m.title = $title, m.genres = $genres
-			MERGE (u)-[:PURCHASED]->(m)
-		`, map[string]interface{}{
-			"userID":  userID.Hex(),
-			"mangaID": mangaID.Hex(),
-			"title":   title,
-			"genres":  genres,
-		})
-		return nil, err
-	})
+func (s MangaService) PurchaseManga(ctx context.Context, userID, mangaID primitive.ObjectID) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
 
-	return err
+	manga, err := s.manga.Get(ctx, mangaID.Hex())
+	if err != nil {
+		return nil, mangaNotFound(err)
+	}
+
+	return s.orderService.PlaceOrder(ctx, userID, []models.OrderItem{{
+		MangaID:  manga.ID,
+		Title:    manga.Title,
+		Genres:   manga.Genres,
+		Price:    manga.Price,
+		Quantity: 1,
+	}})
 }
 
+func (s MangaService) GetPopularManga(ctx context.Context) ([]models.Manga, error) {
+	return popularManga(ctx, s.manga, s.cache)
+}
 
-func (s MangaService) GetPopularManga() ([]models.Manga, error) {
-	ctx := context.Background()
+// popularManga returns the best sellers from the cache StartMaintenance keeps
+// warm, or from the database when the cache has none.
+func popularManga(ctx context.Context, manga repositories.MangaRepository, cache repositories.Cache) ([]models.Manga, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
 
 	var mangas []models.Manga
 
-	data, err := s.redis.Get(ctx, "popular_manga").Result()
+	data, err := cache.Get(ctx, popularMangaKey)
 	if err != nil {
 		logger.Error("Error getting popular manga from cache, retrieving from db")
-		mangas, err := s.getPopularMangaFromMongo()
-		if err != nil {
-			return mangas, nil
-		}
+		return popularMangaFromDB(ctx, manga)
 	} else if err := json.Unmarshal([]byte(data), &mangas); err == nil {
 		return mangas, nil
 	}
@@ -345,171 +557,135 @@ func (s MangaService) GetPopularManga() ([]models.Manga, error) {
 	return nil, errors.New("failed to retrieve popular manga from cache")
 }
 
-func (s MangaService) RateManga(userID, mangaID primitive.ObjectID, rating float64) error {
-	ctx := context.Background()
+// RateManga records a user's score for a manga, replacing any earlier score,
+// and keeps the manga's average rating in step. The user's ratings and the
+// average are read inside the transaction that rewrites them, so concurrent
+// ratings conflict and are retried rather than overwriting each other.
+func (s MangaService) RateManga(ctx context.Context, userID, mangaID primitive.ObjectID, rating float64) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
 
-	var user models.User
-	err := s.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	manga, err := s.manga.Get(ctx, mangaID.Hex())
 	if err != nil {
-		return err
+		return mangaNotFound(err)
 	}
 
-	var manga models.Manga
-	err = s.manga.FindOne(ctx, bson.M{"_id": mangaID}).Decode(&manga)
-	if err != nil {
-		return err
+	event := models.GraphEventPayload{
+		UserID: userID.Hex(),
+		Manga:  []models.GraphManga{graphManga(*manga)},
+		Score:  rating,
 	}
 
-	for _, r := range user.Ratings {
-		if r.MangaID == mangaID.Hex() {
-			if err := s.updateExistingRating(userID, mangaID, rating); err != nil {
-				return err
-			}
-			return s.createOrUpdateRatingInNeo4j(userID, mangaID, rating, manga.Title, manga.Genres)
+	return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.Get(ctx, userID.Hex())
+		if err != nil {
+			return err
 		}
-	}
 
-	_, err = s.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$push": bson.M{"ratings": models.Rating{
-		MangaID: mangaID.Hex(),
-		Score:   rating,
-	}}})
-	if err != nil {
-		return err
-	}
+		for _, r := range user.Ratings {
+			if r.MangaID == mangaID.Hex() {
+				if err := s.updateExistingRating(ctx, userID.Hex(), mangaID.Hex(), r.Score, rating); err != nil {
+					return err
+				}
+				return s.outbox.Record(ctx, models.GraphEventMangaRated, event)
+			}
+		}
 
-	if err := s.updateMangaRating(mangaID, rating, 1); err != nil {
-		return err
-	}
+		err = s.users.AddRating(ctx, userID.Hex(), models.Rating{
+			MangaID: mangaID.Hex(),
+			Score:   rating,
+		})
+		if err != nil {
+			return err
+		}
 
-	return s.createOrUpdateRatingInNeo4j(userID, mangaID, rating, manga.Title, manga.Genres)
-}
+		if err := s.updateMangaRating(ctx, mangaID.Hex(), rating, 1); err != nil {
+			return err
+		}
 
-func (s MangaService) createOrUpdateRatingInNeo4j(userID, mangaID primitive.ObjectID, rating float64, title string, genres []string) error {
-	ctx := context.Background()
-
-	_, err := s.neo4j.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(ctx, `
-			MERGE (u:User {id: $userID})
-			ON CREATE SET u.id = $userID
-			MERGE (m:Manga {id: $mangaID})
-			ON CREATE SET m.title = $title, m.genres = $genres
-			MERGE (u)-[r:RATED]->(m)
-			SET r.score = $score
-		`, map[string]interface{}{
-			"userID":  userID.Hex(),
-			"mangaID": mangaID.Hex(),
-			"title":   title,
-			"genres":  genres,
-			"score":   rating,
-		})
-		return nil, err
+		return s.outbox.Record(ctx, models.GraphEventMangaRated, event)
 	})
-
-	return err
 }
 
-func (s MangaService) updateExistingRating(userID, mangaID primitive.ObjectID, newRating float64) error {
-	ctx := context.Background()
-
-	_, err := s.users.UpdateOne(ctx, bson.M{"_id": userID, "ratings.mangaId": mangaID},
-		bson.M{"$set": bson.M{"ratings.$.score": newRating}})
+// updateExistingRating replaces a user's earlier score in the manga's
+// average.
+func (s MangaService) updateExistingRating(ctx context.Context, userID, mangaID string, oldRating, newRating float64) error {
+	err := s.users.UpdateRating(ctx, userID, models.Rating{MangaID: mangaID, Score: newRating})
 	if err != nil {
 		return err
 	}
 
-	var manga models.Manga
-	err = s.manga.FindOne(ctx, bson.M{"_id": mangaID}).Decode(&manga)
+	manga, err := s.manga.GetWithDeleted(ctx, mangaID)
 	if err != nil {
 		return err
 	}
+	if manga.RatedTimes == 0 {
+		return s.updateMangaRating(ctx, mangaID, newRating, 1)
+	}
 
-	mu.Lock()
-	defer mu.Unlock()
-
-	return s.updateMangaRating(mangaID, newRating, 0)
+	total := manga.Rating*float64(manga.RatedTimes) - oldRating + newRating
+	return s.manga.SetRating(ctx, mangaID, total/float64(manga.RatedTimes), manga.RatedTimes)
 }
 
-func (s MangaService) updateMangaRating(mangaID primitive.ObjectID, newRating float64, additionalRatedTimes int) error {
-	ctx := context.Background()
-
-	var manga models.Manga
-	err := s.manga.FindOne(ctx, bson.M{"_id": mangaID}).Decode(&manga)
+func (s MangaService) updateMangaRating(ctx context.Context, mangaID string, newRating float64, additionalRatedTimes int) error {
+	manga, err := s.manga.GetWithDeleted(ctx, mangaID)
 	if err != nil {
 		return err
 	}
 
 	newRatedTimes := manga.RatedTimes + additionalRatedTimes
 	if newRatedTimes == 1 {
-		newTotalRating := newRating
-
-		_, err = s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
-			"$set": bson.M{"rating": newTotalRating, "ratedTimes": newRatedTimes},
-		})
-		if err != nil {
-			return err
-		}
+		return s.manga.SetRating(ctx, mangaID, newRating, newRatedTimes)
 	} else if newRatedTimes > 0 {
 		newTotalRating := ((manga.Rating * float64(manga.RatedTimes)) + newRating) / float64(newRatedTimes)
-
-		_, err = s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
-			"$set": bson.M{"rating": newTotalRating, "ratedTimes": newRatedTimes},
-		})
-		if err != nil {
-			return err
-		}
+		return s.manga.SetRating(ctx, mangaID, newTotalRating, newRatedTimes)
 	}
 
 	return nil
 }
 
-func (s MangaService) RemoveMangaRating(userID, mangaID primitive.ObjectID) error {
-	ctx := context.Background()
-
-	_, err := s.neo4j.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(ctx, `
-			MATCH (u:User {id: $userID})-[r:RATED]->(m:Manga {id: $mangaID})
-			DELETE r`, map[string]interface{}{
-			"userID":  userID.Hex(),
-			"mangaID": mangaID.Hex(),
-		})
-		return nil, err
-	})
-	if err != nil {
-		return err
-	}
+// RemoveMangaRating takes back a user's score, reading it inside the
+// transaction like RateManga does.
+func (s MangaService) RemoveMangaRating(ctx context.Context, userID, mangaID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
 
-	var user models.User
-	err = s.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
-	if err != nil {
-		return err
-	}
+	return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.Get(ctx, userID.Hex())
+		if err != nil {
+			return err
+		}
 
-	var ratingToRemove float64
-	for _, rating := range user.Ratings {
-		if rating.MangaID == mangaID.Hex() {
-			ratingToRemove = rating.Score
-			break
+		rated := false
+		var ratingToRemove float64
+		for _, rating := range user.Ratings {
+			if rating.MangaID == mangaID.Hex() {
+				rated = true
+				ratingToRemove = rating.Score
+				break
+			}
+		}
+		if !rated {
+			return nil
 		}
-	}
 
-	_, err = s.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
-		"$pull": bson.M{"ratings": bson.M{"mangaId": mangaID.Hex()}},
-	})
-	if err != nil {
-		return err
-	}
+		if err := s.users.RemoveRating(ctx, userID.Hex(), mangaID.Hex()); err != nil {
+			return err
+		}
 
-	mu.Lock()
-	defer mu.Unlock()
+		if err := s.updateMangaRatingAfterRemoval(ctx, mangaID.Hex(), ratingToRemove); err != nil {
+			return err
+		}
 
-	return s.updateMangaRatingAfterRemoval(mangaID, ratingToRemove)
+		return s.outbox.Record(ctx, models.GraphEventRatingRemoved, models.GraphEventPayload{
+			UserID: userID.Hex(),
+			Manga:  []models.GraphManga{{ID: mangaID.Hex()}},
+		})
+	})
 }
 
-func (s MangaService) updateMangaRatingAfterRemoval(mangaID primitive.ObjectID, ratingToRemove float64) error {
-	ctx := context.Background()
-
-	var manga models.Manga
-	err := s.manga.FindOne(ctx, bson.M{"_id": mangaID}).Decode(&manga)
+func (s MangaService) updateMangaRatingAfterRemoval(ctx context.Context, mangaID string, ratingToRemove float64) error {
+	manga, err := s.manga.GetWithDeleted(ctx, mangaID)
 	if err != nil {
 		return err
 	}
@@ -518,22 +694,17 @@ func (s MangaService) updateMangaRatingAfterRemoval(mangaID primitive.ObjectID,
 		newRatedTimes := manga.RatedTimes - 1
 		newTotalRating := ((manga.Rating * float64(manga.RatedTimes)) - ratingToRemove) / float64(newRatedTimes)
 
-		_, err = s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
-			"$set": bson.M{"rating": newTotalRating, "ratedTimes": newRatedTimes},
-		})
-	} else {
-
-		_, err = s.manga.UpdateOne(ctx, bson.M{"_id": mangaID}, bson.M{
-			"$set": bson.M{"rating": 0, "ratedTimes": 0},
-		})
+		return s.manga.SetRating(ctx, mangaID, newTotalRating, newRatedTimes)
 	}
-	return err
+
+	return s.manga.SetRating(ctx, mangaID, 0, 0)
 }
 
-func (s MangaService) updatePopularMangaCache() error {
-	ctx := context.Background()
+func (s MangaService) updatePopularMangaCache(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
 
-	mangas, err := s.getPopularMangaFromMongo()
+	mangas, err := popularMangaFromDB(ctx, s.manga)
 	if err != nil {
 		return err
 	}
@@ -544,38 +715,30 @@ func (s MangaService) updatePopularMangaCache() error {
 		return err
 	}
 
-	if err := s.redis.Set(ctx, "popular_manga", data, time.Hour).Err(); err != nil {
-		logger.Error("Error saving popular manga to Redis: " + err.Error())
+	if err := s.cache.Set(ctx, popularMangaKey, string(data), time.Hour); err != nil {
+		logger.Error("Error saving popular manga to the cache: " + err.Error())
 		return err
 	}
 
 	return nil
 }
 
-func (s MangaService) getPopularMangaFromMongo() ([]models.Manga, error) {
-	ctx := context.Background()
-
-	findOptions := options.Find().
-		SetSort(bson.D{
-			{Key: "sold", Value: -1},
-			{Key: "views", Value: -1},
-		}).
-		SetLimit(10)
+// refreshPopularMangaCache rebuilds the popular cache straight away after a
+// title enters or leaves the catalog, rather than waiting for the next tick.
+// Like reindex, it runs after the write is committed, so it is not cut short
+// when the request is cancelled.
+func (s MangaService) refreshPopularMangaCache(ctx context.Context) {
+	if err := s.updatePopularMangaCache(context.WithoutCancel(ctx)); err != nil {
+		logger.Error("Error refreshing popular manga cache: " + err.Error())
+	}
+}
 
-	cursor, err := s.manga.Find(ctx, bson.M{}, findOptions)
+func popularMangaFromDB(ctx context.Context, manga repositories.MangaRepository) ([]models.Manga, error) {
+	mangas, err := manga.Popular(ctx, 10)
 	if err != nil {
-		logger.Error("Error retrieving popular manga from mongo: " + err.Error())
+		logger.Error("Error retrieving popular manga from the database: " + err.Error())
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	var mangas []models.Manga
-	for cursor.Next(ctx) {
-		var manga models.Manga
-		if err := cursor.Decode(&manga); err == nil {
-			mangas = append(mangas, manga)
-		}
-	}
 
 	return mangas, nil
 }
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"math"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConcurrentRatingsKeepTheAverage(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	s := NewMangaService(stores)
+
+	manga, err := stores.Manga.Create(ctx, models.Manga{Title: "Berserk", Price: 14.99, Quantity: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mangaID, _ := primitive.ObjectIDFromHex(manga.ID)
+
+	const raters = 20
+	userIDs := make([]primitive.ObjectID, raters)
+	for i := range userIDs {
+		user, err := stores.Users.Create(ctx, models.User{Email: fmt.Sprintf("reader%d@example.com", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userIDs[i], _ = primitive.ObjectIDFromHex(user.ID)
+	}
+
+	// Every user rates twice at once, first 1 and then 5 or the other way
+	// round. Whichever lands last, each user counts once.
+	var wg sync.WaitGroup
+	for _, userID := range userIDs {
+		for _, score := range []float64{1, 5} {
+			wg.Add(1)
+			go func(userID primitive.ObjectID, score float64) {
+				defer wg.Done()
+				if err := s.RateManga(ctx, userID, mangaID, score); err != nil {
+					t.Error(err)
+				}
+			}(userID, score)
+		}
+	}
+	wg.Wait()
+
+	var total float64
+	for _, userID := range userIDs {
+		user, err := stores.Users.Get(ctx, userID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(user.Ratings) != 1 {
+			t.Fatalf("user %s has %d ratings for one manga", userID.Hex(), len(user.Ratings))
+		}
+		total += user.Ratings[0].Score
+	}
+
+	rated, err := stores.Manga.Get(ctx, manga.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rated.RatedTimes != raters {
+		t.Errorf("rated times = %d, want %d", rated.RatedTimes, raters)
+	}
+	if want := total / raters; math.Abs(rated.Rating-want) > 1e-9 {
+		t.Errorf("rating = %v, want %v", rated.Rating, want)
+	}
+
+	for _, userID := range userIDs[:raters/2] {
+		wg.Add(2)
+		for range 2 {
+			go func(userID primitive.ObjectID) {
+				defer wg.Done()
+				if err := s.RemoveMangaRating(ctx, userID, mangaID); err != nil {
+					t.Error(err)
+				}
+			}(userID)
+		}
+	}
+	wg.Wait()
+
+	rated, err = stores.Manga.Get(ctx, manga.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rated.RatedTimes != raters/2 {
+		t.Errorf("rated times after removals = %d, want %d", rated.RatedTimes, raters/2)
+	}
+}
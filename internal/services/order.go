@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"manga_store/internal/models"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOrderNotFound          = errors.New("order not found")
+	ErrInvalidOrderStatus     = errors.New("invalid order status")
+	ErrInvalidOrderTransition = errors.New("order cannot move to the requested status")
+)
+
+type OrderService struct {
+	tx     repositories.Transactor
+	orders repositories.OrderRepository
+	manga  repositories.MangaRepository
+	users  repositories.UserRepository
+	outbox repositories.Outbox
+}
+
+func NewOrderService(stores repositories.Stores) OrderService {
+	return OrderService{
+		tx:     stores.Tx,
+		orders: stores.Orders,
+		manga:  stores.Manga,
+		users:  stores.Users,
+		outbox: stores.Outbox,
+	}
+}
+
+// PlaceOrder takes stock for every item and records a paid order in one
+// transaction, together with the graph event for the new PURCHASED edges.
+// Stock is taken with conditional updates, so concurrent buyers can never
+// drive a quantity below zero; if any item is short nothing is recorded.
+func (s OrderService) PlaceOrder(ctx context.Context, userID primitive.ObjectID, items []models.OrderItem) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	if _, err := s.users.GetActive(ctx, userID.Hex()); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	var order *models.Order
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.reserveStock(ctx, items); err != nil {
+			return err
+		}
+
+		var err error
+		order, err = s.createOrder(ctx, userID, items)
+		if err != nil {
+			return err
+		}
+
+		purchased := make([]models.GraphManga, 0, len(items))
+		for _, item := range items {
+			purchased = append(purchased, models.GraphManga{ID: item.MangaID, Title: item.Title, Genres: item.Genres})
+		}
+
+		return s.outbox.Record(ctx, models.GraphEventMangaPurchased, models.GraphEventPayload{
+			UserID: userID.Hex(),
+			Manga:  purchased,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s OrderService) createOrder(ctx context.Context, userID primitive.ObjectID, items []models.OrderItem) (*models.Order, error) {
+	now := int(time.Now().Unix())
+	order := models.Order{
+		UserID: userID.Hex(),
+		Items:  items,
+		Status: models.OrderStatusPaid,
+		StatusHistory: []models.OrderStatusChange{
+			{Status: models.OrderStatusPending, ChangedAt: now, ChangedBy: userID.Hex()},
+			{Status: models.OrderStatusPaid, ChangedAt: now, ChangedBy: userID.Hex()},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i := range order.Items {
+		order.Items[i].Subtotal = order.Items[i].Price * float64(order.Items[i].Quantity)
+		order.Total += order.Items[i].Subtotal
+	}
+
+	return s.orders.Create(ctx, order)
+}
+
+// reserveStock decrements each item's quantity only while enough copies are
+// left. It must run inside a transaction, which undoes the items already
+// reserved when a later one cannot be covered.
+func (s OrderService) reserveStock(ctx context.Context, items []models.OrderItem) error {
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return ErrInvalidQuantity
+		}
+
+		reserved, err := s.manga.ReserveStock(ctx, item.MangaID, item.Quantity)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			return fmt.Errorf("%w: %s", ErrInsufficientStock, item.Title)
+		}
+	}
+
+	return nil
+}
+
+func (s OrderService) releaseStock(ctx context.Context, items []models.OrderItem) error {
+	for _, item := range items {
+		if err := s.manga.ReleaseStock(ctx, item.MangaID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s OrderService) GetOrder(ctx context.Context, orderID primitive.ObjectID) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	order, err := s.orders.Get(ctx, orderID.Hex())
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// orderSorts are the orders order lists can be paged in.
+var orderSorts = map[string]pagination.Keyset{
+	"newest": {Field: "createdAt", Descending: true},
+	"oldest": {Field: "createdAt"},
+}
+
+func (s OrderService) GetUserOrders(ctx context.Context, userID primitive.ObjectID, params pagination.Params) (pagination.Page[models.Order], error) {
+	return s.pageOrders(ctx, repositories.OrderFilter{UserID: userID.Hex()}, params)
+}
+
+// ListOrders returns a page of every order, optionally narrowed to one status
+// and/or user.
+func (s OrderService) ListOrders(ctx context.Context, status models.OrderStatus, userID string, params pagination.Params) (pagination.Page[models.Order], error) {
+	if status != "" && !status.Valid() {
+		return pagination.Page[models.Order]{}, ErrInvalidOrderStatus
+	}
+
+	return s.pageOrders(ctx, repositories.OrderFilter{UserID: userID, Status: status}, params)
+}
+
+func (s OrderService) pageOrders(ctx context.Context, filter repositories.OrderFilter, params pagination.Params) (pagination.Page[models.Order], error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	sort := params.Sort
+	if sort == "" {
+		sort = "newest"
+	}
+	keyset, ok := orderSorts[sort]
+	if !ok {
+		return pagination.Page[models.Order]{}, fmt.Errorf("%w %q", pagination.ErrInvalidSort, sort)
+	}
+
+	return s.orders.List(ctx, filter, sort, keyset, params)
+}
+
+// CancelOrder lets a customer cancel one of their own orders before it ships.
+func (s OrderService) CancelOrder(ctx context.Context, userID, orderID primitive.ObjectID) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID.Hex() {
+		return nil, ErrOrderNotFound
+	}
+
+	return s.transition(ctx, order, models.OrderStatusCancelled, userID.Hex(), "cancelled by customer")
+}
+
+// UpdateStatus moves an order along its lifecycle on behalf of an admin.
+func (s OrderService) UpdateStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus, actorID primitive.ObjectID, note string) (*models.Order, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidOrderStatus
+	}
+
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.transition(ctx, order, status, actorID.Hex(), note)
+}
+
+// PurchaseHistory flattens the user's active orders into purchases, after any
+// purchases recorded on the user document before orders existed.
+func (s OrderService) PurchaseHistory(ctx context.Context, user models.User) ([]models.Purchase, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
+
+	return s.purchaseHistory(ctx, user)
+}
+
+func (s OrderService) purchaseHistory(ctx context.Context, user models.User) ([]models.Purchase, error) {
+	orders, err := s.orders.ForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	purchases := append([]models.Purchase{}, user.PurchaseHistory...)
+	for i := len(orders) - 1; i >= 0; i-- {
+		order := orders[i]
+		if !order.Status.Active() {
+			continue
+		}
+		for _, item := range order.Items {
+			purchases = append(purchases, models.Purchase{
+				MangaID:      item.MangaID,
+				Title:        item.Title,
+				Price:        item.Price,
+				Quantity:     item.Quantity,
+				PurchaseDate: time.Unix(int64(order.CreatedAt), 0).Format(time.RFC3339),
+			})
+		}
+	}
+
+	return purchases, nil
+}
+
+func (s OrderService) transition(ctx context.Context, order *models.Order, status models.OrderStatus, actorID, note string) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	if !order.Status.CanTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidOrderTransition, order.Status, status)
+	}
+
+	now := int(time.Now().Unix())
+	change := models.OrderStatusChange{Status: status, ChangedAt: now, ChangedBy: actorID, Note: note}
+
+	var updated *models.Order
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.orders.Transition(ctx, order.ID, order.Status, change)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return fmt.Errorf("%w: order was modified concurrently", ErrInvalidOrderTransition)
+			}
+			return err
+		}
+
+		if order.Status.Active() && !status.Active() {
+			return s.releaseOrder(ctx, updated)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// releaseOrder puts the stock of a cancelled or refunded order back and queues
+// removal of PURCHASED edges the user no longer has another purchase behind.
+// It runs inside the transaction that changes the order's status.
+func (s OrderService) releaseOrder(ctx context.Context, order *models.Order) error {
+	if err := s.releaseStock(ctx, order.Items); err != nil {
+		return err
+	}
+
+	user, err := s.users.Get(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+
+	purchases, err := s.purchaseHistory(ctx, *user)
+	if err != nil {
+		return err
+	}
+	stillPurchased := map[string]bool{}
+	for _, purchase := range purchases {
+		stillPurchased[purchase.MangaID] = true
+	}
+
+	var released []models.GraphManga
+	for _, item := range order.Items {
+		if !stillPurchased[item.MangaID] {
+			released = append(released, models.GraphManga{ID: item.MangaID, Title: item.Title, Genres: item.Genres})
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+
+	return s.outbox.Record(ctx, models.GraphEventPurchaseRemoved, models.GraphEventPayload{
+		UserID: order.UserID,
+		Manga:  released,
+	})
+}
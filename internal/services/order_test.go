@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"manga_store/internal/databases"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderBackend is a set of stores to run the order tests against, with a
+// way to count the graph events they have recorded.
+type orderBackend struct {
+	name   string
+	stores func(t *testing.T) (repositories.Stores, func() int)
+}
+
+// orderBackends are the memory stores, and the MongoDB instance named by
+// MONGO_TEST_URI when it is set. Orders are placed in transactions, so that
+// instance must be a replica set.
+var orderBackends = []orderBackend{
+	{"memory", memoryOrderStores},
+	{"mongo", mongoOrderStores},
+}
+
+func memoryOrderStores(t *testing.T) (repositories.Stores, func() int) {
+	stores := repositories.NewMemoryStores()
+	outbox := stores.Outbox.(repositories.MemoryOutbox)
+
+	return stores, func() int { return len(outbox.Events()) }
+}
+
+func mongoOrderStores(t *testing.T) (repositories.Stores, func() int) {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("manga_store_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	return repositories.NewMongoStores(db, nil, databases.Graph{}), func() int {
+		events, err := db.Collection("outbox").CountDocuments(context.Background(), bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(events)
+	}
+}
+
+// forEachOrderBackend runs test once per backend, with a fresh OrderService.
+func forEachOrderBackend(t *testing.T, test func(t *testing.T, s OrderService, events func() int)) {
+	for _, backend := range orderBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			stores, events := backend.stores(t)
+			test(t, NewOrderService(stores), events)
+		})
+	}
+}
+
+func createBuyer(t *testing.T, s OrderService, email string) primitive.ObjectID {
+	t.Helper()
+
+	user, err := s.users.Create(context.Background(), models.User{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := primitive.ObjectIDFromHex(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func TestPlaceOrderDoesNotOversell(t *testing.T) {
+	forEachOrderBackend(t, func(t *testing.T, s OrderService, events func() int) {
+		ctx := context.Background()
+
+		const stock = 5
+		const buyers = 40
+
+		berserk, err := s.manga.Create(ctx, models.Manga{Title: "Berserk", Price: 14.99, Quantity: stock})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID := createBuyer(t, s, "buyer@example.com")
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		placed, rejected := 0, 0
+
+		for i := 0; i < buyers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.PlaceOrder(ctx, userID, []models.OrderItem{{MangaID: berserk.ID, Title: "Berserk", Price: 14.99, Quantity: 1}})
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					placed++
+				case errors.Is(err, ErrInsufficientStock):
+					rejected++
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if placed != stock || rejected != buyers-stock {
+			t.Errorf("placed %d and rejected %d orders, want %d and %d", placed, rejected, stock, buyers-stock)
+		}
+
+		manga, err := s.manga.Get(ctx, berserk.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manga.Quantity != 0 || manga.Sold != stock {
+			t.Errorf("quantity = %d, sold = %d, want 0 and %d", manga.Quantity, manga.Sold, stock)
+		}
+
+		orders, err := s.orders.ForUser(ctx, userID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orders) != stock || events() != stock {
+			t.Errorf("recorded %d orders and %d graph events, want %d of each", len(orders), events(), stock)
+		}
+	})
+}
+
+func TestPlaceOrderReleasesStockWhenAnItemIsShort(t *testing.T) {
+	forEachOrderBackend(t, func(t *testing.T, s OrderService, events func() int) {
+		ctx := context.Background()
+
+		plenty, err := s.manga.Create(ctx, models.Manga{Title: "Monster", Quantity: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scarce, err := s.manga.Create(ctx, models.Manga{Title: "Pluto", Quantity: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID := createBuyer(t, s, "")
+
+		_, err = s.PlaceOrder(ctx, userID, []models.OrderItem{
+			{MangaID: plenty.ID, Title: "Monster", Quantity: 3},
+			{MangaID: scarce.ID, Title: "Pluto", Quantity: 2},
+		})
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Fatalf("err = %v, want ErrInsufficientStock", err)
+		}
+
+		manga, err := s.manga.Get(ctx, plenty.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manga.Quantity != 10 || manga.Sold != 0 {
+			t.Errorf("quantity = %d, sold = %d after failed order, want 10 and 0", manga.Quantity, manga.Sold)
+		}
+
+		orders, _ := s.orders.ForUser(ctx, userID.Hex())
+		if len(orders) != 0 || events() != 0 {
+			t.Errorf("recorded %d orders and %d graph events for a failed checkout", len(orders), events())
+		}
+	})
+}
+
+func TestPlaceOrderStopsWhenTheRequestEnds(t *testing.T) {
+	forEachOrderBackend(t, func(t *testing.T, s OrderService, events func() int) {
+		monster, err := s.manga.Create(context.Background(), models.Manga{Title: "Monster", Quantity: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID := createBuyer(t, s, "leaver@example.com")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = s.PlaceOrder(ctx, userID, []models.OrderItem{{MangaID: monster.ID, Title: "Monster", Quantity: 1}})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+
+		manga, err := s.manga.Get(context.Background(), monster.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manga.Quantity != 2 || events() != 0 {
+			t.Errorf("quantity = %d with %d graph events after a cancelled order, want 2 and 0", manga.Quantity, events())
+		}
+	})
+}
+
+func TestCancelOrderRestocksAndRemovesPurchase(t *testing.T) {
+	forEachOrderBackend(t, func(t *testing.T, s OrderService, events func() int) {
+		ctx := context.Background()
+
+		vagabond, err := s.manga.Create(ctx, models.Manga{Title: "Vagabond", Price: 9.99, Quantity: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID := createBuyer(t, s, "reader@example.com")
+
+		order, err := s.PlaceOrder(ctx, userID, []models.OrderItem{{MangaID: vagabond.ID, Title: "Vagabond", Price: 9.99, Quantity: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		orderID, _ := primitive.ObjectIDFromHex(order.ID)
+
+		if _, err := s.CancelOrder(ctx, primitive.NewObjectID(), orderID); !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("cancelling another user's order: err = %v, want ErrOrderNotFound", err)
+		}
+
+		cancelled, err := s.CancelOrder(ctx, userID, orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cancelled.Status != models.OrderStatusCancelled {
+			t.Errorf("status = %s, want %s", cancelled.Status, models.OrderStatusCancelled)
+		}
+
+		manga, err := s.manga.Get(ctx, vagabond.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manga.Quantity != 3 || manga.Sold != 0 {
+			t.Errorf("quantity = %d, sold = %d after cancelling, want 3 and 0", manga.Quantity, manga.Sold)
+		}
+		if events() != 2 {
+			t.Errorf("recorded %d graph events, want a purchase and its removal", events())
+		}
+
+		if _, err := s.CancelOrder(ctx, userID, orderID); !errors.Is(err, ErrInvalidOrderTransition) {
+			t.Errorf("cancelling twice: err = %v, want ErrInvalidOrderTransition", err)
+		}
+	})
+}
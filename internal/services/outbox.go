@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/logger"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"time"
+)
+
+const (
+	graphSyncInterval    = time.Second
+	graphSyncLease       = 30 * time.Second
+	graphSyncMaxAttempts = 10
+	graphSyncMaxBackoff  = 5 * time.Minute
+)
+
+func graphManga(manga models.Manga) models.GraphManga {
+	return models.GraphManga{ID: manga.ID, Title: manga.Title, Genres: manga.Genres}
+}
+
+// GraphSyncRelay applies the events in the outbox to the graph. Events are
+// claimed with a lease so several relays can run side by side, retried with
+// exponential backoff, and parked as failed once they run out of attempts.
+// The default memory stores apply events as they commit and need no relay.
+type GraphSyncRelay struct {
+	outbox repositories.Outbox
+	graph  repositories.GraphStore
+}
+
+func NewGraphSyncRelay(stores repositories.Stores) GraphSyncRelay {
+	return GraphSyncRelay{
+		outbox: stores.Outbox,
+		graph:  stores.Graph,
+	}
+}
+
+// Start relays events in the background until ctx ends. The returned
+// channel is closed once the relay has stopped.
+func (r GraphSyncRelay) Start(ctx context.Context) <-chan struct{} {
+	stopped := make(chan struct{})
+
+	go func(r GraphSyncRelay) {
+		defer close(stopped)
+		for {
+			if err := r.drain(ctx); err != nil {
+				logger.Error("Error relaying graph sync events: " + err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(graphSyncInterval):
+			}
+		}
+	}(r)
+
+	return stopped
+}
+
+// drain applies claimable events until none are left or ctx ends. An event
+// already claimed is finished first; one left half applied would only be
+// retried once its lease runs out.
+func (r GraphSyncRelay) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		event, err := r.claim()
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+
+		if err := r.apply(*event); err != nil {
+			if err := r.fail(*event, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := r.complete(*event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r GraphSyncRelay) claim() (*models.GraphEvent, error) {
+	ctx, cancel := withTimeout(context.Background(), opWrite)
+	defer cancel()
+
+	return r.outbox.Claim(ctx, graphSyncLease)
+}
+
+func (r GraphSyncRelay) complete(event models.GraphEvent) error {
+	ctx, cancel := withTimeout(context.Background(), opWrite)
+	defer cancel()
+
+	return r.outbox.Complete(ctx, event.ID)
+}
+
+func (r GraphSyncRelay) fail(event models.GraphEvent, cause error) error {
+	ctx, cancel := withTimeout(context.Background(), opWrite)
+	defer cancel()
+
+	event.Attempts++
+	event.LastError = cause.Error()
+	if event.Attempts >= graphSyncMaxAttempts {
+		event.Status = models.GraphEventFailed
+		logger.Error(fmt.Sprintf("Graph sync event %s (%s) failed permanently after %d attempts: %s", event.ID, event.Type, event.Attempts, cause.Error()))
+	} else {
+		logger.Warn(fmt.Sprintf("Graph sync event %s (%s) failed, attempt %d: %s", event.ID, event.Type, event.Attempts, cause.Error()))
+	}
+
+	backoff := time.Second << event.Attempts
+	if backoff > graphSyncMaxBackoff {
+		backoff = graphSyncMaxBackoff
+	}
+	event.NextAttemptAt = time.Now().Add(backoff).Unix()
+
+	return r.outbox.Fail(ctx, event)
+}
+
+func (r GraphSyncRelay) apply(event models.GraphEvent) error {
+	ctx, cancel := withTimeout(context.Background(), opGraph)
+	defer cancel()
+
+	return r.graph.Apply(ctx, event)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"testing"
+	"time"
+)
+
+// flakyGraph fails the first failures events it is asked to apply.
+type flakyGraph struct {
+	repositories.GraphStore
+	failures int
+}
+
+func (g *flakyGraph) Apply(ctx context.Context, event models.GraphEvent) error {
+	if g.failures > 0 {
+		g.failures--
+		return errors.New("graph unavailable")
+	}
+	return g.GraphStore.Apply(ctx, event)
+}
+
+func recordRating(t *testing.T, stores repositories.Stores, userID, mangaID string, score float64) {
+	t.Helper()
+
+	err := stores.Outbox.Record(context.Background(), models.GraphEventMangaRated, models.GraphEventPayload{
+		UserID: userID,
+		Manga:  []models.GraphManga{{ID: mangaID}},
+		Score:  score,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphSyncRelayAppliesQueuedEvents(t *testing.T) {
+	stores := repositories.NewQueuedMemoryStores()
+	graph := stores.Graph.(*repositories.MemoryGraphStore)
+
+	recordRating(t, stores, "alice", "berserk", 5)
+	if _, ok := graph.Rating("alice", "berserk"); ok {
+		t.Fatal("queued event was applied before the relay ran")
+	}
+
+	if err := NewGraphSyncRelay(stores).drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if score, ok := graph.Rating("alice", "berserk"); !ok || score != 5 {
+		t.Errorf("rating = %v, %v after relaying, want 5", score, ok)
+	}
+	for _, event := range stores.Outbox.(repositories.MemoryOutbox).Events() {
+		if event.Status != models.GraphEventProcessed || event.Attempts != 1 {
+			t.Errorf("event %s is %s after %d attempts, want processed after 1", event.Type, event.Status, event.Attempts)
+		}
+	}
+}
+
+func TestGraphSyncRelayBacksOffAfterAFailure(t *testing.T) {
+	stores := repositories.NewQueuedMemoryStores()
+	graph := stores.Graph.(*repositories.MemoryGraphStore)
+	stores.Graph = &flakyGraph{GraphStore: graph, failures: 1}
+	relay := NewGraphSyncRelay(stores)
+
+	recordRating(t, stores, "alice", "berserk", 5)
+
+	for i := 0; i < 2; i++ {
+		if err := relay.drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := stores.Outbox.(repositories.MemoryOutbox).Events()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Status != models.GraphEventPending || event.Attempts != 1 || event.LastError == "" {
+		t.Errorf("event is %s after %d attempts with error %q, want pending after 1 with the error", event.Status, event.Attempts, event.LastError)
+	}
+	if event.NextAttemptAt <= time.Now().Unix() {
+		t.Errorf("failed event is due again straight away")
+	}
+	if _, ok := graph.Rating("alice", "berserk"); ok {
+		t.Error("failed event was retried before its backoff")
+	}
+}
+
+func TestGraphSyncRelayKeepsEventsForTheSameEntityInOrder(t *testing.T) {
+	stores := repositories.NewQueuedMemoryStores()
+	graph := stores.Graph.(*repositories.MemoryGraphStore)
+	stores.Graph = &flakyGraph{GraphStore: graph, failures: 1}
+	outbox := stores.Outbox.(repositories.MemoryOutbox)
+	relay := NewGraphSyncRelay(stores)
+	ctx := context.Background()
+
+	recordRating(t, stores, "alice", "berserk", 5)
+	err := stores.Outbox.Record(ctx, models.GraphEventRatingRemoved, models.GraphEventPayload{
+		UserID: "alice",
+		Manga:  []models.GraphManga{{ID: "berserk"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordRating(t, stores, "carol", "yotsuba", 4)
+
+	if err := relay.drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := outbox.Events()
+	if events[1].Status != models.GraphEventPending || events[1].Attempts != 0 {
+		t.Errorf("rating removal was applied before the rating it removes")
+	}
+	if _, ok := graph.Rating("carol", "yotsuba"); !ok {
+		t.Error("an event for other entities was held back")
+	}
+
+	// Make the failed rating due again, as its backoff would.
+	retry := events[0]
+	retry.NextAttemptAt = 0
+	if err := outbox.Fail(ctx, retry); err != nil {
+		t.Fatal(err)
+	}
+	if err := relay.drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := graph.Rating("alice", "berserk"); ok {
+		t.Error("the rating was applied after its removal")
+	}
+	for _, event := range outbox.Events() {
+		if event.Status != models.GraphEventProcessed {
+			t.Errorf("event %s is %s, want processed", event.Type, event.Status)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"sort"
+	"strings"
+)
+
+const reconcileBatchSize = 500
+
+// ReconcileService compares the graph with MongoDB and can rewrite the graph
+// to match. MongoDB is always treated as the source of truth.
+type ReconcileService struct {
+	manga  repositories.MangaRepository
+	users  repositories.UserRepository
+	graph  repositories.GraphStore
+	orders OrderService
+}
+
+func NewReconcileService(stores repositories.Stores) ReconcileService {
+	return ReconcileService{
+		manga:  stores.Manga,
+		users:  stores.Users,
+		graph:  stores.Graph,
+		orders: NewOrderService(stores),
+	}
+}
+
+type ratingKey struct {
+	userID  string
+	mangaID string
+}
+
+func (s ReconcileService) Diff(ctx context.Context) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{}
+
+	// Step 1: Load the expected state from MongoDB
+	manga, err := s.manga.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	activeManga := map[string]models.GraphManga{}
+	for _, m := range manga {
+		activeManga[m.ID] = graphManga(m)
+	}
+
+	users, err := s.users.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	activeUsers := map[string]models.GraphUser{}
+	expectedRatings := map[ratingKey]float64{}
+	expectedPurchases := map[ratingKey]bool{}
+	for _, user := range users {
+		activeUsers[user.ID] = models.GraphUser{ID: user.ID, Email: user.Email}
+
+		for _, rating := range user.Ratings {
+			if _, ok := activeManga[rating.MangaID]; ok {
+				expectedRatings[ratingKey{user.ID, rating.MangaID}] = rating.Score
+			}
+		}
+
+		purchases, err := s.orders.purchaseHistory(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		for _, purchase := range purchases {
+			if _, ok := activeManga[purchase.MangaID]; ok {
+				expectedPurchases[ratingKey{user.ID, purchase.MangaID}] = true
+			}
+		}
+	}
+
+	graph, err := s.graph.Snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	// Step 2: Compare manga nodes
+	graphMangaIDs := map[string]bool{}
+	for _, m := range graph.Manga {
+		graphMangaIDs[m.ID] = true
+
+		expected, ok := activeManga[m.ID]
+		if !ok {
+			report.StaleManga = append(report.StaleManga, m.ID)
+			continue
+		}
+		if m.Title != expected.Title || !sameGenres(m.Genres, expected.Genres) {
+			report.MismatchedManga = append(report.MismatchedManga, expected)
+		}
+	}
+	for id, manga := range activeManga {
+		if !graphMangaIDs[id] {
+			report.MissingManga = append(report.MissingManga, manga)
+		}
+	}
+
+	// Step 3: Compare user nodes
+	graphUserIDs := map[string]bool{}
+	for _, u := range graph.Users {
+		graphUserIDs[u.ID] = true
+
+		expected, ok := activeUsers[u.ID]
+		if !ok {
+			report.StaleUsers = append(report.StaleUsers, u.ID)
+			continue
+		}
+		if u.Email != expected.Email {
+			report.MismatchedUsers = append(report.MismatchedUsers, expected)
+		}
+	}
+	for id, user := range activeUsers {
+		if !graphUserIDs[id] {
+			report.MissingUsers = append(report.MissingUsers, user)
+		}
+	}
+
+	// Step 4: Compare RATED edges. Edges hanging off stale nodes go away with
+	// the node, so they are not reported separately.
+	graphRatings := map[ratingKey]bool{}
+	for _, rating := range graph.Ratings {
+		key := ratingKey{rating.UserID, rating.MangaID}
+		if !bothActive(key, activeUsers, activeManga) {
+			continue
+		}
+		graphRatings[key] = true
+
+		score, ok := expectedRatings[key]
+		if !ok {
+			report.StaleRatings = append(report.StaleRatings, models.GraphRating{UserID: key.userID, MangaID: key.mangaID})
+			continue
+		}
+		if rating.Score != score {
+			report.MismatchedScores = append(report.MismatchedScores, models.GraphRating{UserID: key.userID, MangaID: key.mangaID, Score: score})
+		}
+	}
+	for key, score := range expectedRatings {
+		if !graphRatings[key] {
+			report.MissingRatings = append(report.MissingRatings, models.GraphRating{UserID: key.userID, MangaID: key.mangaID, Score: score})
+		}
+	}
+
+	// Step 5: Compare PURCHASED edges
+	graphPurchases := map[ratingKey]bool{}
+	for _, purchase := range graph.Purchases {
+		key := ratingKey{purchase.UserID, purchase.MangaID}
+		if !bothActive(key, activeUsers, activeManga) {
+			continue
+		}
+		graphPurchases[key] = true
+
+		if !expectedPurchases[key] {
+			report.StalePurchases = append(report.StalePurchases, models.GraphPurchase{UserID: key.userID, MangaID: key.mangaID})
+		}
+	}
+	for key := range expectedPurchases {
+		if !graphPurchases[key] {
+			report.MissingPurchases = append(report.MissingPurchases, models.GraphPurchase{UserID: key.userID, MangaID: key.mangaID})
+		}
+	}
+
+	sortReport(report)
+
+	return report, nil
+}
+
+// Repair rewrites the graph so that every difference in the report is gone.
+// It applies the same events the relay does, so the graph store needs no
+// repair queries of its own. Nodes are fixed before edges so new edges
+// always have both endpoints.
+func (s ReconcileService) Repair(ctx context.Context, report *models.ReconcileReport) error {
+	var events []models.GraphEvent
+	add := func(eventType models.GraphEventType, payload models.GraphEventPayload) {
+		events = append(events, models.GraphEvent{Type: eventType, Payload: payload})
+	}
+
+	for _, ids := range batches(report.StaleManga) {
+		var manga []models.GraphManga
+		for _, id := range ids {
+			manga = append(manga, models.GraphManga{ID: id})
+		}
+		add(models.GraphEventMangaDeleted, models.GraphEventPayload{Manga: manga})
+	}
+	for _, id := range report.StaleUsers {
+		add(models.GraphEventUserDeleted, models.GraphEventPayload{UserID: id})
+	}
+	for _, manga := range batches(append(append([]models.GraphManga{}, report.MissingManga...), report.MismatchedManga...)) {
+		add(models.GraphEventMangaUpserted, models.GraphEventPayload{Manga: manga})
+	}
+	for _, u := range append(append([]models.GraphUser{}, report.MissingUsers...), report.MismatchedUsers...) {
+		add(models.GraphEventUserUpserted, models.GraphEventPayload{UserID: u.ID, Email: u.Email})
+	}
+	for _, r := range append(append([]models.GraphRating{}, report.MissingRatings...), report.MismatchedScores...) {
+		add(models.GraphEventMangaRated, models.GraphEventPayload{UserID: r.UserID, Manga: []models.GraphManga{{ID: r.MangaID}}, Score: r.Score})
+	}
+	staleRatings := map[string][]models.GraphManga{}
+	for _, r := range report.StaleRatings {
+		staleRatings[r.UserID] = append(staleRatings[r.UserID], models.GraphManga{ID: r.MangaID})
+	}
+	for userID, manga := range staleRatings {
+		add(models.GraphEventRatingRemoved, models.GraphEventPayload{UserID: userID, Manga: manga})
+	}
+	for userID, manga := range purchasesByUser(report.MissingPurchases) {
+		add(models.GraphEventMangaPurchased, models.GraphEventPayload{UserID: userID, Manga: manga})
+	}
+	for userID, manga := range purchasesByUser(report.StalePurchases) {
+		add(models.GraphEventPurchaseRemoved, models.GraphEventPayload{UserID: userID, Manga: manga})
+	}
+
+	for _, event := range events {
+		if err := s.graph.Apply(ctx, event); err != nil {
+			return fmt.Errorf("failed to repair graph: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// batches splits items so that no single graph write grows too large.
+func batches[T any](items []T) [][]T {
+	var batches [][]T
+	for start := 0; start < len(items); start += reconcileBatchSize {
+		batches = append(batches, items[start:min(start+reconcileBatchSize, len(items))])
+	}
+	return batches
+}
+
+// purchasesByUser groups edges by user, since a graph event names one user.
+func purchasesByUser(edges []models.GraphPurchase) map[string][]models.GraphManga {
+	byUser := map[string][]models.GraphManga{}
+	for _, edge := range edges {
+		byUser[edge.UserID] = append(byUser[edge.UserID], models.GraphManga{ID: edge.MangaID})
+	}
+	return byUser
+}
+
+func bothActive(key ratingKey, users map[string]models.GraphUser, manga map[string]models.GraphManga) bool {
+	_, userOK := users[key.userID]
+	_, mangaOK := manga[key.mangaID]
+	return userOK && mangaOK
+}
+
+func sameGenres(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
+
+func sortReport(r *models.ReconcileReport) {
+	sort.Strings(r.StaleManga)
+	sort.Strings(r.StaleUsers)
+	for _, manga := range [][]models.GraphManga{r.MissingManga, r.MismatchedManga} {
+		sort.Slice(manga, func(i, j int) bool { return manga[i].ID < manga[j].ID })
+	}
+	for _, users := range [][]models.GraphUser{r.MissingUsers, r.MismatchedUsers} {
+		sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	}
+	for _, ratings := range [][]models.GraphRating{r.MissingRatings, r.StaleRatings, r.MismatchedScores} {
+		sort.Slice(ratings, func(i, j int) bool {
+			if ratings[i].UserID != ratings[j].UserID {
+				return ratings[i].UserID < ratings[j].UserID
+			}
+			return ratings[i].MangaID < ratings[j].MangaID
+		})
+	}
+	for _, purchases := range [][]models.GraphPurchase{r.MissingPurchases, r.StalePurchases} {
+		sort.Slice(purchases, func(i, j int) bool {
+			if purchases[i].UserID != purchases[j].UserID {
+				return purchases[i].UserID < purchases[j].UserID
+			}
+			return purchases[i].MangaID < purchases[j].MangaID
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reconcileFixture is a catalog of three manga and three users, with the
+// graph already in sync with it.
+type reconcileFixture struct {
+	stores      repositories.Stores
+	s           ReconcileService
+	berserk     models.Manga
+	vagabond    models.Manga
+	monster     models.Manga
+	guts, casca *models.User
+	griffith    *models.User
+}
+
+func newReconcileFixture(t *testing.T) reconcileFixture {
+	t.Helper()
+	ctx := context.Background()
+
+	// Repository writes record no graph events, so the graph starts empty.
+	f := reconcileFixture{stores: repositories.NewMemoryStores()}
+	f.s = NewReconcileService(f.stores)
+
+	manga := []*models.Manga{&f.berserk, &f.vagabond, &f.monster}
+	for i, title := range []string{"Berserk", "Vagabond", "Monster"} {
+		created, err := f.stores.Manga.Create(ctx, models.Manga{Title: title, Genres: []string{"Seinen"}, Price: 9.99, Quantity: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		*manga[i] = *created
+	}
+
+	users := []**models.User{&f.guts, &f.casca, &f.griffith}
+	for i, email := range []string{"guts@example.com", "casca@example.com", "griffith@example.com"} {
+		user := models.User{Email: email}
+		if i == 0 {
+			user.PurchaseHistory = []models.Purchase{{MangaID: f.berserk.ID, Title: f.berserk.Title, Price: 9.99, Quantity: 1}}
+		}
+		created, err := f.stores.Users.Create(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*users[i] = created
+	}
+
+	for _, rating := range []struct {
+		user    *models.User
+		mangaID string
+		score   float64
+	}{
+		{f.guts, f.berserk.ID, 5},
+		{f.guts, f.vagabond.ID, 4},
+		{f.casca, f.vagabond.ID, 3},
+	} {
+		if err := f.stores.Users.AddRating(ctx, rating.user.ID, models.Rating{MangaID: rating.mangaID, Score: rating.score}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := f.s.Diff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &models.ReconcileReport{
+		MissingManga: sortedBy(func(m models.GraphManga) string { return m.ID },
+			graphManga(f.berserk), graphManga(f.vagabond), graphManga(f.monster)),
+		MissingUsers: sortedBy(func(u models.GraphUser) string { return u.ID },
+			models.GraphUser{ID: f.guts.ID, Email: f.guts.Email},
+			models.GraphUser{ID: f.casca.ID, Email: f.casca.Email},
+			models.GraphUser{ID: f.griffith.ID, Email: f.griffith.Email}),
+		MissingRatings: sortedBy(func(r models.GraphRating) string { return r.UserID + r.MangaID },
+			models.GraphRating{UserID: f.guts.ID, MangaID: f.berserk.ID, Score: 5},
+			models.GraphRating{UserID: f.guts.ID, MangaID: f.vagabond.ID, Score: 4},
+			models.GraphRating{UserID: f.casca.ID, MangaID: f.vagabond.ID, Score: 3}),
+		MissingPurchases: []models.GraphPurchase{{UserID: f.guts.ID, MangaID: f.berserk.ID}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("diff of an empty graph = %+v, want %+v", report, want)
+	}
+
+	f.repair(t)
+	return f
+}
+
+// repair repairs the graph and checks nothing is left to repair.
+func (f reconcileFixture) repair(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+
+	report, err := f.s.Diff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.s.Repair(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = f.s.Diff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Differences() != 0 {
+		t.Fatalf("diff after repair = %+v, want no differences", report)
+	}
+}
+
+// sortedBy sorts items the way a report lists them.
+func sortedBy[T any](key func(T) string, items ...T) []T {
+	slices.SortFunc(items, func(a, b T) int { return strings.Compare(key(a), key(b)) })
+	return items
+}
+
+func TestReconcile(t *testing.T) {
+	apply := func(t *testing.T, f reconcileFixture, eventType models.GraphEventType, payload models.GraphEventPayload) {
+		t.Helper()
+		if err := f.stores.Graph.Apply(context.Background(), models.GraphEvent{Type: eventType, Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		drift func(t *testing.T, f reconcileFixture)
+		want  func(f reconcileFixture) *models.ReconcileReport
+		check func(t *testing.T, f reconcileFixture)
+	}{
+		{
+			name: "missing nodes",
+			drift: func(t *testing.T, f reconcileFixture) {
+				apply(t, f, models.GraphEventMangaDeleted, models.GraphEventPayload{Manga: []models.GraphManga{{ID: f.monster.ID}}})
+				apply(t, f, models.GraphEventUserDeleted, models.GraphEventPayload{UserID: f.griffith.ID})
+			},
+			want: func(f reconcileFixture) *models.ReconcileReport {
+				return &models.ReconcileReport{
+					MissingManga: []models.GraphManga{graphManga(f.monster)},
+					MissingUsers: []models.GraphUser{{ID: f.griffith.ID, Email: f.griffith.Email}},
+				}
+			},
+		},
+		{
+			name: "soft-deleted manga",
+			drift: func(t *testing.T, f reconcileFixture) {
+				if err := f.stores.Manga.Delete(context.Background(), f.vagabond.ID, int(time.Now().Unix())); err != nil {
+					t.Fatal(err)
+				}
+			},
+			// The RATED edges to the deleted manga go with its node, so they
+			// are not reported on their own.
+			want: func(f reconcileFixture) *models.ReconcileReport {
+				return &models.ReconcileReport{StaleManga: []string{f.vagabond.ID}}
+			},
+			check: func(t *testing.T, f reconcileFixture) {
+				graph := f.stores.Graph.(*repositories.MemoryGraphStore)
+				if _, ok := graph.Rating(f.casca.ID, f.vagabond.ID); ok {
+					t.Error("RATED edge to the deleted manga survived the repair")
+				}
+			},
+		},
+		{
+			name: "wrong RATED score",
+			drift: func(t *testing.T, f reconcileFixture) {
+				apply(t, f, models.GraphEventMangaRated, models.GraphEventPayload{
+					UserID: f.guts.ID,
+					Manga:  []models.GraphManga{graphManga(f.berserk)},
+					Score:  2,
+				})
+			},
+			want: func(f reconcileFixture) *models.ReconcileReport {
+				return &models.ReconcileReport{
+					MismatchedScores: []models.GraphRating{{UserID: f.guts.ID, MangaID: f.berserk.ID, Score: 5}},
+				}
+			},
+			check: func(t *testing.T, f reconcileFixture) {
+				graph := f.stores.Graph.(*repositories.MemoryGraphStore)
+				if score, _ := graph.Rating(f.guts.ID, f.berserk.ID); score != 5 {
+					t.Errorf("RATED score after repair = %v, want 5", score)
+				}
+			},
+		},
+		{
+			name: "missing PURCHASED edge",
+			drift: func(t *testing.T, f reconcileFixture) {
+				apply(t, f, models.GraphEventPurchaseRemoved, models.GraphEventPayload{
+					UserID: f.guts.ID,
+					Manga:  []models.GraphManga{{ID: f.berserk.ID}},
+				})
+			},
+			want: func(f reconcileFixture) *models.ReconcileReport {
+				return &models.ReconcileReport{
+					MissingPurchases: []models.GraphPurchase{{UserID: f.guts.ID, MangaID: f.berserk.ID}},
+				}
+			},
+			check: func(t *testing.T, f reconcileFixture) {
+				graph := f.stores.Graph.(*repositories.MemoryGraphStore)
+				if !graph.Purchased(f.guts.ID, f.berserk.ID) {
+					t.Error("PURCHASED edge is still missing after repair")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReconcileFixture(t)
+			tt.drift(t, f)
+
+			report, err := f.s.Diff(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.want(f); !reflect.DeepEqual(report, want) {
+				t.Fatalf("diff = %+v, want %+v", report, want)
+			}
+
+			f.repair(t)
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/logger"
+	"manga_store/internal/repositories"
+	"manga_store/internal/search"
+	"time"
+)
+
+// CatalogSearch loads the parts of catalog search that live in memory: the
+// autocomplete suggester and, when SEARCH_INDEX is "memory", the search
+// index. Writes made through MangaService are applied to them straight
+// away; Start rebuilds them every SEARCH_REBUILD_MINUTES so writes made by
+// other API instances are picked up too.
+type CatalogSearch struct {
+	manga     repositories.MangaRepository
+	index     *search.MemoryIndex
+	suggester *search.Suggester
+	interval  time.Duration
+}
+
+func NewCatalogSearch(stores repositories.Stores) CatalogSearch {
+	index, _ := stores.Search.(*search.MemoryIndex)
+
+	return CatalogSearch{
+		manga:     stores.Manga,
+		index:     index,
+		suggester: stores.Suggester,
+		interval:  time.Duration(helpers.GetEnvInt("SEARCH_REBUILD_MINUTES", 10)) * time.Minute,
+	}
+}
+
+// Start loads the catalog and keeps rebuilding it in the background until
+// ctx ends. A failed load is logged and retried at the next rebuild. The
+// returned channel is closed once the rebuilds have stopped.
+func (c CatalogSearch) Start(ctx context.Context) <-chan struct{} {
+	if err := c.Load(ctx); err != nil {
+		logger.Error("Error loading catalog search: " + err.Error())
+	}
+
+	stopped := make(chan struct{})
+
+	go func(c CatalogSearch) {
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.interval):
+			}
+
+			if err := c.Load(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("Error rebuilding catalog search: " + err.Error())
+			}
+		}
+	}(c)
+
+	return stopped
+}
+
+// Load rebuilds the suggester, and the memory index when there is one, from
+// the active catalog.
+func (c CatalogSearch) Load(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	catalog, err := c.manga.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.index != nil {
+		if err := c.index.Load(ctx, catalog); err != nil {
+			return err
+		}
+	}
+	c.suggester.Load(catalog)
+
+	logger.Debug(fmt.Sprintf("Loaded %d manga into catalog search", len(catalog)))
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"manga_store/internal/helpers"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"time"
+)
+
+const (
+	sessionKeyPrefix     = "session:"
+	userSessionsPrefix   = "user_sessions:"
+	sessionRenewInterval = time.Minute
+)
+
+var ErrSessionNotFound = errors.New("session not found or expired")
+
+// SessionService keeps logins in the cache. A session expires after
+// SESSION_IDLE_HOURS without use, and in any case SESSION_MAX_DAYS after
+// login. Each user's session hashes are also kept in a set so they can all
+// be revoked at once.
+type SessionService struct {
+	cache       repositories.Cache
+	idleTTL     time.Duration
+	maxLifetime time.Duration
+}
+
+func NewSessionService(stores repositories.Stores) SessionService {
+	return SessionService{
+		cache:       stores.Cache,
+		idleTTL:     time.Duration(helpers.GetEnvInt("SESSION_IDLE_HOURS", 24)) * time.Hour,
+		maxLifetime: time.Duration(helpers.GetEnvInt("SESSION_MAX_DAYS", 30)) * 24 * time.Hour,
+	}
+}
+
+func sessionKey(sessionID string) string {
+	return sessionKeyPrefix + hashToken(sessionID)
+}
+
+func userSessionsKey(userID string) string {
+	return userSessionsPrefix + userID
+}
+
+func hashToken(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create starts a session for user and returns it with its new random ID.
+func (s SessionService) Create(ctx context.Context, user models.User, ip, userAgent string) (*models.Session, error) {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         base64.RawURLEncoding.EncodeToString(raw),
+		UserID:     user.ID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+		ExpiresAt:  now.Add(s.maxLifetime).Unix(),
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	// The session is listed under its user first, so RevokeAll can always
+	// find a session that was stored.
+	if err := s.cache.SAdd(ctx, userSessionsKey(user.ID), s.maxLifetime, hashToken(session.ID)); err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(ctx, sessionKey(session.ID), string(data), s.idleTTL); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Validate returns the live session for sessionID and slides its idle expiry
+// forward, never past the session's absolute expiry.
+func (s SessionService) Validate(ctx context.Context, sessionID string) (*models.Session, error) {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	if sessionID == "" {
+		return nil, ErrSessionNotFound
+	}
+
+	data, err := s.cache.Get(ctx, sessionKey(sessionID))
+	if err != nil {
+		if err == repositories.ErrCacheMiss {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	session.ID = sessionID
+
+	now := time.Now()
+	if now.Unix() >= session.ExpiresAt {
+		s.Revoke(ctx, sessionID)
+		return nil, ErrSessionNotFound
+	}
+
+	if now.Sub(time.Unix(session.LastSeenAt, 0)) >= sessionRenewInterval {
+		session.LastSeenAt = now.Unix()
+		ttl := s.idleTTL
+		if remaining := time.Until(time.Unix(session.ExpiresAt, 0)); remaining < ttl {
+			ttl = remaining
+		}
+
+		data, err := json.Marshal(session)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.cache.Set(ctx, sessionKey(sessionID), string(data), ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// Revoke ends a single session. Revoking an unknown session is not an error.
+func (s SessionService) Revoke(ctx context.Context, sessionID string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	if sessionID == "" {
+		return nil
+	}
+
+	data, err := s.cache.GetDel(ctx, sessionKey(sessionID))
+	if err != nil {
+		if err == repositories.ErrCacheMiss {
+			return nil
+		}
+		return err
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return err
+	}
+
+	return s.cache.SRem(ctx, userSessionsKey(session.UserID), hashToken(sessionID))
+}
+
+// RevokeAll ends every session the user has open, on every device.
+func (s SessionService) RevokeAll(ctx context.Context, userID string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	hashes, err := s.cache.SMembers(ctx, userSessionsKey(userID))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(hashes)+1)
+	for _, hash := range hashes {
+		keys = append(keys, sessionKeyPrefix+hash)
+	}
+	keys = append(keys, userSessionsKey(userID))
+
+	return s.cache.Del(ctx, keys...)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"manga_store/internal/helpers"
+	"strings"
+	"time"
+)
+
+// operation names a kind of service call for the deadline it runs under.
+type operation string
+
+const (
+	// opCache is a call that mostly touches the cache: sessions, tokens,
+	// carts, lockout counters and the audit log. Cart changes also check
+	// the catalog for stock.
+	opCache operation = "cache"
+	// opRead loads documents.
+	opRead operation = "read"
+	// opWrite changes documents, usually in a transaction.
+	opWrite operation = "write"
+	// opSearch runs a catalog search.
+	opSearch operation = "search"
+	// opGraph ranks recommendations in the graph.
+	opGraph operation = "graph"
+	// opBulk works through many documents at once, like restoring a manga
+	// with all its ratings or purging the trash.
+	opBulk operation = "bulk"
+)
+
+// operationTimeouts are the deadlines used when TIMEOUT_<OPERATION> is not
+// set.
+var operationTimeouts = map[operation]time.Duration{
+	opCache:  5 * time.Second,
+	opRead:   10 * time.Second,
+	opWrite:  10 * time.Second,
+	opSearch: 10 * time.Second,
+	opGraph:  10 * time.Second,
+	opBulk:   30 * time.Second,
+}
+
+func init() {
+	for op, fallback := range operationTimeouts {
+		operationTimeouts[op] = helpers.GetEnvDuration("TIMEOUT_"+strings.ToUpper(string(op)), fallback)
+	}
+}
+
+// withTimeout bounds ctx by the deadline for op. The caller's own deadline
+// and cancellation still apply, so a request that ends early stops its
+// database calls too.
+func withTimeout(ctx context.Context, op operation) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, operationTimeouts[op])
+}
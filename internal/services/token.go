@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"manga_store/internal/helpers"
+	"manga_store/internal/jwt"
+	"manga_store/internal/logger"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+
+	refreshTokenPrefix      = "refresh_token:"
+	tokenFamilyPrefix       = "token_family:"
+	userTokenFamiliesPrefix = "user_token_families:"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrRefreshTokenReused = errors.New("refresh token was already used; all tokens from this login have been revoked")
+
+	errTokenKeysMissing = errors.New("JWT keys are not configured")
+)
+
+var (
+	tokenKeysOnce sync.Once
+	tokenKeys     *jwt.KeySet
+	tokenKeysErr  error
+)
+
+// TokenService issues JWTs to API clients that cannot hold a session cookie.
+// Access tokens are short-lived. Each login starts a refresh token family in
+// the cache; refreshing consumes the presented token and issues the next one, and
+// presenting an already-consumed token revokes the whole family.
+type TokenService struct {
+	keys       *jwt.KeySet
+	cache      repositories.Cache
+	users      repositories.UserRepository
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenService(stores repositories.Stores) TokenService {
+	if err := LoadTokenKeys(); err != nil {
+		logger.Error("Failed to load JWT keys: " + err.Error())
+	}
+
+	return TokenService{
+		keys:       tokenKeys,
+		cache:      stores.Cache,
+		users:      stores.Users,
+		accessTTL:  time.Duration(helpers.GetEnvInt("JWT_ACCESS_MINUTES", 15)) * time.Minute,
+		refreshTTL: time.Duration(helpers.GetEnvInt("JWT_REFRESH_DAYS", 30)) * 24 * time.Hour,
+	}
+}
+
+// LoadTokenKeys loads the keys tokens are signed with, once. Servers call it
+// at startup so missing or broken keys stop them there; a TokenService made
+// without keys refuses to issue or accept tokens.
+func LoadTokenKeys() error {
+	tokenKeysOnce.Do(func() {
+		tokenKeys, tokenKeysErr = loadTokenKeys()
+	})
+	return tokenKeysErr
+}
+
+// loadTokenKeys reads JWT_KEYS, a comma-separated list of kid=value pairs.
+// With JWT_ALGORITHM=HS256 (the default) each value is a shared secret; with
+// RS256 it is the path to a PEM private key. JWT_SIGNING_KEY_ID picks the key
+// new tokens are signed with and defaults to the first one listed. Only with
+// ALLOW_EPHEMERAL_KEYS=true, meant for development, may JWT_KEYS be unset.
+func loadTokenKeys() (*jwt.KeySet, error) {
+	algorithm := helpers.GetEnv("JWT_ALGORITHM", jwt.HS256)
+	spec := helpers.GetEnv("JWT_KEYS", "")
+
+	if spec == "" {
+		if !helpers.GetEnvBool("ALLOW_EPHEMERAL_KEYS", false) {
+			return nil, errors.New("JWT_KEYS is not set; set ALLOW_EPHEMERAL_KEYS=true to sign tokens with a random key")
+		}
+		logger.Warn("JWT_KEYS is not set, signing tokens with a random key that will not survive a restart")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return jwt.NewKeySet("ephemeral", jwt.NewHS256Key("ephemeral", secret))
+	}
+
+	var keys []jwt.Key
+	for _, pair := range strings.Split(spec, ",") {
+		id, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || id == "" || value == "" {
+			return nil, fmt.Errorf("JWT_KEYS entry %q is not kid=value", pair)
+		}
+
+		switch algorithm {
+		case jwt.HS256:
+			keys = append(keys, jwt.NewHS256Key(id, []byte(value)))
+		case jwt.RS256:
+			private, err := readRSAKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("JWT key %s: %w", id, err)
+			}
+			keys = append(keys, jwt.NewRS256Key(id, private))
+		default:
+			return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", algorithm)
+		}
+	}
+
+	return jwt.NewKeySet(helpers.GetEnv("JWT_SIGNING_KEY_ID", keys[0].ID), keys...)
+}
+
+func readRSAKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("PEM key is not an RSA key")
+	}
+
+	return key, nil
+}
+
+// Issue starts a new refresh token family for user and returns its first
+// token pair.
+func (s TokenService) Issue(ctx context.Context, user models.User) (*models.TokenPair, error) {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	family, err := randomTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.SAdd(ctx, userTokenFamiliesPrefix+user.ID, s.refreshTTL, family); err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(ctx, tokenFamilyPrefix+family, user.ID, s.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	return s.issuePair(ctx, user.ID, family)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token works
+// once; a second use means it leaked, so the whole family is revoked.
+func (s TokenService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	claims, err := s.parse(refreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.cache.Get(ctx, tokenFamilyPrefix+claims.Family)
+	if err != nil {
+		if err == repositories.ErrCacheMiss {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	_, err = s.cache.GetDel(ctx, refreshTokenPrefix+claims.ID)
+	if err == repositories.ErrCacheMiss {
+		if err := s.revokeFamily(ctx, userID, claims.Family); err != nil {
+			return nil, err
+		}
+		logger.Warn(fmt.Sprintf("Refresh token reuse detected for user %s, revoked token family %s", userID, claims.Family))
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.users.GetActive(ctx, userID); err != nil {
+		if !errors.Is(err, repositories.ErrNotFound) {
+			return nil, err
+		}
+		s.revokeFamily(ctx, userID, claims.Family)
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.cache.Expire(ctx, tokenFamilyPrefix+claims.Family, s.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	return s.issuePair(ctx, userID, claims.Family)
+}
+
+// Authenticate validates an access token and returns the user ID it was
+// issued to. Tokens from a revoked family stop working immediately.
+func (s TokenService) Authenticate(ctx context.Context, accessToken string) (string, error) {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	claims, err := s.parse(accessToken, accessTokenType)
+	if err != nil {
+		return "", err
+	}
+
+	alive, err := s.cache.Exists(ctx, tokenFamilyPrefix+claims.Family)
+	if err != nil {
+		return "", err
+	}
+	if !alive {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
+
+// Revoke ends the login a refresh token belongs to.
+func (s TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	claims, err := s.parse(refreshToken, refreshTokenType)
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, claims.Subject, claims.Family)
+}
+
+// RevokeAll ends every token login the user has.
+func (s TokenService) RevokeAll(ctx context.Context, userID string) error {
+	ctx, cancel := withTimeout(ctx, opCache)
+	defer cancel()
+
+	families, err := s.cache.SMembers(ctx, userTokenFamiliesPrefix+userID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(families)+1)
+	for _, family := range families {
+		keys = append(keys, tokenFamilyPrefix+family)
+	}
+	keys = append(keys, userTokenFamiliesPrefix+userID)
+
+	return s.cache.Del(ctx, keys...)
+}
+
+func (s TokenService) issuePair(ctx context.Context, userID, family string) (*models.TokenPair, error) {
+	if s.keys == nil {
+		return nil, errTokenKeysMissing
+	}
+	now := time.Now()
+
+	accessID, err := randomTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refreshID, err := randomTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.keys.Sign(jwt.Claims{
+		Subject:   userID,
+		Type:      accessTokenType,
+		ID:        accessID,
+		Family:    family,
+		Issuer:    "manga_store",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.keys.Sign(jwt.Claims{
+		Subject:   userID,
+		Type:      refreshTokenType,
+		ID:        refreshID,
+		Family:    family,
+		Issuer:    "manga_store",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.refreshTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Set(ctx, refreshTokenPrefix+refreshID, family, s.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+func (s TokenService) parse(token, tokenType string) (*jwt.Claims, error) {
+	if s.keys == nil {
+		return nil, errTokenKeysMissing
+	}
+
+	claims, err := s.keys.Parse(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Type != tokenType || claims.Family == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (s TokenService) revokeFamily(ctx context.Context, userID, family string) error {
+	if err := s.cache.Del(ctx, tokenFamilyPrefix+family); err != nil {
+		return err
+	}
+	return s.cache.SRem(ctx, userTokenFamiliesPrefix+userID, family)
+}
+
+func randomTokenID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
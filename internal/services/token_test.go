@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/jwt"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain lets the tests sign tokens and cursors with random keys, as the
+// dev server does.
+func TestMain(m *testing.M) {
+	os.Setenv("ALLOW_EPHEMERAL_KEYS", "true")
+	os.Exit(m.Run())
+}
+
+func TestLoadTokenKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      string
+		ephemeral string
+		wantErr   bool
+	}{
+		{name: "configured", keys: "k1=first-secret,k2=second-secret", ephemeral: "false"},
+		{name: "missing", ephemeral: "false", wantErr: true},
+		{name: "missing but ephemeral allowed", ephemeral: "true"},
+		{name: "malformed", keys: "k1", ephemeral: "true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_KEYS", tt.keys)
+			t.Setenv("ALLOW_EPHEMERAL_KEYS", tt.ephemeral)
+
+			keys, err := loadTokenKeys()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loaded keys, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := keys.Sign(jwt.Claims{Subject: "reader", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := keys.Parse(token); err != nil {
+				t.Errorf("parsing a token signed with the loaded keys: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesTheFamily(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	s := NewTokenService(stores)
+
+	user, err := stores.Users.Create(ctx, models.User{Email: "reader@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.Issue(ctx, *user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("first refresh failed: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, second.AccessToken); err != nil {
+		t.Fatalf("refreshed access token was rejected: %v", err)
+	}
+
+	// Another login keeps its own family, and must survive the revocation.
+	other, err := s.Issue(ctx, *user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a refresh token: error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	if _, err := s.Authenticate(ctx, first.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token from the revoked family: error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := s.Authenticate(ctx, second.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("latest access token from the revoked family: error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := s.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unused refresh token from the revoked family: error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	if _, err := s.Authenticate(ctx, other.AccessToken); err != nil {
+		t.Errorf("access token from another login was revoked: %v", err)
+	}
+	if _, err := s.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("refresh token from another login was revoked: %v", err)
+	}
+}
+
+func TestRefreshRejectsAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	s := NewTokenService(stores)
+
+	user, err := stores.Users.Create(ctx, models.User{Email: "reader@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := s.Issue(ctx, *user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(ctx, pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refreshing with an access token: error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := s.Authenticate(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("authenticating with a refresh token: error = %v, want %v", err, ErrInvalidToken)
+	}
+}
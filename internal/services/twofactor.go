@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"manga_store/internal/helpers"
+	"manga_store/internal/models"
+	"manga_store/internal/repositories"
+	"manga_store/internal/totp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotSetUp       = errors.New("two-factor authentication has not been set up")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("staff accounts must keep two-factor authentication enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorService manages TOTP enrolment and checks second-factor codes.
+// Recovery codes are single-use and stored hashed.
+type TwoFactorService struct {
+	users  repositories.UserRepository
+	issuer string
+}
+
+func NewTwoFactorService(stores repositories.Stores) TwoFactorService {
+	return TwoFactorService{
+		users:  stores.Users,
+		issuer: helpers.GetEnv("TOTP_ISSUER", "Manga Store"),
+	}
+}
+
+// Setup starts enrolment with a fresh secret. It has no effect on login
+// until Enable confirms the user's authenticator produces matching codes.
+func (s TwoFactorService) Setup(ctx context.Context, userID primitive.ObjectID) (*models.TwoFactorSetup, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.users.SetTwoFactor(ctx, userID.Hex(), &models.TwoFactor{Secret: secret, RecoveryCodes: []string{}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms enrolment with a code from the authenticator and returns
+// the recovery codes. They are shown only this once.
+func (s TwoFactorService) Enable(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactor == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if user.TwoFactor.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.users.EnableTwoFactor(ctx, userID.Hex(), user.TwoFactor.Secret, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a current code.
+// Staff cannot turn it off.
+func (s TwoFactorService) Disable(ctx context.Context, userID primitive.ObjectID, code string) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotSetUp
+	}
+	if user.IsStaff() {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.verify(ctx, *user, code); err != nil {
+		return err
+	}
+
+	return s.users.SetTwoFactor(ctx, userID.Hex(), nil)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code, and returns the new ones.
+func (s TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, opWrite)
+	defer cancel()
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	if err := s.verify(ctx, *user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.users.SetRecoveryCodes(ctx, userID.Hex(), hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verify accepts a TOTP code only from a later time step than the last one
+// used, so an observed code cannot be replayed, or else burns a recovery code.
+func (s TwoFactorService) verify(ctx context.Context, user models.User, code string) error {
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotSetUp
+	}
+
+	if step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now()); ok {
+		used, err := s.users.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.users.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (s TwoFactorService) findUser(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+	user, err := s.users.GetActive(ctx, userID.Hex())
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// generateRecoveryCodes returns codes formatted for display, such as
+// "k3jd9-x7qpa", along with the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
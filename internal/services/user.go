@@ -4,341 +4,264 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"manga_store/internal/databases"
 	"manga_store/internal/logger"
 	"manga_store/internal/models"
-	"time"
+	"manga_store/internal/pagination"
+	"manga_store/internal/repositories"
 
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserService struct {
-	users *mongo.Collection
-	manga *mongo.Collection
-	neo4j neo4j.SessionWithContext
+	tx     repositories.Transactor
+	users  repositories.UserRepository
+	manga  repositories.MangaRepository
+	outbox repositories.Outbox
+	graph  repositories.GraphStore
+	cache  repositories.Cache
+	orders OrderService
 }
 
-func NewUserService() UserService {
+func NewUserService(stores repositories.Stores) UserService {
 	return UserService{
-		users: databases.Users(),
-		manga: databases.Manga(),
-		neo4j: databases.Neo4j(context.Background()),
+		tx:     stores.Tx,
+		users:  stores.Users,
+		manga:  stores.Manga,
+		outbox: stores.Outbox,
+		graph:  stores.Graph,
+		cache:  stores.Cache,
+		orders: NewOrderService(stores),
 	}
 }
 
-func (s UserService) GetUser(userID primitive.ObjectID) (*models.User, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    var user models.User
-    err := s.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return nil, errors.New("user not found")
-        }
-        return nil, errors.New("failed to retrieve user from MongoDB")
-    }
-
-    return &user, nil
-}
-
-
-func (s UserService) GetRecsByPreferences(userID string) ([]models.Manga, error) {
-	neo4jCtx := context.Background()
-
-	// Step 1: Find genres of high-rated manga (rated > 4)
-	genreQuery := `
-	    MATCH (u:User {id: $userID})-[r:RATED]->(manga:Manga)
-	    WHERE r.score > 4
-	    WITH u, apoc.coll.flatten(collect(DISTINCT manga.genres)) AS userGenres
-
-	    MATCH (otherManga:Manga)
-	    WHERE any(genre IN otherManga.genres WHERE genre IN userGenres)
-	    AND NOT (u)-[:RATED|PURCHASED]->(otherManga)
-	    RETURN DISTINCT otherManga.id AS id, otherManga.genres AS genres
-	    LIMIT 10
-	`
-
-	genreResult, err := s.neo4j.ExecuteRead(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		res, err := tx.Run(neo4jCtx, genreQuery, map[string]interface{}{
-			"userID": userID,
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		var mangaIDs []string
-
-		for res.Next(neo4jCtx) {
-			record := res.Record()
-			id, ok := record.Get("id")
-			if ok {
-				mangaIDs = append(mangaIDs, id.(string))
-			}
-		}
+func (s UserService) GetUser(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
 
-		if err = res.Err(); err != nil {
-			return nil, err
+	user, err := s.users.Get(ctx, userID.Hex())
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errors.New("user not found")
 		}
+		return nil, errors.New("failed to retrieve user")
+	}
 
-		return mangaIDs, nil
-	})
-
+	user.PurchaseHistory, err = s.orders.PurchaseHistory(ctx, *user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get manga IDs: %w", err)
+		return nil, errors.New("failed to retrieve purchase history")
 	}
 
-	mangaIDs, _ := genreResult.([]string)
+	return user, nil
+}
 
-	// Convert manga IDs to ObjectIDs for MongoDB
-	mangaObjectIDs := []primitive.ObjectID{}
-	for _, v := range mangaIDs {
-		objectId, err := primitive.ObjectIDFromHex(v)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert manga ID to ObjectID: %w", err)
-		}
-		mangaObjectIDs = append(mangaObjectIDs, objectId)
-	}
+// GetActiveUser loads a user that has not been deleted, without the purchase
+// history GetUser assembles. It is cheap enough to call on every request.
+func (s UserService) GetActiveUser(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx, opRead)
+	defer cancel()
 
-	// Step 2: Fetch the manga from MongoDB using the retrieved IDs
-	recommendations, err := fetchMangaFromMongoDB(s, mangaObjectIDs)
+	user, err := s.users.GetActive(ctx, userID.Hex())
 	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errors.New("user not found")
+		}
 		return nil, err
 	}
 
-	return recommendations, nil
+	return user, nil
 }
 
-func fetchMangaFromMongoDB(s UserService, mangaObjectIDs []primitive.ObjectID) ([]models.Manga, error) {
-	var recommendations []models.Manga
+// GetRecsByPreferences recommends manga sharing genres with the ones the
+// user rated highly (> 4), ranked by how many genres they share.
+func (s UserService) GetRecsByPreferences(ctx context.Context, userID string, params pagination.Params) (pagination.Page[models.Manga], error) {
+	return s.recommend(ctx, userID, s.graph.RecommendByPreferences, params)
+}
 
-	if len(mangaObjectIDs) > 0 {
-		filter := bson.M{"_id": bson.M{"$in": mangaObjectIDs}}
+// GetRecsBySimilarUsers recommends what users who rated the same manga
+// highly rated next, best average score first.
+func (s UserService) GetRecsBySimilarUsers(ctx context.Context, userID string, params pagination.Params) (pagination.Page[models.Manga], error) {
+	return s.recommend(ctx, userID, s.graph.RecommendBySimilarUsers, params)
+}
 
-		cursor, err := s.manga.Find(context.Background(), filter)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch manga: %w", err)
-		}
-		defer cursor.Close(context.Background())
+// recommend pages through the manga IDs a recommendation query returns, in
+// its own order, and loads them from the catalog. Recommendations are
+// ranked, so they are paged by offset. A user with nothing to go on gets the
+// popular list instead.
+func (s UserService) recommend(ctx context.Context, userID string, rank func(ctx context.Context, userID string, skip, limit int) ([]string, error), params pagination.Params) (pagination.Page[models.Manga], error) {
+	ctx, cancel := withTimeout(ctx, opGraph)
+	defer cancel()
 
-		for cursor.Next(context.Background()) {
-			var manga models.Manga
-			if err := cursor.Decode(&manga); err != nil {
-				return nil, err
-			}
-			recommendations = append(recommendations, manga)
-		}
+	page := pagination.Page[models.Manga]{Items: []models.Manga{}}
 
-		if err := cursor.Err(); err != nil {
-			return nil, err
-		}
-	} else {
-		logger.Debug("Retrieving popular manga")
-		popular, err := NewMangaService().GetPopularManga()
-		if err != nil {
-			return nil, err
-		}
-		recommendations = append(recommendations, popular...)
+	if params.Sort != "" && params.Sort != sortRelevance {
+		return page, fmt.Errorf("%w %q", pagination.ErrInvalidSort, params.Sort)
 	}
+	cursor, err := pagination.Decode(params.Cursor, sortRelevance)
+	if err != nil {
+		return page, err
+	}
+	limit := params.PageSize()
 
-	return recommendations, nil
-}
+	mangaIDs, err := rank(ctx, userID, cursor.Offset, limit+1)
+	if err != nil {
+		return page, fmt.Errorf("failed to get manga recommendations: %w", err)
+	}
 
-func (s UserService) GetRecsBySimilarUsers(userID string) ([]models.Manga, error) {
-	neo4jCtx := context.Background()
-
-	// Neo4j query for collaborative filtering
-	recQuery := `
-        // Step 1: Find the manga rated by the target user with high ratings
-        MATCH (u:User {id: $userID})-[r:RATED]->(manga:Manga)
-        WHERE r.score > 4
-        WITH u, manga
-
-        // Step 2: Find other users who have rated the same manga highly
-        MATCH (otherUser:User)-[otherRating:RATED]->(manga)
-        WHERE otherUser <> u AND otherRating.score > 4
-
-        // Step 3: Find other manga rated by similar users
-        MATCH (otherUser)-[similarRating:RATED]->(similarManga:Manga)
-        WHERE NOT (u)-[:RATED|PURCHASED]->(similarManga)
-        
-        // Step 4: Aggregate the recommendations and calculate the average rating
-        WITH similarManga, avg(similarRating.score) AS avgRating, count(similarRating) AS ratingCount
-        RETURN similarManga.id AS id, similarManga.genres AS genres, avgRating, ratingCount
-        ORDER BY avgRating DESC, ratingCount DESC
-        LIMIT 10
-    `
-
-	// Execute the Neo4j query
-	recResult, err := s.neo4j.ExecuteRead(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		res, err := tx.Run(neo4jCtx, recQuery, map[string]interface{}{
-			"userID": userID,
-		})
-		if err != nil {
-			return nil, err
-		}
+	if len(mangaIDs) > limit {
+		mangaIDs = mangaIDs[:limit]
+		page.NextCursor = pagination.OffsetCursor(sortRelevance, cursor.Offset+limit)
+	}
 
-		var mangaIDs []string
-		for res.Next(neo4jCtx) {
-			record := res.Record()
-			id, ok := record.Get("id")
-			if ok {
-				mangaIDs = append(mangaIDs, id.(string))
-			}
+	if len(mangaIDs) == 0 && cursor.Offset == 0 {
+		logger.Debug("Retrieving popular manga")
+		popular, err := popularManga(ctx, s.manga, s.cache)
+		if err != nil {
+			return page, err
 		}
+		page.Items = append(page.Items, popular...)
+		return page, nil
+	}
 
-		if err = res.Err(); err != nil {
-			return nil, err
-		}
+	recommendations, err := fetchManga(ctx, s, mangaIDs)
+	if err != nil {
+		return page, err
+	}
+	page.Items = append(page.Items, recommendations...)
 
-		return mangaIDs, nil
-	})
+	return page, nil
+}
 
+// fetchManga loads the active manga among mangaIDs, keeping the order of the
+// IDs.
+func fetchManga(ctx context.Context, s UserService, mangaIDs []string) ([]models.Manga, error) {
+	found, err := s.manga.Find(ctx, mangaIDs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get manga recommendations: %w", err)
+		return nil, fmt.Errorf("failed to fetch manga: %w", err)
 	}
 
-	mangaIDs, _ := recResult.([]string)
-
-	// Convert manga IDs to ObjectIDs for MongoDB
-	mangaObjectIDs := []primitive.ObjectID{}
-	for _, v := range mangaIDs {
-		objectId, err := primitive.ObjectIDFromHex(v)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert manga ID to ObjectID: %w", err)
-		}
-		mangaObjectIDs = append(mangaObjectIDs, objectId)
+	byID := make(map[string]models.Manga, len(found))
+	for _, manga := range found {
+		byID[manga.ID] = manga
 	}
 
-	// Step 5: Fetch the manga from MongoDB using the retrieved IDs
-	recommendations, err := fetchMangaFromMongoDB(s, mangaObjectIDs)
-	if err != nil {
-		return nil, err
+	recommendations := make([]models.Manga, 0, len(found))
+	for _, id := range mangaIDs {
+		if manga, ok := byID[id]; ok {
+			recommendations = append(recommendations, manga)
+		}
 	}
 
 	return recommendations, nil
 }
 
-func (s UserService) DeleteUser(userID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s UserService) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
 	defer cancel()
 
-	_, err := s.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"isDeleted": true}})
-	if err != nil {
-		return err
-	}
+	return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.users.SetDeleted(ctx, userID.Hex(), true); err != nil {
+			return err
+		}
 
-	neo4jCtx := context.Background()
-	_, err = s.neo4j.ExecuteWrite(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		_, err := tx.Run(neo4jCtx, `
-			MATCH (u:User {id: $id})
-			DETACH DELETE u
-		`, map[string]interface{}{
-			"id": userID.Hex(),
+		return s.outbox.Record(ctx, models.GraphEventUserDeleted, models.GraphEventPayload{
+			UserID: userID.Hex(),
 		})
-		return nil, err
 	})
-
-	if err != nil {
-		return errors.New("failed to delete user in Neo4j")
-	}
-
-	return nil
 }
 
-func (s UserService) RestoreUser(userID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// RestoreUser takes a user out of the trash. Someone may have registered
+// the deleted user's email since, in which case it returns ErrEmailTaken and
+// leaves the user deleted.
+func (s UserService) RestoreUser(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, opWrite)
 	defer cancel()
 
-	// Step 1: Update MongoDB User
-	_, err := s.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"isDeleted": false}})
-	if err != nil {
-		return fmt.Errorf("failed to update user status in MongoDB: %w", err)
-	}
+	return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		// Step 1: Update the user, unless their email is in use again
+		deleted, err := s.users.Get(ctx, userID.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve user: %w", err)
+		}
+		active, err := s.users.GetActiveByEmail(ctx, deleted.Email)
+		if err == nil && active.ID != deleted.ID {
+			return ErrEmailTaken
+		}
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
 
-	// Step 2: Retrieve User from MongoDB
-	var user models.User
-	err = s.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve user from MongoDB: %w", err)
-	}
+		if err := s.users.SetDeleted(ctx, userID.Hex(), false); err != nil {
+			return fmt.Errorf("failed to update user status: %w", err)
+		}
 
-	neo4jCtx := context.Background()
-	_, err = s.neo4j.ExecuteWrite(neo4jCtx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		// Step 3: Restore or Create User Node in Neo4j
-		_, err := tx.Run(neo4jCtx, `
-			MERGE (u:User {id: $userID})
-			SET u.email = $email
-		`, map[string]interface{}{
-			"userID": userID.Hex(),
-			"email":  user.Email,
+		// Step 2: Retrieve the user
+		user, err := s.users.Get(ctx, userID.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve user: %w", err)
+		}
+
+		purchases, err := s.orders.purchaseHistory(ctx, *user)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve purchase history: %w", err)
+		}
+
+		// Step 3: Restore or Create User Node in the graph
+		err = s.outbox.Record(ctx, models.GraphEventUserUpserted, models.GraphEventPayload{
+			UserID: userID.Hex(),
+			Email:  user.Email,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create/update user node in Neo4j: %w", err)
+			return err
 		}
 
 		// Step 4: Restore Ratings Relationships
 		for _, rating := range user.Ratings {
-			var manga models.Manga
-			mangaObjectId, _ := primitive.ObjectIDFromHex(rating.MangaID)
-			err = s.manga.FindOne(ctx, bson.M{"_id": mangaObjectId}).Decode(&manga)
+			manga, err := s.findGraphManga(ctx, rating.MangaID)
+			if errors.Is(err, ErrMangaNotFound) {
+				continue
+			}
 			if err != nil {
-				return nil, fmt.Errorf("failed to find manga for rating in MongoDB: %w", err)
+				return fmt.Errorf("failed to find manga for rating: %w", err)
 			}
 
-			_, err = tx.Run(neo4jCtx, `
-				MERGE (u:User {id: $userID})
-				MERGE (m:Manga {id: $mangaID})
-				ON CREATE SET m.title = $title, m.genres = $genres
-				MERGE (u)-[r:RATED]->(m)
-				SET r.score = $score
-			`, map[string]interface{}{
-				"userID":  userID.Hex(),
-				"mangaID": rating.MangaID,
-				"title":   manga.Title,
-				"genres":  manga.Genres,
-				"score":   rating.Score,
+			err = s.outbox.Record(ctx, models.GraphEventMangaRated, models.GraphEventPayload{
+				UserID: userID.Hex(),
+				Manga:  []models.GraphManga{manga},
+				Score:  rating.Score,
 			})
 			if err != nil {
-				return nil, fmt.Errorf("failed to create/update RATED relationship in Neo4j: %w", err)
+				return err
 			}
 		}
 
 		// Step 5: Restore Purchase Relationships
-		for _, purchase := range user.PurchaseHistory {
-			var manga models.Manga
-			mangaObjectId, _ := primitive.ObjectIDFromHex(purchase.MangaID)
-			err = s.manga.FindOne(ctx, bson.M{"_id": mangaObjectId}).Decode(&manga)
-			if err != nil {
-				return nil, fmt.Errorf("failed to find manga for purchase in MongoDB: %w", err)
+		var purchased []models.GraphManga
+		for _, purchase := range purchases {
+			manga, err := s.findGraphManga(ctx, purchase.MangaID)
+			if errors.Is(err, ErrMangaNotFound) {
+				continue
 			}
-
-			_, err = tx.Run(neo4jCtx, `
-				MERGE (u:User {id: $userID})
-				MERGE (m:Manga {id: $mangaID})
-				ON CREATE SET m.title = $title, m.genres = $genres
-				MERGE (u)-[p:PURCHASED]->(m)
-			`, map[string]interface{}{
-				"userID":       userID.Hex(),
-				"mangaID":      purchase.MangaID,
-				"title":        manga.Title,
-				"genres":       manga.Genres,
-				"purchaseDate": purchase.PurchaseDate,
-			})
 			if err != nil {
-				return nil, fmt.Errorf("failed to create/update PURCHASED relationship in Neo4j: %w", err)
+				return fmt.Errorf("failed to find manga for purchase: %w", err)
 			}
+			purchased = append(purchased, manga)
+		}
+		if len(purchased) == 0 {
+			return nil
 		}
 
-		return nil, nil
+		return s.outbox.Record(ctx, models.GraphEventMangaPurchased, models.GraphEventPayload{
+			UserID: userID.Hex(),
+			Manga:  purchased,
+		})
 	})
+}
 
+func (s UserService) findGraphManga(ctx context.Context, mangaID string) (models.GraphManga, error) {
+	manga, err := s.manga.Get(ctx, mangaID)
 	if err != nil {
-		return fmt.Errorf("failed to restore user relationships in Neo4j: %w", err)
+		return models.GraphManga{}, mangaNotFound(err)
 	}
 
-	return nil
+	return graphManga(*manga), nil
 }
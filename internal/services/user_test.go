@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"manga_store/internal/mailer"
+	"manga_store/internal/repositories"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRestoreUserWhoseEmailWasTaken(t *testing.T) {
+	ctx := context.Background()
+	stores := repositories.NewMemoryStores()
+	auth := NewAuthService(stores, mailer.NewMemoryMailer())
+	s := NewUserService(stores)
+
+	register := func() primitive.ObjectID {
+		t.Helper()
+		if err := auth.Register(ctx, "reader@example.com", "correct horse"); err != nil {
+			t.Fatal(err)
+		}
+		user, err := stores.Users.GetActiveByEmail(ctx, "reader@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := primitive.ObjectIDFromHex(user.ID)
+		return id
+	}
+
+	original := register()
+	if err := s.DeleteUser(ctx, original); err != nil {
+		t.Fatal(err)
+	}
+	replacement := register()
+
+	if err := s.RestoreUser(ctx, original); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("restoring over an active account: error = %v, want %v", err, ErrEmailTaken)
+	}
+	if _, err := stores.Users.GetActive(ctx, original.Hex()); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("user was restored next to an active account with the same email: %v", err)
+	}
+
+	if err := s.DeleteUser(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreUser(ctx, original); err != nil {
+		t.Fatalf("restoring once the email is free: %v", err)
+	}
+	if _, err := stores.Users.GetActive(ctx, original.Hex()); err != nil {
+		t.Errorf("user is still deleted after restoring: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238 Appendix B, "12345678901234567890",
+// base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists eight digit codes. Dynamic truncation takes the value modulo
+// 10^digits, so the six digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestCodeAtMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := CodeAt(rfcSecret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != vector.code {
+			t.Errorf("code at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestCodeAtAcceptsLowercaseSecrets(t *testing.T) {
+	code, err := CodeAt("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Errorf("code = %s, want 287082", code)
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	// 1111111109 is the last second of its step.
+	issued := time.Unix(1111111109, 0)
+	step := Step(issued)
+	code := "081804"
+
+	stepStart := time.Unix(step*Period, 0)
+	stepEnd := stepStart.Add(Period*time.Second - time.Second)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"same step", issued, true},
+		{"start of the same step", stepStart, true},
+		{"start of the next step", stepStart.Add(Period * time.Second), true},
+		{"end of the next step", stepEnd.Add(Period * time.Second), true},
+		{"two steps later", stepStart.Add(2 * Period * time.Second), false},
+		{"end of the previous step", stepEnd.Add(-Period * time.Second), true},
+		{"start of the previous step", stepStart.Add(-Period * time.Second), true},
+		{"two steps earlier", stepEnd.Add(-2 * Period * time.Second), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matched, ok := Validate(rfcSecret, code, test.at)
+			if ok != test.ok {
+				t.Fatalf("Validate at %d = %v, want %v", test.at.Unix(), ok, test.ok)
+			}
+			if ok && matched != step {
+				t.Errorf("matched step %d, want %d", matched, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, at); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "287 082", at); !ok {
+		t.Error("Validate rejected a code typed with a space")
+	}
+	if _, ok := Validate("not base32!", "287082", at); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
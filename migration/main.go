@@ -2,115 +2,91 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"manga_store/internal/databases"
+	"manga_store/internal/migrations"
 	"os"
-
-	"github.com/joho/godotenv"
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type Manga struct {
-	ID     string   `json:"id" bson:"_id,omitempty"`
-	Title  string   `json:"title" bson:"title"`
-	Genres []string `json:"genres" bson:"genres"`
-}
+const usage = `usage: migration <command> [flags]
 
-type User struct {
-	ID    string `json:"id" bson:"_id,omitempty"`
-	Email string `json:"email" bson:"email"`
-}
+commands:
+  up [-to N]       apply pending migrations, up to version N if given
+  down [-steps N]  revert the N most recently applied migrations (default 1)
+  status           list migrations and whether they are applied
+  unlock           clear the lock left by a crashed run`
 
 func main() {
-	// Load environment variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	mongoURI := os.Getenv("MONGO_URI")
-	neo4jURI := os.Getenv("NEO4J_URI")
-	neo4jUsername := os.Getenv("NEO4J_USERNAME")
-	neo4jPassword := os.Getenv("NEO4J_PASSWORD")
-
-	fmt.Println(mongoURI)
-	fmt.Println(neo4jURI)
-	fmt.Println(neo4jUsername)
-	fmt.Println(neo4jPassword)
-
-	// Connect to MongoDB
-	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		log.Fatal(err)
+	command, args := os.Args[1], os.Args[2:]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	to := flags.Int("to", 0, "with up, stop after this version")
+	steps := flags.Int("steps", 1, "with down, number of migrations to revert")
+	flags.Parse(args)
+
+	databases.InitMongo()
+	databases.InitNeo4j()
+	defer databases.CloseNeo4j(context.Background())
+
+	ctx := context.Background()
+	runner := migrations.NewRunner(migrations.Stores{
+		Mongo: databases.Database(),
+		Neo4j: databases.Neo4j(),
+	}, migrations.All)
+
+	var err error
+	switch command {
+	case "up":
+		var ran []migrations.Migration
+		ran, err = runner.Up(ctx, *to)
+		report("applied", ran)
+	case "down":
+		var ran []migrations.Migration
+		ran, err = runner.Down(ctx, *steps)
+		report("reverted", ran)
+	case "status":
+		err = printStatus(ctx, runner)
+	case "unlock":
+		err = runner.Unlock(ctx)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
-	defer mongoClient.Disconnect(context.Background())
-	mangaCollection := mongoClient.Database("manga_store").Collection("manga")
-	userCollection := mongoClient.Database("manga_store").Collection("users")
 
-	// Connect to Neo4j
-	driver, err := neo4j.NewDriver(neo4jURI, neo4j.BasicAuth(neo4jUsername, neo4jPassword, ""))
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, "migration failed:", err)
+		os.Exit(1)
 	}
-	defer driver.Close()
+}
 
-	// Insert Manga nodes
-	cursor, err := mangaCollection.Find(context.Background(), bson.M{})
-	if err != nil {
-		log.Fatal(err)
+func report(verb string, ran []migrations.Migration) {
+	if len(ran) == 0 {
+		fmt.Println("nothing to do")
+		return
 	}
-	defer cursor.Close(context.Background())
-
-	for cursor.Next(context.Background()) {
-		var manga Manga
-		if err := cursor.Decode(&manga); err != nil {
-			log.Fatal(err)
-		}
-
-		session := driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-		_, err = session.Run(
-			"MERGE (m:Manga {id: $id, title: $title, genres: $genres})",
-			map[string]interface{}{
-				"id":     manga.ID,
-				"title":  manga.Title,
-				"genres": manga.Genres,
-			},
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		session.Close()
+	for _, m := range ran {
+		fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
 	}
+}
 
-	// Insert User nodes
-	cursor, err = userCollection.Find(context.Background(), bson.M{})
+func printStatus(ctx context.Context, runner migrations.Runner) error {
+	statuses, err := runner.Status(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer cursor.Close(context.Background())
-
-	for cursor.Next(context.Background()) {
-		var user User
-		if err := cursor.Decode(&user); err != nil {
-			log.Fatal(err)
-		}
 
-		session := driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-		_, err = session.Run(
-			"MERGE (u:User {id: $id, email: $email})",
-			map[string]interface{}{
-				"id":    user.ID,
-				"email": user.Email,
-			},
-		)
-		if err != nil {
-			log.Fatal(err)
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
 		}
-		session.Close()
+		fmt.Printf("%04d_%-28s %s\n", s.Version, s.Name, applied)
 	}
 
-	fmt.Println("Data migration to Neo4j completed successfully!")
+	return nil
 }
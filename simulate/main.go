@@ -80,7 +80,7 @@ func main() {
 		}
 
 		// Step 1: Login
-		cookies, err := loginUser(user.Email, "12345678")
+		token, err := loginUser(user.Email, "12345678")
 		if err != nil {
 			log.Printf("Error logging in user %s: %v", user.Email, err)
 			continue
@@ -91,14 +91,14 @@ func main() {
 		randomManga := mangas[rand.Intn(len(mangas))]
 
 		// Step 2: Get Manga details
-		err = getMangaDetails(cookies, randomManga.ID)
+		err = getMangaDetails(token, randomManga.ID)
 		if err != nil {
 			log.Printf("Error fetching manga details for user %s: %v", user.Email, err)
 			continue
 		}
 
 		// Step 3: Purchase Manga
-		err = purchaseManga(cookies, randomManga.ID)
+		err = purchaseManga(token, randomManga.ID)
 		if err != nil {
 			log.Printf("Error purchasing manga for user %s: %v", user.Email, err)
 			continue
@@ -106,7 +106,7 @@ func main() {
 
 		// Step 4: Rate Manga
 		randomRating := float64(rand.Intn(3)+3) + rand.Float64()
-		err = rateManga(cookies, randomManga.ID, randomRating)
+		err = rateManga(token, randomManga.ID, randomRating)
 		if err != nil {
 			log.Printf("Error rating manga for user %s: %v", user.Email, err)
 			continue
@@ -118,33 +118,40 @@ func main() {
 
 }
 
-func loginUser(email, password string) ([]*http.Cookie, error) {
-	url := "http://localhost:3000/auth/login"
+// loginUser asks for a bearer token rather than a session cookie, which a
+// script has no browser to keep.
+func loginUser(email, password string) (string, error) {
+	url := "http://localhost:3000/auth/token"
 	body := map[string]string{"email": email, "password": password}
 	jsonBody, _ := json.Marshal(body)
 
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("login failed with status code: %d", resp.StatusCode)
+		return "", fmt.Errorf("login failed with status code: %d", resp.StatusCode)
 	}
 
-	return resp.Cookies(), nil
+	var tokens struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+
+	return tokens.AccessToken, nil
 }
 
-func getMangaDetails(cookies []*http.Cookie, mangaID string) error {
+func getMangaDetails(token string, mangaID string) error {
 	url := fmt.Sprintf("http://localhost:3000/manga/%s", mangaID)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
 	}
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
-	}
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -161,7 +168,7 @@ func getMangaDetails(cookies []*http.Cookie, mangaID string) error {
 	return err
 }
 
-func purchaseManga(cookies []*http.Cookie, mangaID string) error {
+func purchaseManga(token string, mangaID string) error {
 	url := "http://localhost:3000/manga/purchase"
 	body := map[string]string{"mangaId": mangaID}
 	jsonBody, _ := json.Marshal(body)
@@ -170,9 +177,7 @@ func purchaseManga(cookies []*http.Cookie, mangaID string) error {
 	if err != nil {
 		return err
 	}
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
-	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
@@ -189,7 +194,7 @@ func purchaseManga(cookies []*http.Cookie, mangaID string) error {
 	return nil
 }
 
-func rateManga(cookies []*http.Cookie, mangaID string, score float64) error {
+func rateManga(token string, mangaID string, score float64) error {
 	url := fmt.Sprintf("http://localhost:3000/manga/%s/rate", mangaID)
 	body := map[string]float64{"score": score}
 	jsonBody, _ := json.Marshal(body)
@@ -198,9 +203,7 @@ func rateManga(cookies []*http.Cookie, mangaID string, score float64) error {
 	if err != nil {
 		return err
 	}
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
-	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}